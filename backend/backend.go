@@ -6,18 +6,35 @@ import (
 	"github.com/go-chi/chi"
 )
 
-var authController = controllers.NewAuthController()
-var accountsController = controllers.NewAccountsController()
-var transferController = controllers.NewTransferController()
-var generateController = controllers.NewGenerateController()
-
 func MountBackend(router *chi.Mux) *chi.Mux {
+	// Controllers open their repositories, so they are created once the database is open
+	authController := controllers.NewAuthController()
+	accountsController := controllers.NewAccountsController()
+	transferController := controllers.NewTransferController()
+	generateController := controllers.NewGenerateController()
+	vaultController := controllers.NewVaultController()
+	sessionsController := controllers.NewSessionsController()
+	tokensController := controllers.NewTokensController()
+	auditController := controllers.NewAuditController()
+	backupController := controllers.NewBackupController()
+	breachesController := controllers.NewBreachesController()
+	reportsController := controllers.NewReportsController()
+	policiesController := controllers.NewPoliciesController()
+
 	apiRouter := chi.NewRouter()
 
 	authController.MountAuthRouter(apiRouter)
 	accountsController.MountAccountsRouter(apiRouter)
 	transferController.MountTransferRouter(apiRouter)
 	generateController.MountGenerateRouter(apiRouter)
+	vaultController.MountVaultRouter(apiRouter)
+	sessionsController.MountSessionsRouter(apiRouter)
+	tokensController.MountTokensRouter(apiRouter)
+	auditController.MountAuditRouter(apiRouter)
+	backupController.MountBackupRouter(apiRouter)
+	breachesController.MountBreachesRouter(apiRouter)
+	reportsController.MountReportsRouter(apiRouter)
+	policiesController.MountPoliciesRouter(apiRouter)
 
 	router.Mount("/api", apiRouter)
 
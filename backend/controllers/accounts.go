@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
@@ -16,6 +17,7 @@ import (
 type AccountsController struct {
 	validator      *validator.Validate
 	service        *services.AccountsService
+	breachService  *services.BreachService
 	accountsRouter *router.Router
 }
 
@@ -23,20 +25,29 @@ func NewAccountsController() *AccountsController {
 	return &AccountsController{
 		validator:      pipes.GetValidator(),
 		service:        services.NewAccountsService(),
+		breachService:  services.NewBreachService(),
 		accountsRouter: router.NewRouter(chi.NewRouter()),
 	}
 }
 
 func (controller *AccountsController) MountAccountsRouter(router *chi.Mux) {
-	controller.accountsRouter.Mux().Use(guards.JWTGuard)
+	reader := controller.accountsRouter.With(guards.ScopeGuard(models.ScopeAccountsRead))
+	writer := controller.accountsRouter.With(guards.ScopeGuard(models.ScopeAccountsWrite))
 
-	controller.accountsRouter.Get("/", controller.GetAccounts)
-	controller.accountsRouter.Get("/identifiers", controller.GetUniqueIdentifiers)
-	controller.accountsRouter.Get("/{id}", controller.GetAccount)
-	controller.accountsRouter.Get("/{id}/passphrase", controller.GetPassphrase)
-	controller.accountsRouter.Post("/", controller.CreateAccount)
-	controller.accountsRouter.Put("/{id}", controller.UpdateAccount)
-	controller.accountsRouter.Delete("/{id}", controller.DeleteAccount)
+	reader.Get("/", controller.GetAccounts)
+	reader.Get("/identifiers", controller.GetUniqueIdentifiers)
+	reader.Get("/due", controller.GetDueAccounts)
+	reader.Get("/{id}", controller.GetAccount)
+	reader.Get("/{id}/passphrase", controller.GetPassphrase)
+	reader.Get("/{id}/totp", controller.GetTotp)
+	reader.Get("/{id}/history", controller.GetHistory)
+	reader.Get("/{id}/history/{entryId}/passphrase", controller.GetHistoryPassphrase)
+	writer.Post("/", controller.CreateAccount)
+	writer.Put("/{id}", controller.UpdateAccount)
+	writer.Delete("/{id}", controller.DeleteAccount)
+	writer.Post("/{id}/history/{entryId}/restore", controller.RestoreHistory)
+	writer.Post("/breaches", controller.CheckBreaches)
+	writer.Post("/{id}/breaches", controller.CheckAccountBreaches)
 
 	router.Mount("/accounts", controller.accountsRouter.Mux())
 }
@@ -45,6 +56,18 @@ func (controller *AccountsController) GetAccounts(
 	writer http.ResponseWriter,
 	request *http.Request,
 ) error {
+	// Exact matches are looked up through the blind indexes
+	platform := request.URL.Query().Get("platform")
+	identifier := request.URL.Query().Get("identifier")
+	if platform != "" || identifier != "" {
+		accounts, err := controller.service.FindAccounts(platform, identifier)
+		if err != nil {
+			return err
+		}
+
+		return json.NewEncoder(writer).Encode(accounts)
+	}
+
 	accounts, err := controller.service.GetAccounts()
 	if err != nil {
 		return err
@@ -65,6 +88,18 @@ func (controller *AccountsController) GetUniqueIdentifiers(
 	return json.NewEncoder(writer).Encode(identifiers)
 }
 
+func (controller *AccountsController) GetDueAccounts(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	accounts, err := controller.service.GetDueAccounts()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(accounts)
+}
+
 func (controller *AccountsController) GetAccount(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -78,7 +113,7 @@ func (controller *AccountsController) GetAccount(
 		)
 	}
 
-	account, err := controller.service.GetAccount(id)
+	account, err := controller.service.GetAccount(id, guards.Actor(request))
 	if err != nil {
 		return err
 	}
@@ -99,7 +134,7 @@ func (controller *AccountsController) GetPassphrase(
 		)
 	}
 
-	passphrase, err := controller.service.GetPassphrase(id)
+	passphrase, err := controller.service.GetPassphrase(id, guards.Actor(request))
 	if err != nil {
 		return err
 	}
@@ -107,6 +142,94 @@ func (controller *AccountsController) GetPassphrase(
 	return json.NewEncoder(writer).Encode(passphrase)
 }
 
+func (controller *AccountsController) GetTotp(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id := chi.URLParam(request, "id")
+	if id == "" {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Account ID is required",
+			nil,
+		)
+	}
+
+	totp, err := controller.service.GetTotp(id, guards.Actor(request))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(totp)
+}
+
+func (controller *AccountsController) GetHistory(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id := chi.URLParam(request, "id")
+	if id == "" {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Account ID is required",
+			nil,
+		)
+	}
+
+	history, err := controller.service.GetHistory(id)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(history)
+}
+
+func (controller *AccountsController) GetHistoryPassphrase(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id := chi.URLParam(request, "id")
+	entryId := chi.URLParam(request, "entryId")
+	if id == "" || entryId == "" {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Account ID and history entry ID are required",
+			nil,
+		)
+	}
+
+	passphrase, err := controller.service.GetHistoryPassphrase(id, entryId, guards.Actor(request))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(passphrase)
+}
+
+func (controller *AccountsController) RestoreHistory(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id := chi.URLParam(request, "id")
+	entryId := chi.URLParam(request, "entryId")
+	if id == "" || entryId == "" {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Account ID and history entry ID are required",
+			nil,
+		)
+	}
+
+	warnings, err := controller.service.RestoreHistory(id, entryId, guards.Actor(request))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(&schemas.ResponseAccountUpdate{
+		Warnings: warnings,
+	})
+}
+
 func (controller *AccountsController) CreateAccount(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -128,7 +251,7 @@ func (controller *AccountsController) CreateAccount(
 		)
 	}
 
-	account, err := controller.service.CreateAccount(body)
+	account, err := controller.service.CreateAccount(body, guards.Actor(request))
 	if err != nil {
 		return err
 	}
@@ -167,13 +290,15 @@ func (controller *AccountsController) UpdateAccount(
 		)
 	}
 
-	err := controller.service.UpdateAccount(id, body)
+	// The passphrase is saved even when it breaks the policy of the account
+	warnings, err := controller.service.UpdateAccount(id, body, guards.Actor(request))
 	if err != nil {
 		return err
 	}
 
-	writer.WriteHeader(http.StatusNoContent)
-	return nil
+	return json.NewEncoder(writer).Encode(&schemas.ResponseAccountUpdate{
+		Warnings: warnings,
+	})
 }
 
 func (controller *AccountsController) DeleteAccount(
@@ -189,7 +314,7 @@ func (controller *AccountsController) DeleteAccount(
 		)
 	}
 
-	err := controller.service.DeleteAccount(id)
+	err := controller.service.DeleteAccount(id, guards.Actor(request))
 	if err != nil {
 		return err
 	}
@@ -197,3 +322,37 @@ func (controller *AccountsController) DeleteAccount(
 	writer.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// Checks every passphrase against known breaches now
+func (controller *AccountsController) CheckBreaches(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	result, err := controller.breachService.Check("")
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(result)
+}
+
+func (controller *AccountsController) CheckAccountBreaches(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id := chi.URLParam(request, "id")
+	if id == "" {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Account ID is required",
+			nil,
+		)
+	}
+
+	result, err := controller.breachService.Check(id)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(result)
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type AuditController struct {
+	service     *services.AuditService
+	auditRouter *router.Router
+}
+
+func NewAuditController() *AuditController {
+	return &AuditController{
+		service:     services.NewAuditService(),
+		auditRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// The audit log is read from a login session only
+func (controller *AuditController) MountAuditRouter(router *chi.Mux) {
+	controller.auditRouter.Mux().Use(guards.JWTGuard)
+
+	controller.auditRouter.Get("/", controller.GetAuditEvents)
+	controller.auditRouter.Get("/verify", controller.VerifyAuditLog)
+
+	router.Mount("/audit", controller.auditRouter.Mux())
+}
+
+func (controller *AuditController) GetAuditEvents(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	filter, err := parseAuditFilter(request.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	events, err := controller.service.List(filter)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(events)
+}
+
+func (controller *AuditController) VerifyAuditLog(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	verification, err := controller.service.Verify()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(verification)
+}
+
+// since and until are RFC 3339 timestamps, limit and offset page the results
+func parseAuditFilter(query url.Values) (*models.AuditFilter, error) {
+	filter := &models.AuditFilter{
+		Event:     query.Get("event"),
+		AccountId: query.Get("account"),
+	}
+
+	for name, target := range map[string]*time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Invalid "+name+", expected an RFC 3339 timestamp",
+				err,
+			)
+		}
+		*target = parsed
+	}
+
+	for name, target := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Invalid "+name,
+				err,
+			)
+		}
+		*target = parsed
+	}
+
+	return filter, nil
+}
@@ -7,6 +7,7 @@ import (
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/client"
 	"passenger-go/backend/utilities/router"
 
 	"github.com/go-chi/chi"
@@ -14,18 +15,26 @@ import (
 )
 
 type AuthController struct {
-	publicRouter  *router.Router
-	privateRouter *router.Router
-	authService   *services.AuthService
-	validator     *validator.Validate
+	publicRouter    *router.Router
+	privateRouter   *router.Router
+	twoFactorRouter *router.Router
+	recoveryRouter  *router.Router
+	sudoRouter      *router.Router
+	authService     *services.AuthService
+	throttleService *services.ThrottleService
+	validator       *validator.Validate
 }
 
 func NewAuthController() *AuthController {
 	return &AuthController{
-		validator:     pipes.GetValidator(),
-		authService:   services.NewAuthService(),
-		publicRouter:  router.NewRouter(chi.NewRouter()),
-		privateRouter: router.NewRouter(chi.NewRouter()),
+		validator:       pipes.GetValidator(),
+		authService:     services.NewAuthService(),
+		throttleService: services.NewThrottleService(),
+		publicRouter:    router.NewRouter(chi.NewRouter()),
+		privateRouter:   router.NewRouter(chi.NewRouter()),
+		twoFactorRouter: router.NewRouter(chi.NewRouter()),
+		recoveryRouter:  router.NewRouter(chi.NewRouter()),
+		sudoRouter:      router.NewRouter(chi.NewRouter()),
 	}
 }
 
@@ -35,14 +44,30 @@ func (controller *AuthController) MountAuthRouter(router *chi.Mux) {
 	controller.publicRouter.Post("/register", controller.RegisterUser)
 	controller.publicRouter.Post("/validate", controller.CompleteRegistration)
 	controller.publicRouter.Post("/login", controller.LoginUser)
+	controller.publicRouter.Post("/login/totp", controller.CompleteLogin)
 
 	// Protected routes with JWT guard
-	controller.privateRouter.Mux().Use(guards.JWTGuard)
+	controller.privateRouter.Mux().Use(guards.JWTGuard, guards.SudoGuard)
 	controller.privateRouter.Patch("/", controller.UpdatePassphrase)
 
-	// Mount both routers to the same path
+	controller.twoFactorRouter.Mux().Use(guards.JWTGuard)
+	controller.twoFactorRouter.Get("/", controller.TwoFactorStatus)
+	controller.twoFactorRouter.Post("/enroll", controller.EnrollTwoFactor)
+	controller.twoFactorRouter.Post("/confirm", controller.ConfirmTwoFactor)
+	controller.twoFactorRouter.Delete("/", controller.DisableTwoFactor)
+
+	controller.recoveryRouter.Mux().Use(guards.JWTGuard)
+	controller.recoveryRouter.Post("/", controller.RegenerateRecoveryKey)
+
+	controller.sudoRouter.Mux().Use(guards.JWTGuard)
+	controller.sudoRouter.Post("/", controller.Reauthenticate)
+
+	// Mount the routers to the same path
 	router.Mount("/auth", controller.publicRouter.Mux())
 	router.Mount("/auth/passphrase", controller.privateRouter.Mux())
+	router.Mount("/auth/2fa", controller.twoFactorRouter.Mux())
+	router.Mount("/auth/recovery", controller.recoveryRouter.Mux())
+	router.Mount("/auth/reauthenticate", controller.sudoRouter.Mux())
 }
 
 func (controller *AuthController) Status(
@@ -116,7 +141,13 @@ func (controller *AuthController) CompleteRegistration(
 		)
 	}
 
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleValidate); err != nil {
+		return err
+	}
+
 	err = controller.authService.CompleteRegistration(body.Recovery)
+	controller.throttleService.Record(address, services.ThrottleValidate, err)
 	if err != nil {
 		return err
 	}
@@ -145,7 +176,50 @@ func (controller *AuthController) LoginUser(
 		)
 	}
 
-	token, err := controller.authService.LoginUser(body.Passphrase)
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleLogin); err != nil {
+		return err
+	}
+
+	login, err := controller.authService.LoginUser(body.Passphrase, client.Device(request))
+	controller.throttleService.Record(address, services.ThrottleLogin, err)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(writer).Encode(login)
+
+	return nil
+}
+
+func (controller *AuthController) CompleteLogin(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	body := &schemas.RequestAuthLoginTwoFactor{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleLoginTwoFactor); err != nil {
+		return err
+	}
+
+	token, err := controller.authService.CompleteLogin(body.Challenge, body.Code, client.Device(request))
+	controller.throttleService.Record(address, services.ThrottleLoginTwoFactor, err)
 	if err != nil {
 		return err
 	}
@@ -178,10 +252,167 @@ func (controller *AuthController) UpdatePassphrase(
 		)
 	}
 
-	err = controller.authService.UpdatePassphrase(body.Passphrase)
+	err = controller.authService.UpdatePassphrase(body.Passphrase, guards.Actor(request))
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (controller *AuthController) RegenerateRecoveryKey(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	body := &schemas.RequestAuthRegenerateRecovery{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleRecoveryKey); err != nil {
+		return err
+	}
+
+	recovery, err := controller.authService.RegenerateRecoveryKey(body.Passphrase)
+	controller.throttleService.Record(address, services.ThrottleRecoveryKey, err)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(schemas.ResponseAuthRecoveryKey{
+		Recovery: recovery,
+	})
+}
+
+// Puts the session in sudo mode for the sensitive operations
+func (controller *AuthController) Reauthenticate(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	body := &schemas.RequestAuthReauthenticate{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleReauthenticate); err != nil {
+		return err
+	}
+
+	response, err := controller.authService.Reauthenticate(guards.SessionId(request), body.Passphrase)
+	controller.throttleService.Record(address, services.ThrottleReauthenticate, err)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(response)
+}
+
+func (controller *AuthController) TwoFactorStatus(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	status, err := controller.authService.TwoFactorStatus()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(status)
+}
+
+func (controller *AuthController) EnrollTwoFactor(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	enrollment, err := controller.authService.EnrollTwoFactor()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(enrollment)
+}
+
+func (controller *AuthController) ConfirmTwoFactor(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	body := &schemas.RequestTwoFactorConfirm{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	recoveryCodes, err := controller.authService.ConfirmTwoFactor(body.Code)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(recoveryCodes)
+}
+
+func (controller *AuthController) DisableTwoFactor(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (err error) {
+	body := &schemas.RequestTwoFactorDisable{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleTwoFactorOff); err != nil {
+		return err
+	}
+
+	err = controller.authService.DisableTwoFactor(body.Passphrase)
+	controller.throttleService.Record(address, services.ThrottleTwoFactorOff, err)
+	return err
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+)
+
+type BackupController struct {
+	validator    *validator.Validate
+	service      *services.BackupService
+	backupRouter *router.Router
+}
+
+func NewBackupController() *BackupController {
+	return &BackupController{
+		validator:    pipes.GetValidator(),
+		service:      services.NewBackupService(),
+		backupRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// Backups hold every passphrase and restoring can replace the vault, so both need sudo mode
+func (controller *BackupController) MountBackupRouter(router *chi.Mux) {
+	controller.backupRouter.Mux().Use(guards.ScopeGuard(models.ScopeTransfer), guards.SudoGuard)
+
+	controller.backupRouter.Post("/", controller.CreateBackup)
+	controller.backupRouter.Post("/restore", controller.RestoreBackup)
+
+	router.Mount("/backup", controller.backupRouter.Mux())
+}
+
+func (controller *BackupController) CreateBackup(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	body := &schemas.RequestBackupCreate{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	backup, err := controller.service.Create(body.Passphrase, guards.Actor(request))
+	if err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Disposition", "attachment; filename="+services.BackupFilename(time.Now()))
+	writer.Write(backup)
+
+	return nil
+}
+
+/*
+A multipart form is required:
+- file: the .passenger file
+- passphrase: the passphrase of the backup
+- mode: merge or replace
+*/
+func (controller *BackupController) RestoreBackup(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	request.Body = http.MaxBytesReader(writer, request.Body, services.BackupMaxSize)
+
+	body := &schemas.RequestBackupRestore{
+		Passphrase: request.FormValue("passphrase"),
+		Mode:       request.FormValue("mode"),
+	}
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	file, _, err := request.FormFile("file")
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"A backup file is required",
+			err,
+		)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Failed to read the backup file",
+			err,
+		)
+	}
+
+	result, err := controller.service.Restore(content, body.Passphrase, body.Mode, guards.Actor(request))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(result)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+
+	"github.com/go-chi/chi"
+)
+
+type BreachesController struct {
+	service        *services.BreachService
+	breachesRouter *router.Router
+}
+
+func NewBreachesController() *BreachesController {
+	return &BreachesController{
+		service:        services.NewBreachService(),
+		breachesRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// The local dataset is managed from a login session only
+func (controller *BreachesController) MountBreachesRouter(router *chi.Mux) {
+	controller.breachesRouter.Mux().Use(guards.JWTGuard)
+
+	controller.breachesRouter.Get("/dataset", controller.GetDataset)
+	controller.breachesRouter.Put("/dataset", controller.ImportDataset)
+
+	router.Mount("/breaches", controller.breachesRouter.Mux())
+}
+
+func (controller *BreachesController) GetDataset(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	dataset, err := controller.service.GetDataset()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(dataset)
+}
+
+// The body is the dataset itself, which may be too large for a form upload
+func (controller *BreachesController) ImportDataset(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	request.Body = http.MaxBytesReader(writer, request.Body, services.BreachDatasetMaxSize)
+
+	dataset, err := controller.service.ImportDataset(request.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return schemas.NewAPIError(
+			schemas.ErrPayloadTooLarge,
+			"The dataset is too large",
+			err,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(dataset)
+}
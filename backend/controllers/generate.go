@@ -3,33 +3,46 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/generator"
 	"passenger-go/backend/utilities/router"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi"
 	"github.com/go-playground/validator/v10"
 )
 
 type GenerateController struct {
-	service   *services.GenerateService
-	validator *validator.Validate
-	router    *router.Router
+	service         *services.GenerateService
+	policiesService *services.PoliciesService
+	validator       *validator.Validate
+	router          *router.Router
 }
 
 func NewGenerateController() *GenerateController {
 	return &GenerateController{
-		service:   services.NewGenerateService(),
-		validator: pipes.GetValidator(),
-		router:    router.NewRouter(chi.NewRouter()),
+		service:         services.NewGenerateService(),
+		policiesService: services.NewPoliciesService(),
+		validator:       pipes.GetValidator(),
+		router:          router.NewRouter(chi.NewRouter()),
 	}
 }
 
 func (controller *GenerateController) MountGenerateRouter(router *chi.Mux) {
+	controller.router.Mux().Use(guards.ScopeGuard(models.ScopeGenerate))
+
 	controller.router.Get("/new", controller.GeneratePassphrase)
+	controller.router.Get("/wordlists", controller.GetWordlists)
 	controller.router.Post("/alternative", controller.AlternatePassphrase)
+	controller.router.Post("/strength", controller.EstimateStrength)
 
 	router.Mount("/generate", controller.router.Mux())
 }
@@ -38,33 +51,166 @@ func (controller *GenerateController) GeneratePassphrase(
 	writer http.ResponseWriter,
 	request *http.Request,
 ) error {
-	length := request.URL.Query().Get("length")
+	// The policy of an account or of a named profile
+	query := request.URL.Query()
+	rules, err := controller.policiesService.Resolve(query.Get("account"), query.Get("profile"))
+	if err != nil {
+		return err
+	}
 
-	if length == "" {
-		length = "32"
+	switch query.Get("mode") {
+	case "", services.GenerateModeChars:
+	case services.GenerateModeWords:
+		if rules != nil {
+			return schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Word passphrases can't follow a policy, use chars",
+				nil,
+			)
+		}
+		return controller.generateWords(writer, request)
+	default:
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Invalid mode, use chars or words",
+			nil,
+		)
 	}
 
-	lengthInt, err := strconv.Atoi(length)
+	policy, err := parseGeneratePolicy(query)
 	if err != nil {
+		return err
+	}
+
+	var response *schemas.ResponseGenerate
+	if rules != nil {
+		response, err = controller.service.GenerateWithPolicy(policy, rules)
+	} else {
+		response, err = controller.service.Generate(policy)
+	}
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(writer).Encode(response)
+	return nil
+}
+
+// Longest prefix, pattern or symbol alphabet accepted
+const maxGeneratePolicyText = 256
+
+func parseGeneratePolicy(query url.Values) (*schemas.GeneratePolicy, error) {
+	policy := &schemas.GeneratePolicy{
+		Symbols:   query.Get("symbols"),
+		Forbidden: query.Get("forbidden"),
+		Prefix:    query.Get("prefix"),
+		Pattern:   query.Get("pattern"),
+	}
+
+	for _, text := range []string{policy.Symbols, policy.Forbidden, policy.Prefix, policy.Pattern} {
+		if utf8.RuneCountInString(text) > maxGeneratePolicyText {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"The symbols, forbidden characters, prefix and pattern can be at most 256 characters",
+				nil,
+			)
+		}
+	}
+
+	if length := query.Get("length"); length != "" {
+		lengthInt, err := strconv.Atoi(length)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidLength,
+				"Invalid length",
+				err,
+			)
+		}
+		policy.Length = lengthInt
+	}
+
+	if sets := query.Get("sets"); sets != "" {
+		for _, name := range strings.Split(sets, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !slices.Contains(policy.Sets, name) {
+				policy.Sets = append(policy.Sets, name)
+			}
+		}
+	}
+
+	// Without any minimum, every allowed set needs one character
+	for _, name := range generator.CharacterSets {
+		parameter := "min" + strings.ToUpper(name[:1]) + name[1:]
+		value := query.Get(parameter)
+		if value == "" {
+			continue
+		}
+
+		minimum, err := strconv.Atoi(value)
+		if err != nil || minimum < 0 {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidLength,
+				"Invalid "+parameter,
+				err,
+			)
+		}
+
+		if policy.Minimums == nil {
+			policy.Minimums = map[string]int{}
+		}
+		policy.Minimums[name] = minimum
+	}
+
+	if value := query.Get("excludeAmbiguous"); value != "" {
+		excludeAmbiguous, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Invalid excludeAmbiguous",
+				err,
+			)
+		}
+		policy.ExcludeAmbiguous = excludeAmbiguous
+	}
+
+	return policy, nil
+}
+
+func (controller *GenerateController) AlternatePassphrase(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	body := &schemas.RequestAlternate{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
 		return schemas.NewAPIError(
-			schemas.ErrInvalidLength,
-			"Invalid length",
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
 			err,
 		)
 	}
 
-	json.NewEncoder(writer).Encode(
-		controller.service.Generate(lengthInt),
-	)
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	response, err := controller.service.Alternate(body.Passphrase)
+	if err != nil {
+		return err
+	}
 
+	json.NewEncoder(writer).Encode(response)
 	return nil
 }
 
-func (controller *GenerateController) AlternatePassphrase(
+func (controller *GenerateController) EstimateStrength(
 	writer http.ResponseWriter,
 	request *http.Request,
 ) error {
-	body := &schemas.RequestAlternate{}
+	body := &schemas.RequestStrength{}
 	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
 		return schemas.NewAPIError(
 			schemas.ErrUnprocessableEntity,
@@ -82,7 +228,108 @@ func (controller *GenerateController) AlternatePassphrase(
 	}
 
 	json.NewEncoder(writer).Encode(
-		controller.service.Alternate(body.Passphrase),
+		controller.service.Strength(body),
+	)
+
+	return nil
+}
+
+const (
+	defaultGenerateWords = 6
+	maxGenerateSeparator = 8
+)
+
+func (controller *GenerateController) generateWords(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	query := request.URL.Query()
+	words, err := parseGenerateCount(query.Get("words"), "words", defaultGenerateWords, 3, 20)
+	if err != nil {
+		return err
+	}
+
+	digits, err := parseGenerateCount(query.Get("digits"), "digits", 0, 0, 10)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := parseGenerateCount(query.Get("symbols"), "symbols", 0, 0, 10)
+	if err != nil {
+		return err
+	}
+
+	options := generator.WordOptions{
+		Words:      words,
+		Separator:  "-",
+		Capitalize: generator.CapitalizeNone,
+		Digits:     digits,
+		Symbols:    symbols,
+	}
+
+	// An empty separator joins the words
+	if query.Has("separator") {
+		options.Separator = query.Get("separator")
+		if utf8.RuneCountInString(options.Separator) > maxGenerateSeparator {
+			return schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"The separator can be at most 8 characters",
+				nil,
+			)
+		}
+	}
+
+	if capitalize := query.Get("capitalize"); capitalize != "" {
+		switch capitalize {
+		case generator.CapitalizeNone, generator.CapitalizeFirst, generator.CapitalizeAll, generator.CapitalizeRandom:
+			options.Capitalize = capitalize
+		default:
+			return schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Invalid capitalize, use none, first, all or random",
+				nil,
+			)
+		}
+	}
+
+	wordlist := query.Get("wordlist")
+	if wordlist == "" {
+		wordlist = generator.WordlistEff
+	}
+
+	response, err := controller.service.GenerateWords(wordlist, options)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(writer).Encode(response)
+	return nil
+}
+
+// Counts out of range are clamped, like the length of generated passphrases
+func parseGenerateCount(value string, name string, fallback int, lowest int, highest int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrInvalidLength,
+			"Invalid "+name,
+			err,
+		)
+	}
+
+	return min(max(number, lowest), highest), nil
+}
+
+func (controller *GenerateController) GetWordlists(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	json.NewEncoder(writer).Encode(
+		controller.service.GetWordlists(),
 	)
 
 	return nil
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+)
+
+type PoliciesController struct {
+	validator      *validator.Validate
+	service        *services.PoliciesService
+	policiesRouter *router.Router
+}
+
+func NewPoliciesController() *PoliciesController {
+	return &PoliciesController{
+		validator:      pipes.GetValidator(),
+		service:        services.NewPoliciesService(),
+		policiesRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// Profiles are shared by accounts, so they need the same scopes
+func (controller *PoliciesController) MountPoliciesRouter(router *chi.Mux) {
+	reader := controller.policiesRouter.With(guards.ScopeGuard(models.ScopeAccountsRead))
+	writer := controller.policiesRouter.With(guards.ScopeGuard(models.ScopeAccountsWrite))
+
+	reader.Get("/", controller.GetProfiles)
+	reader.Get("/{name}", controller.GetProfile)
+	writer.Put("/{name}", controller.SaveProfile)
+	writer.Delete("/{name}", controller.DeleteProfile)
+
+	router.Mount("/policies", controller.policiesRouter.Mux())
+}
+
+func (controller *PoliciesController) GetProfiles(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	profiles, err := controller.service.GetProfiles()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(profiles)
+}
+
+func (controller *PoliciesController) GetProfile(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	profile, err := controller.service.GetProfile(chi.URLParam(request, "name"))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(profile)
+}
+
+// Creates the profile or replaces its rules
+func (controller *PoliciesController) SaveProfile(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	body := &schemas.PassphrasePolicy{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	profile, err := controller.service.SaveProfile(chi.URLParam(request, "name"), body)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(profile)
+}
+
+// Profiles still used by accounts are kept
+func (controller *PoliciesController) DeleteProfile(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	err := controller.service.DeleteProfile(chi.URLParam(request, "name"))
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
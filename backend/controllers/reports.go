@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type ReportsController struct {
+	service       *services.ReportsService
+	reportsRouter *router.Router
+}
+
+func NewReportsController() *ReportsController {
+	return &ReportsController{
+		service:       services.NewReportsService(),
+		reportsRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// Reports describe accounts without revealing them, so reading accounts is enough
+func (controller *ReportsController) MountReportsRouter(router *chi.Mux) {
+	reader := controller.reportsRouter.With(guards.ScopeGuard(models.ScopeAccountsRead))
+
+	reader.Get("/security", controller.GetSecurityReport)
+
+	router.Mount("/reports", controller.reportsRouter.Mux())
+}
+
+func (controller *ReportsController) GetSecurityReport(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	maxAgeDays, err := parseMaxAgeDays(request.URL.Query().Get("maxAgeDays"))
+	if err != nil {
+		return err
+	}
+
+	report, err := controller.service.Security(maxAgeDays)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(report)
+}
+
+// An empty value is the default age
+func parseMaxAgeDays(value string) (int, error) {
+	if value == "" {
+		return services.DefaultReportMaxAgeDays, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Invalid maxAgeDays, expected a positive number of days",
+			err,
+		)
+	}
+
+	return days, nil
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+)
+
+type SessionsController struct {
+	validator      *validator.Validate
+	service        *services.SessionsService
+	sessionsRouter *router.Router
+}
+
+func NewSessionsController() *SessionsController {
+	return &SessionsController{
+		validator:      pipes.GetValidator(),
+		service:        services.NewSessionsService(),
+		sessionsRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+func (controller *SessionsController) MountSessionsRouter(router *chi.Mux) {
+	controller.sessionsRouter.Mux().Use(guards.JWTGuard)
+
+	controller.sessionsRouter.Get("/", controller.GetSessions)
+	controller.sessionsRouter.Delete("/", controller.RevokeOtherSessions)
+	controller.sessionsRouter.Patch("/{id}", controller.RenameSession)
+	controller.sessionsRouter.Delete("/{id}", controller.RevokeSession)
+
+	router.Mount("/sessions", controller.sessionsRouter.Mux())
+}
+
+func (controller *SessionsController) GetSessions(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	sessions, err := controller.service.List(guards.SessionId(request))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(sessions)
+}
+
+// Revokes every session except the one making the request
+func (controller *SessionsController) RevokeOtherSessions(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	err := controller.service.RevokeOthers(guards.SessionId(request))
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (controller *SessionsController) RenameSession(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	body := &schemas.RequestSessionRename{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	err := controller.service.Rename(chi.URLParam(request, "id"), body.Name)
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Revoking the current session logs it out
+func (controller *SessionsController) RevokeSession(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	err := controller.service.Revoke(chi.URLParam(request, "id"))
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+)
+
+type TokensController struct {
+	validator    *validator.Validate
+	service      *services.TokensService
+	tokensRouter *router.Router
+}
+
+func NewTokensController() *TokensController {
+	return &TokensController{
+		validator:    pipes.GetValidator(),
+		service:      services.NewTokensService(),
+		tokensRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+// Tokens are managed from a login session, a token cannot create or revoke tokens
+func (controller *TokensController) MountTokensRouter(router *chi.Mux) {
+	controller.tokensRouter.Mux().Use(guards.JWTGuard)
+
+	controller.tokensRouter.Get("/", controller.GetTokens)
+	controller.tokensRouter.With(guards.SudoGuard).Post("/", controller.CreateToken)
+	controller.tokensRouter.Patch("/{id}", controller.RenameToken)
+	controller.tokensRouter.Delete("/{id}", controller.RevokeToken)
+
+	router.Mount("/tokens", controller.tokensRouter.Mux())
+}
+
+func (controller *TokensController) GetTokens(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	tokens, err := controller.service.List()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(tokens)
+}
+
+// The response holds the token, it cannot be retrieved again
+func (controller *TokensController) CreateToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	body := &schemas.RequestTokenCreate{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	token, err := controller.service.Create(body.Label, body.Scopes)
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(writer).Encode(token)
+}
+
+func (controller *TokensController) RenameToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id, err := tokenId(request)
+	if err != nil {
+		return err
+	}
+
+	body := &schemas.RequestTokenRename{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrUnprocessableEntity,
+			"Invalid request body",
+			err,
+		)
+	}
+
+	if err := controller.validator.Struct(body); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate request body",
+			err,
+		)
+	}
+
+	if err := controller.service.Rename(id, body.Label); err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (controller *TokensController) RevokeToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	id, err := tokenId(request)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.service.Revoke(id); err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func tokenId(request *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Invalid token id",
+			err,
+		)
+	}
+	return id, nil
+}
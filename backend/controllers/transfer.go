@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
@@ -29,10 +30,11 @@ func NewTransferController() *TransferController {
 }
 
 func (controller *TransferController) MountTransferRouter(router *chi.Mux) {
-	controller.transferRouter.Mux().Use(guards.JWTGuard)
+	controller.transferRouter.Mux().Use(guards.ScopeGuard(models.ScopeTransfer))
 
 	controller.transferRouter.Post("/import", controller.Import)
-	controller.transferRouter.Post("/export", controller.Export)
+	// The export holds every passphrase in clear text
+	controller.transferRouter.With(guards.SudoGuard).Post("/export", controller.Export)
 
 	router.Mount("/transfer", controller.transferRouter.Mux())
 }
@@ -43,6 +45,8 @@ A csv file is required.
 Supported platforms:
 - Firefox (UTF-8 CRLF double quotes comma separated)
 - Chromium (UTF-8 LF no quotes comma separated)
+- Bitwarden (UTF-8 LF double quotes comma separated, with TOTP)
+- Passenger (UTF-8 LF double quotes comma separated, with TOTP)
 */
 func (controller *TransferController) Import(
 	writer http.ResponseWriter,
@@ -65,7 +69,7 @@ func (controller *TransferController) Import(
 	if platform.Fields == nil {
 		return schemas.NewAPIError(
 			schemas.ErrInvalidPlatform,
-			"The uploaded file format is not supported. Please use Firefox or Chromium export format.",
+			"The uploaded file format is not supported. Please use a Firefox, Chromium, Bitwarden or Passenger export.",
 			nil,
 		)
 	}
@@ -92,7 +96,7 @@ func (controller *TransferController) Import(
 		)
 	}
 
-	importResult, err := controller.service.Import(accounts)
+	importResult, err := controller.service.Import(accounts, guards.Actor(request))
 	if err != nil {
 		return err
 	}
@@ -106,7 +110,7 @@ func (controller *TransferController) Export(
 	writer http.ResponseWriter,
 	request *http.Request,
 ) error {
-	csv, err := controller.service.Export()
+	csv, err := controller.service.Export(guards.Actor(request))
 	if err != nil {
 		return err
 	}
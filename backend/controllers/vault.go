@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/router"
+
+	"github.com/go-chi/chi"
+)
+
+type VaultController struct {
+	service     *services.VaultService
+	vaultRouter *router.Router
+}
+
+func NewVaultController() *VaultController {
+	return &VaultController{
+		service:     services.NewVaultService(),
+		vaultRouter: router.NewRouter(chi.NewRouter()),
+	}
+}
+
+func (controller *VaultController) MountVaultRouter(router *chi.Mux) {
+	controller.vaultRouter.Mux().Use(guards.JWTGuard)
+
+	controller.vaultRouter.Get("/keys", controller.GetKeys)
+	controller.vaultRouter.Get("/rotate", controller.GetRotationStatus)
+	controller.vaultRouter.Post("/rotate", controller.StartRotation)
+
+	router.Mount("/vault", controller.vaultRouter.Mux())
+}
+
+func (controller *VaultController) GetKeys(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	keys, err := controller.service.GetKeys()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(writer).Encode(keys)
+}
+
+func (controller *VaultController) GetRotationStatus(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	return json.NewEncoder(writer).Encode(controller.service.RotationStatus())
+}
+
+func (controller *VaultController) StartRotation(
+	writer http.ResponseWriter,
+	request *http.Request,
+) error {
+	status, err := controller.service.StartRotation()
+	if err != nil {
+		return err
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(writer).Encode(status)
+}
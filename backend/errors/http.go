@@ -4,17 +4,35 @@ import (
 	"encoding/json"
 	"net/http"
 	"passenger-go/backend/schemas"
+	"strconv"
 )
 
 var httpErrorMapping = map[schemas.APIErrorCode]int{
 	schemas.ErrInvalidRequest:           400,
 	schemas.ErrInvalidCredentials:       401,
+	schemas.ErrInsufficientScope:        403,
+	schemas.ErrReauthenticationRequired: 403,
 	schemas.ErrAccountNotFound:          404,
+	schemas.ErrTotpNotFound:             404,
+	schemas.ErrSessionNotFound:          404,
+	schemas.ErrTokenNotFound:            404,
+	schemas.ErrPolicyNotFound:           404,
+	schemas.ErrHistoryNotFound:          404,
 	schemas.ErrAlreadyInitialized:       409,
 	schemas.ErrAccountAlreadyExists:     409,
 	schemas.ErrAnotherAccountFound:      409,
+	schemas.ErrRotationInProgress:       409,
+	schemas.ErrTwoFactorAlreadyEnabled:  409,
+	schemas.ErrTwoFactorNotEnabled:      409,
+	schemas.ErrTotpCounterChanged:       409,
+	schemas.ErrBreachCheckDisabled:      409,
+	schemas.ErrPolicyInUse:              409,
 	schemas.ErrNotInitializedYet:        412,
+	schemas.ErrVaultLocked:              423,
+	schemas.ErrPayloadTooLarge:          413,
 	schemas.ErrUnprocessableEntity:      422,
+	schemas.ErrInvalidBackup:            422,
+	schemas.ErrTooManyAttempts:          429,
 	schemas.ErrEncryptionFailed:         500,
 	schemas.ErrDecryptionFailed:         500,
 	schemas.ErrRecoveryGenerationFailed: 500,
@@ -39,6 +57,10 @@ func WriteHTTPError(writer http.ResponseWriter, err error) {
 		code = 500
 	}
 
+	if apiError.RetryAfter > 0 {
+		writer.Header().Set("Retry-After", strconv.Itoa(apiError.RetryAfter))
+	}
+
 	writer.WriteHeader(code)
 	json.NewEncoder(writer).Encode(apiError)
 }
@@ -1,64 +1,169 @@
 package guards
 
 import (
+	"context"
 	"net/http"
+	"passenger-go/backend/models"
 	"passenger-go/backend/schemas"
+	"passenger-go/backend/services"
 	"passenger-go/backend/utilities/api_error"
-	"passenger-go/backend/utilities/jwtoken"
+	"passenger-go/backend/utilities/client"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type contextKey string
+
+const (
+	sessionContextKey contextKey = "session"
+	tokenContextKey   contextKey = "token"
+	scopesContextKey  contextKey = "scopes"
+)
 
-	"github.com/golang-jwt/jwt/v5"
+// Created on first use, once the database is open
+var (
+	sessionsService = sync.OnceValue(services.NewSessionsService)
+	tokensService   = sync.OnceValue(services.NewTokensService)
 )
 
+// Only accepts login sessions, their JWT comes from the cookie or a Bearer header
 func JWTGuard(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authCookie, err := r.Cookie("token")
+		credential, err := readCredential(r)
 		if err != nil {
-			api_error.HandleAPIError(w, schemas.NewAPIError(
-				schemas.ErrInvalidCredentials,
-				"No authorization token provided",
-				nil,
-			))
+			api_error.HandleAPIError(w, err)
 			return
 		}
 
-		if authCookie.Value == "" {
+		if services.IsAccessToken(credential) {
 			api_error.HandleAPIError(w, schemas.NewAPIError(
-				schemas.ErrInvalidCredentials,
-				"No authorization token provided",
+				schemas.ErrInsufficientScope,
+				"Access tokens cannot be used here, please login",
 				nil,
 			))
 			return
 		}
 
-		token, err := jwt.Parse(authCookie.Value, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, schemas.NewAPIError(
-					schemas.ErrInvalidCredentials,
-					"Invalid token signing method",
+		// Revoked, expired and locked sessions are refused
+		sessionId, err := sessionsService().Authenticate(credential)
+		if err != nil {
+			api_error.HandleAPIError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, WithSession(r, sessionId))
+	})
+}
+
+// Accepts login sessions, and personal access tokens that were granted the scope
+func ScopeGuard(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		sessionGuard := JWTGuard(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential, err := readCredential(r)
+			if err != nil {
+				api_error.HandleAPIError(w, err)
+				return
+			}
+
+			if !services.IsAccessToken(credential) {
+				sessionGuard.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := tokensService().Authenticate(credential)
+			if err != nil {
+				api_error.HandleAPIError(w, err)
+				return
+			}
+
+			if !token.HasScope(scope) {
+				api_error.HandleAPIError(w, schemas.NewAPIError(
+					schemas.ErrInsufficientScope,
+					"The access token is missing the "+scope+" scope",
 					nil,
-				)
+				))
+				return
 			}
-			return jwtoken.GetJWTSecret(), nil
+
+			ctx := context.WithValue(r.Context(), tokenContextKey, token.Id)
+			ctx = context.WithValue(ctx, scopesContextKey, token.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
+	}
+}
 
-		if err != nil {
-			api_error.HandleAPIError(w, schemas.NewAPIError(
-				schemas.ErrInvalidCredentials,
-				"Invalid or expired token",
-				err,
-			))
+// Runs after JWTGuard or ScopeGuard, sessions must have re-entered the passphrase recently.
+// Access tokens can't re-enter it, they need the export scope instead.
+func SudoGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if TokenId(r) != 0 {
+			scopes, _ := r.Context().Value(scopesContextKey).([]string)
+			if !slices.Contains(scopes, models.ScopeExport) {
+				api_error.HandleAPIError(w, schemas.NewAPIError(
+					schemas.ErrInsufficientScope,
+					"The access token is missing the "+models.ScopeExport+" scope",
+					nil,
+				))
+				return
+			}
+
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		if !token.Valid {
-			api_error.HandleAPIError(w, schemas.NewAPIError(
-				schemas.ErrInvalidCredentials,
-				"Invalid token",
-				nil,
-			))
+		if err := sessionsService().RequireReauthentication(SessionId(r)); err != nil {
+			api_error.HandleAPIError(w, err)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// The Authorization header wins over the cookie
+func readCredential(r *http.Request) (string, error) {
+	scheme, credential, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") && strings.TrimSpace(credential) != "" {
+		return strings.TrimSpace(credential), nil
+	}
+
+	authCookie, err := r.Cookie("token")
+	if err != nil || authCookie.Value == "" {
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"No authorization token provided",
+			nil,
+		)
+	}
+
+	return authCookie.Value, nil
+}
+
+// WithSession remembers the session that authenticated the request
+func WithSession(r *http.Request, sessionId string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey, sessionId))
+}
+
+// SessionId returns the session of an authenticated request, empty for access tokens
+func SessionId(r *http.Request) string {
+	sessionId, _ := r.Context().Value(sessionContextKey).(string)
+	return sessionId
+}
+
+// TokenId returns the access token of an authenticated request, zero for sessions
+func TokenId(r *http.Request) int {
+	tokenId, _ := r.Context().Value(tokenContextKey).(int)
+	return tokenId
+}
+
+// Actor describes who made the request, for the audit log
+func Actor(r *http.Request) *models.Actor {
+	return &models.Actor{
+		Address:   client.Address(r),
+		SessionId: SessionId(r),
+		TokenId:   TokenId(r),
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Failed authentication attempts of one client on one endpoint
+type Attempt struct {
+	Client      string
+	Endpoint    string
+	Failures    int
+	LockedUntil time.Time
+	LastAttempt time.Time
+}
+
+func (attempt *Attempt) Locked(at time.Time) bool {
+	return at.Before(attempt.LockedUntil)
+}
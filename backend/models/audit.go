@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+const (
+	AuditLoginSuccess     = "login.success"
+	AuditLoginFailure     = "login.failure"
+	AuditAccountReveal    = "account.reveal"
+	AuditAccountCreate    = "account.create"
+	AuditAccountUpdate    = "account.update"
+	AuditAccountDelete    = "account.delete"
+	AuditVaultImport      = "vault.import"
+	AuditVaultExport      = "vault.export"
+	AuditVaultBackup      = "vault.backup"
+	AuditVaultRestore     = "vault.restore"
+	AuditPassphraseChange = "passphrase.change"
+	AuditRecoverySuccess  = "recovery.success"
+	AuditRecoveryFailure  = "recovery.failure"
+)
+
+// Every event the audit log records, in the order they are documented
+var AuditEvents = []string{
+	AuditLoginSuccess,
+	AuditLoginFailure,
+	AuditAccountReveal,
+	AuditAccountCreate,
+	AuditAccountUpdate,
+	AuditAccountDelete,
+	AuditVaultImport,
+	AuditVaultExport,
+	AuditVaultBackup,
+	AuditVaultRestore,
+	AuditPassphraseChange,
+	AuditRecoverySuccess,
+	AuditRecoveryFailure,
+}
+
+// Who made a request: the client address and the session or access token it used
+type Actor struct {
+	Address   string
+	SessionId string
+	TokenId   int
+}
+
+// An entry of the audit log. Hash chains it to the previous entry.
+type AuditEvent struct {
+	Id        int64
+	CreatedAt time.Time
+	Event     string
+	AccountId string
+	Address   string
+	SessionId string
+	TokenId   int
+	Details   string
+	Hash      string
+}
+
+type AuditFilter struct {
+	// An event, or its prefix such as "login"
+	Event     string
+	AccountId string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
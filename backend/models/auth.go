@@ -5,4 +5,25 @@ type User struct {
 	Passphrase string
 	Recovery   string
 	Validated  bool
+	Keys       WrappedKeys
+	TwoFactor  TwoFactor
+}
+
+// The root key sealed by each key-encryption key, and the keyset sealed by the root key
+type WrappedKeys struct {
+	Passphrase  string
+	Recovery    string
+	Environment string
+	Keyset      string
+}
+
+// Secret is encrypted with the keyset, recovery codes are stored as hashes
+type TwoFactor struct {
+	Secret        string
+	RecoveryCodes string
+	LastStep      int64
+}
+
+func (twoFactor *TwoFactor) Enabled() bool {
+	return twoFactor.Secret != ""
 }
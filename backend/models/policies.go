@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// A named passphrase policy, accounts refer to it by name
+type PolicyProfile struct {
+	Name string
+	// The rules as JSON, they are not secret so they are stored in clear
+	Policy    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Number of accounts using the profile
+	Accounts int
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// A logged in device, its id is the sid claim of the JWT
+type Session struct {
+	Id         string
+	Name       string
+	UserAgent  string
+	Address    string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	// When the passphrase was last re-entered, zero if it never was
+	ReauthenticatedAt time.Time
+}
+
+// Where a login comes from, recorded on the session it opens
+type Device struct {
+	UserAgent string
+	Address   string
+}
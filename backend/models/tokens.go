@@ -0,0 +1,63 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	ScopeAccountsRead  = "accounts:read"
+	ScopeAccountsWrite = "accounts:write"
+	ScopeTransfer      = "transfer"
+	ScopeGenerate      = "generate"
+	// Stands in for sudo mode: exports and backups hand out the whole vault
+	ScopeExport = "export"
+)
+
+// Every scope a personal access token can be granted
+var Scopes = []string{
+	ScopeAccountsRead,
+	ScopeAccountsWrite,
+	ScopeTransfer,
+	ScopeGenerate,
+	ScopeExport,
+}
+
+// The scopes that read or write the vault, only tokens granted one of them can unlock it
+var VaultScopes = []string{
+	ScopeAccountsRead,
+	ScopeAccountsWrite,
+	ScopeTransfer,
+}
+
+// A personal access token for scripts and clients, the secret itself is never stored
+type AccessToken struct {
+	Id    int
+	Label string
+	// The first characters of the secret, to tell tokens apart
+	Prefix string
+	Hash   string
+	Scopes []string
+	// The root key wrapped with the secret, so the token can unlock the vault.
+	// Empty when none of the scopes need the vault.
+	WrappedKey string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func (token *AccessToken) HasScope(scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
+
+func (token *AccessToken) NeedsVault() bool {
+	return NeedsVault(token.Scopes)
+}
+
+func NeedsVault(scopes []string) bool {
+	for _, scope := range VaultScopes {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
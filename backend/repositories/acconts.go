@@ -6,6 +6,7 @@ import (
 	"passenger-go/backend/utilities/database"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type AccountsRepository struct {
@@ -24,6 +25,47 @@ type EncryptedAccountRow struct {
 	Url               string
 	Notes             string
 	EncryptedStrength string
+	Reprompt          bool
+	// Empty until the passphrase was checked against known breaches
+	EncryptedBreached string
+	// Zero without a rotation interval
+	RotationDays        int
+	PassphraseChangedAt time.Time
+}
+
+// The passphrase is bound to its row, so the id is needed to decrypt it
+type EncryptedPassphraseRow struct {
+	Id         string
+	Passphrase string
+}
+
+// The identifier is bound to its row, so the id is needed to decrypt it
+type EncryptedIdentifierRow struct {
+	Id         string
+	Identifier string
+}
+
+// Encrypted account fields with the blind indexes of the platform and identifier
+type EncryptedAccountUpsert struct {
+	schemas.RequestAccountsUpsert
+	PlatformIndex   string
+	IdentifierIndex string
+	// The breached flag was about the previous passphrase, it is cleared when it changes
+	PassphraseChanged bool
+	// Zero keeps the stored time, the passphrase did not change
+	PassphraseChangedAt time.Time
+	// Version of the estimator that computed the strength
+	StrengthVersion int
+	// The policy of the account as encrypted JSON, empty without one
+	EncryptedPolicy string
+}
+
+// Everything the strength of an account is estimated from
+type EncryptedStrengthRow struct {
+	Id         string
+	Platform   string
+	Identifier string
+	Passphrase string
 }
 
 type EncryptedAccountDetailsRow struct {
@@ -34,9 +76,19 @@ type EncryptedAccountDetailsRow struct {
 	Passphrase        string
 	Notes             string
 	EncryptedStrength string
+	Totp              string
+	Reprompt          bool
+	EncryptedBreached string
+	EncryptedPolicy   string
+	PolicyProfile     string
+	RotationDays      int
+	// Zero for accounts saved before the times were tracked
+	PassphraseChangedAt time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
-func (repository *AccountsRepository) GetAccounts() ([]*schemas.ResponseAccount, error) {
+func (repository *AccountsRepository) GetAccountsWithEncryptedData() ([]*EncryptedAccountRow, error) {
 	statement, err := repository.database.Prepare(QueryAccounts)
 	if err != nil {
 		return nil, err
@@ -47,104 +99,62 @@ func (repository *AccountsRepository) GetAccounts() ([]*schemas.ResponseAccount,
 		return nil, err
 	}
 
-	accounts := []*schemas.ResponseAccount{}
-
-	for rows.Next() {
-		var row EncryptedAccountRow
-		err = rows.Scan(
-			&row.Id,
-			&row.Platform,
-			&row.Identifier,
-			&row.Url,
-			&row.Notes,
-			&row.EncryptedStrength,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		// Convert to ResponseAccount with encrypted data
-		// The service layer will decrypt these
-		account := &schemas.ResponseAccount{
-			Id:         row.Id,
-			Platform:   row.Platform,
-			Identifier: row.Identifier,
-			Url:        row.Url,
-			Notes:      row.Notes,
-			Strength:   0, // Will be set after decryption by service
-		}
-		accounts = append(accounts, account)
-	}
-
-	return accounts, nil
+	return scanEncryptedAccountRows(rows)
 }
 
-func (repository *AccountsRepository) GetAccountsWithEncryptedData() ([]*EncryptedAccountRow, error) {
-	statement, err := repository.database.Prepare(QueryAccounts)
+// Finds accounts by the blind indexes, an empty index matches everything
+func (repository *AccountsRepository) FindAccountsWithEncryptedData(
+	platformIndex string,
+	identifierIndex string,
+) ([]*EncryptedAccountRow, error) {
+	statement, err := repository.database.Prepare(QueryAccountsMatching)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := statement.Query()
+	rows, err := statement.Query(
+		platformIndex,
+		platformIndex,
+		identifierIndex,
+		identifierIndex,
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	return scanEncryptedAccountRows(rows)
+}
+
+func scanEncryptedAccountRows(rows *sql.Rows) ([]*EncryptedAccountRow, error) {
+	defer rows.Close()
+
 	accounts := []*EncryptedAccountRow{}
 
 	for rows.Next() {
 		var row EncryptedAccountRow
-		err = rows.Scan(
+		var passphraseChangedAt int64
+		err := rows.Scan(
 			&row.Id,
 			&row.Platform,
 			&row.Identifier,
 			&row.Url,
 			&row.Notes,
 			&row.EncryptedStrength,
+			&row.Reprompt,
+			&row.EncryptedBreached,
+			&row.RotationDays,
+			&passphraseChangedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		row.PassphraseChangedAt = unixTime(passphraseChangedAt)
 		accounts = append(accounts, &row)
 	}
 
 	return accounts, nil
 }
 
-func (repository *AccountsRepository) GetAccount(
-	id string,
-) (*schemas.ResponseAccountDetails, error) {
-	statement, err := repository.database.Prepare(QueryAccountDetails)
-	if err != nil {
-		return nil, err
-	}
-
-	var row EncryptedAccountDetailsRow
-	err = statement.QueryRow(id).Scan(
-		&row.Id,
-		&row.Platform,
-		&row.Identifier,
-		&row.Url,
-		&row.Passphrase,
-		&row.Notes,
-		&row.EncryptedStrength,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return with encrypted data - service layer will decrypt
-	return &schemas.ResponseAccountDetails{
-		Id:         row.Id,
-		Platform:   row.Platform,
-		Identifier: row.Identifier,
-		Url:        row.Url,
-		Passphrase: row.Passphrase,
-		Notes:      row.Notes,
-		Strength:   0, // Will be set after decryption by service
-	}, nil
-}
-
 func (repository *AccountsRepository) GetAccountWithEncryptedData(
 	id string,
 ) (*EncryptedAccountDetailsRow, error) {
@@ -154,6 +164,7 @@ func (repository *AccountsRepository) GetAccountWithEncryptedData(
 	}
 
 	var row EncryptedAccountDetailsRow
+	var times [3]int64
 	err = statement.QueryRow(id).Scan(
 		&row.Id,
 		&row.Platform,
@@ -162,10 +173,20 @@ func (repository *AccountsRepository) GetAccountWithEncryptedData(
 		&row.Passphrase,
 		&row.Notes,
 		&row.EncryptedStrength,
+		&row.Totp,
+		&row.Reprompt,
+		&row.EncryptedBreached,
+		&row.EncryptedPolicy,
+		&row.PolicyProfile,
+		&row.RotationDays,
+		&times[0],
+		&times[1],
+		&times[2],
 	)
 	if err != nil {
 		return nil, err
 	}
+	row.PassphraseChangedAt, row.CreatedAt, row.UpdatedAt = unixTime(times[0]), unixTime(times[1]), unixTime(times[2])
 
 	return &row, nil
 }
@@ -194,67 +215,158 @@ func (repository *AccountsRepository) GetPassphrase(
 	return passphrase, nil
 }
 
-func (repository *AccountsRepository) CreateAccount(
-	account *schemas.RequestAccountsUpsert,
-) (*schemas.ResponseAccountDetails, error) {
-	statement, err := repository.database.Prepare(QueryAccountCreate)
-	if err != nil {
-		return nil, err
-	}
+// Encrypts the account fields for the row with the given id
+type SealAccountFunc func(id string) (*EncryptedAccountUpsert, error)
 
-	result, err := statement.Exec(
+// Writes the fields of the account, the update time is kept by the repository
+func updateAccountRow(transaction *sql.Tx, id string, account *EncryptedAccountUpsert) error {
+	_, err := transaction.Exec(
+		QueryAccountUpdate,
 		account.Platform,
 		account.Identifier,
 		account.Passphrase,
 		account.Url,
 		account.Notes,
 		account.Strength, // This is the encrypted strength from service
+		account.StrengthVersion,
+		account.PlatformIndex,
+		account.IdentifierIndex,
+		account.Totp,
+		account.Reprompt,
+		account.PassphraseChanged,
+		account.EncryptedPolicy,
+		account.PolicyProfile,
+		account.RotationDays,
+		unixSeconds(time.Now()),
+		unixSeconds(account.PassphraseChangedAt),
+		id,
 	)
+	return err
+}
+
+// The row is inserted empty first, so its id is known when the fields are
+// encrypted. Both happen in a single transaction.
+func (repository *AccountsRepository) CreateAccount(
+	seal SealAccountFunc,
+) (string, error) {
+	transaction, err := repository.database.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer transaction.Rollback()
+
+	now := unixSeconds(time.Now())
+	result, err := transaction.Exec(QueryAccountCreate, now, now)
+	if err != nil {
+		return "", err
+	}
+
+	lastInsertedId, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(lastInsertedId, 10)
+
+	account, err := seal(id)
+	if err != nil {
+		return "", err
+	}
+
+	err = updateAccountRow(transaction, id, account)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return nil, schemas.NewAPIError(
+			return "", schemas.NewAPIError(
 				schemas.ErrAccountAlreadyExists,
 				"Account already exists",
 				nil,
 			)
 		}
-		return nil, err
+		return "", err
 	}
 
-	lastInsertedId, err := result.LastInsertId()
+	if err := transaction.Commit(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Inserts the accounts of a backup in a single transaction, replace deletes
+// every account first. Accounts that already exist are skipped.
+func (repository *AccountsRepository) RestoreAccounts(
+	replace bool,
+	seals []SealAccountFunc,
+) (restored int, skipped int, err error) {
+	transaction, err := repository.database.Begin()
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
+	defer transaction.Rollback()
+
+	if replace {
+		if _, err := transaction.Exec(QueryAccountsDeleteAll); err != nil {
+			return 0, 0, err
+		}
+		if _, err := transaction.Exec(QueryHistoryDeleteAll); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	now := unixSeconds(time.Now())
+	for _, seal := range seals {
+		result, err := transaction.Exec(QueryAccountCreate, now, now)
+		if err != nil {
+			return 0, 0, err
+		}
 
-	return &schemas.ResponseAccountDetails{
-		Id:         strconv.FormatInt(lastInsertedId, 10),
-		Platform:   account.Platform,
-		Identifier: account.Identifier,
-		Passphrase: account.Passphrase,
-		Url:        account.Url,
-		Notes:      account.Notes,
-		Strength:   0, // Will be set by service layer after decryption
-	}, nil
+		lastInsertedId, err := result.LastInsertId()
+		if err != nil {
+			return 0, 0, err
+		}
+		id := strconv.FormatInt(lastInsertedId, 10)
+
+		account, err := seal(id)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		err = updateAccountRow(transaction, id, account)
+		if err != nil {
+			if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				return 0, 0, err
+			}
+
+			// Only the failed statement was rolled back, the empty row remains
+			if _, err := transaction.Exec(QueryAccountDelete, id); err != nil {
+				return 0, 0, err
+			}
+			skipped++
+			continue
+		}
+		restored++
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return restored, skipped, nil
 }
 
+// The replaced passphrase is kept in the history in the same transaction,
+// history is nil when there is nothing to keep
 func (repository *AccountsRepository) UpdateAccount(
 	id string,
-	account *schemas.RequestAccountsUpsert,
+	account *EncryptedAccountUpsert,
+	history *HistoryUpsert,
 ) error {
-	statement, err := repository.database.Prepare(QueryAccountUpdate)
+	transaction, err := repository.database.Begin()
 	if err != nil {
 		return err
 	}
+	defer transaction.Rollback()
 
-	_, err = statement.Exec(
-		account.Platform,
-		account.Identifier,
-		account.Passphrase,
-		account.Url,
-		account.Notes,
-		account.Strength, // This is the encrypted strength from service
-		id,
-	)
+	err = updateAccountRow(transaction, id, account)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
 			return schemas.NewAPIError(
@@ -266,18 +378,203 @@ func (repository *AccountsRepository) UpdateAccount(
 		return err
 	}
 
-	return nil
+	if history != nil {
+		if err := recordHistory(transaction, id, history); err != nil {
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// Returns the encrypted policy of the account and the name of its profile, both empty without one
+func (repository *AccountsRepository) GetPolicy(
+	id string,
+) (string, string, error) {
+	var policy, profile string
+	err := repository.database.QueryRow(QueryAccountPolicy, id).Scan(&policy, &profile)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", schemas.NewAPIError(
+				schemas.ErrAccountNotFound,
+				"Account not found",
+				nil,
+			)
+		}
+		return "", "", err
+	}
+
+	return policy, profile, nil
+}
+
+// Whether revealing the account asks for the passphrase again
+func (repository *AccountsRepository) GetReprompt(
+	id string,
+) (bool, error) {
+	statement, err := repository.database.Prepare(QueryAccountReprompt)
+	if err != nil {
+		return false, err
+	}
+
+	var reprompt bool
+	err = statement.QueryRow(id).Scan(&reprompt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, schemas.NewAPIError(
+				schemas.ErrAccountNotFound,
+				"Account not found",
+				nil,
+			)
+		}
+		return false, err
+	}
+
+	return reprompt, nil
+}
+
+// Returns the encrypted TOTP secret, empty if the account has none
+func (repository *AccountsRepository) GetTotp(
+	id string,
+) (string, error) {
+	statement, err := repository.database.Prepare(QueryAccountTotp)
+	if err != nil {
+		return "", err
+	}
+
+	var totp string
+	err = statement.QueryRow(id).Scan(&totp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", schemas.NewAPIError(
+				schemas.ErrAccountNotFound,
+				"Account not found",
+				nil,
+			)
+		}
+		return "", err
+	}
+
+	return totp, nil
+}
+
+// Replaces the encrypted TOTP secret, only if it is still the previous one
+func (repository *AccountsRepository) UpdateTotp(
+	id string,
+	previous string,
+	totp string,
+) (bool, error) {
+	statement, err := repository.database.Prepare(QueryAccountTotpUpdate)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := statement.Exec(totp, id, previous)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// The passphrase of every account, or of the one with the given id
+func (repository *AccountsRepository) GetEncryptedPassphrases(
+	id string,
+) ([]*EncryptedPassphraseRow, error) {
+	rows, err := repository.database.Query(QueryAccountsPassphrases, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passphrases := []*EncryptedPassphraseRow{}
+	for rows.Next() {
+		var row EncryptedPassphraseRow
+		if err := rows.Scan(&row.Id, &row.Passphrase); err != nil {
+			return nil, err
+		}
+		passphrases = append(passphrases, &row)
+	}
+
+	return passphrases, rows.Err()
+}
+
+// Stores the breach result, unless the passphrase changed since it was checked
+func (repository *AccountsRepository) UpdateBreached(
+	id string,
+	passphrase string,
+	breached string,
+) (bool, error) {
+	result, err := repository.database.Exec(QueryAccountBreachedUpdate, breached, id, passphrase)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
 }
 
+// Accounts whose strength was computed by another version of the estimator
+func (repository *AccountsRepository) GetOutdatedStrengths(
+	version int,
+) ([]*EncryptedStrengthRow, error) {
+	rows, err := repository.database.Query(QueryAccountsOutdatedStrengths, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outdated := []*EncryptedStrengthRow{}
+	for rows.Next() {
+		var row EncryptedStrengthRow
+		if err := rows.Scan(&row.Id, &row.Platform, &row.Identifier, &row.Passphrase); err != nil {
+			return nil, err
+		}
+		outdated = append(outdated, &row)
+	}
+
+	return outdated, rows.Err()
+}
+
+// Stores the recomputed strength, unless the passphrase changed in the meantime
+func (repository *AccountsRepository) UpdateStrength(
+	id string,
+	passphrase string,
+	strength string,
+	version int,
+) (bool, error) {
+	result, err := repository.database.Exec(QueryAccountStrengthUpdate, strength, version, id, passphrase)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// The history of the account is deleted with it
 func (repository *AccountsRepository) DeleteAccount(
 	id string,
 ) error {
-	statement, err := repository.database.Prepare(QueryAccountDelete)
+	transaction, err := repository.database.Begin()
 	if err != nil {
 		return err
 	}
+	defer transaction.Rollback()
 
-	result, err := statement.Exec(id)
+	result, err := transaction.Exec(QueryAccountDelete, id)
 	if err != nil {
 		return err
 	}
@@ -295,7 +592,11 @@ func (repository *AccountsRepository) DeleteAccount(
 		)
 	}
 
-	return nil
+	if _, err := transaction.Exec(QueryHistoryDelete, id); err != nil {
+		return err
+	}
+
+	return transaction.Commit()
 }
 
 func (repository *AccountsRepository) ExportAccountsData() ([]schemas.RequestAccountsUpsert, error) {
@@ -329,7 +630,7 @@ func (repository *AccountsRepository) ExportAccountsData() ([]schemas.RequestAcc
 	return accounts, nil
 }
 
-func (repository *AccountsRepository) GetUniqueIdentifiers() ([]string, error) {
+func (repository *AccountsRepository) GetUniqueIdentifiers() ([]*EncryptedIdentifierRow, error) {
 	statement, err := repository.database.Prepare(QueryUniqueIdentifiers)
 	if err != nil {
 		return nil, err
@@ -341,14 +642,14 @@ func (repository *AccountsRepository) GetUniqueIdentifiers() ([]string, error) {
 	}
 	defer rows.Close()
 
-	var identifiers []string
+	var identifiers []*EncryptedIdentifierRow
 	for rows.Next() {
-		var identifier string
-		err = rows.Scan(&identifier)
+		var row EncryptedIdentifierRow
+		err = rows.Scan(&row.Id, &row.Identifier)
 		if err != nil {
 			return nil, err
 		}
-		identifiers = append(identifiers, identifier)
+		identifiers = append(identifiers, &row)
 	}
 
 	return identifiers, nil
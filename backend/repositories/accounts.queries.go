@@ -2,15 +2,23 @@ package repositories
 
 const (
 	QueryAccountCreate = `
-	INSERT INTO accounts (platform, identifier, passphrase, url, notes, strength)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT INTO accounts (platform, identifier, passphrase, created_at, updated_at)
+	VALUES ('', '', '', ?, ?)
 	`
 	QueryAccounts = `
-	SELECT id, platform, identifier, url, notes, strength
+	SELECT id, platform, identifier, url, notes, strength, reprompt, breached,
+		rotation_days, passphrase_changed_at
 	FROM accounts
 	`
+	QueryAccountsMatching = `
+	SELECT id, platform, identifier, url, notes, strength, reprompt, breached,
+		rotation_days, passphrase_changed_at
+	FROM accounts
+	WHERE (? = '' OR platform_index = ?) AND (? = '' OR identifier_index = ?)
+	`
 	QueryAccountDetails = `
-	SELECT id, platform, identifier, url, passphrase, notes, strength
+	SELECT id, platform, identifier, url, passphrase, notes, strength, totp, reprompt, breached,
+		policy, policy_profile, rotation_days, passphrase_changed_at, created_at, updated_at
 	FROM accounts
 	WHERE id = ?
 	`
@@ -21,27 +29,68 @@ const (
 	`
 	QueryAccountUpdate = `
 	UPDATE accounts
-	SET platform = ?, identifier = ?, passphrase = ?, url = ?, notes = ?, strength = ?
+	SET platform = ?, identifier = ?, passphrase = ?, url = ?, notes = ?, strength = ?, strength_version = ?,
+		platform_index = ?, identifier_index = ?, totp = ?, reprompt = ?,
+		breached = CASE WHEN ? THEN '' ELSE breached END,
+		policy = ?, policy_profile = ?, rotation_days = ?, updated_at = ?,
+		passphrase_changed_at = COALESCE(NULLIF(?, 0), passphrase_changed_at)
+	WHERE id = ?
+	`
+	QueryAccountPolicy = `
+	SELECT policy, policy_profile
+	FROM accounts
+	WHERE id = ?
+	`
+	QueryAccountReprompt = `
+	SELECT reprompt
+	FROM accounts
+	WHERE id = ?
+	`
+	QueryAccountsPassphrases = `
+	SELECT id, passphrase
+	FROM accounts
+	WHERE (? = '' OR id = ?)
+	`
+	QueryAccountBreachedUpdate = `
+	UPDATE accounts
+	SET breached = ?
+	WHERE id = ? AND passphrase = ?
+	`
+	QueryAccountsOutdatedStrengths = `
+	SELECT id, platform, identifier, passphrase
+	FROM accounts
+	WHERE strength_version != ?
+	`
+	QueryAccountStrengthUpdate = `
+	UPDATE accounts
+	SET strength = ?, strength_version = ?
+	WHERE id = ? AND passphrase = ?
+	`
+	QueryAccountTotp = `
+	SELECT totp
+	FROM accounts
 	WHERE id = ?
 	`
+	QueryAccountTotpUpdate = `
+	UPDATE accounts
+	SET totp = ?
+	WHERE id = ? AND totp = ?
+	`
+	QueryAccountsDeleteAll = `
+	DELETE FROM accounts
+	`
 	QueryAccountDelete = `
 	DELETE FROM accounts
 	WHERE id = ?
 	`
-	QueryAccountImport = `
-	BEGIN TRANSACTION;
-	INSERT INTO accounts (platform, identifier, passphrase, url, notes, strength)
-	VALUES (?, ?, ?, ?, ?, ?);
-	COMMIT;
-	`
 	QueryAccountsExport = `
 	SELECT platform, identifier, passphrase, url, notes
 	FROM accounts
 	`
 	QueryUniqueIdentifiers = `
-	SELECT DISTINCT identifier
+	SELECT MIN(id), identifier
 	FROM accounts
 	WHERE identifier IS NOT NULL AND identifier != ''
-	ORDER BY identifier
+	GROUP BY COALESCE(identifier_index, identifier)
 	`
 )
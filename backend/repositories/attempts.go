@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"time"
+)
+
+type AttemptsRepository struct {
+	database *sql.DB
+}
+
+func NewAttemptsRepository() *AttemptsRepository {
+	return &AttemptsRepository{database: database.GetDB()}
+}
+
+// Returns the attempts of the client on the endpoint, empty if there were none
+func (repository *AttemptsRepository) GetAttempt(
+	client string,
+	endpoint string,
+) (*models.Attempt, error) {
+	attempt := &models.Attempt{Client: client, Endpoint: endpoint}
+
+	var lockedUntil, lastAttempt int64
+	err := repository.database.QueryRow(QueryGetAttempt, client, endpoint).Scan(
+		&attempt.Failures,
+		&lockedUntil,
+		&lastAttempt,
+	)
+	if err == sql.ErrNoRows {
+		return attempt, nil
+	}
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get attempts",
+			err,
+		)
+	}
+
+	attempt.LockedUntil = unixTime(lockedUntil)
+	attempt.LastAttempt = unixTime(lastAttempt)
+
+	return attempt, nil
+}
+
+func (repository *AttemptsRepository) SaveAttempt(attempt *models.Attempt) error {
+	_, err := repository.database.Exec(
+		QuerySaveAttempt,
+		attempt.Client,
+		attempt.Endpoint,
+		attempt.Failures,
+		unixSeconds(attempt.LockedUntil),
+		unixSeconds(attempt.LastAttempt),
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to save attempts",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *AttemptsRepository) DeleteAttempt(
+	client string,
+	endpoint string,
+) error {
+	_, err := repository.database.Exec(QueryDeleteAttempt, client, endpoint)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete attempts",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Forgets the clients that are not locked and stayed quiet since the given time
+func (repository *AttemptsRepository) DeleteStaleAttempts(before time.Time) error {
+	_, err := repository.database.Exec(QueryDeleteStaleAttempts, before.Unix(), time.Now().Unix())
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete stale attempts",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Zero is stored for times that were never set
+func unixSeconds(at time.Time) int64 {
+	if at.IsZero() {
+		return 0
+	}
+	return at.Unix()
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,23 @@
+package repositories
+
+const (
+	QueryGetAttempt = `
+	SELECT failures, locked_until, last_attempt
+	FROM attempts
+	WHERE client = ? AND endpoint = ?
+	`
+	QuerySaveAttempt = `
+	INSERT INTO attempts (client, endpoint, failures, locked_until, last_attempt)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (client, endpoint) DO UPDATE
+	SET failures = excluded.failures, locked_until = excluded.locked_until, last_attempt = excluded.last_attempt
+	`
+	QueryDeleteAttempt = `
+	DELETE FROM attempts
+	WHERE client = ? AND endpoint = ?
+	`
+	QueryDeleteStaleAttempts = `
+	DELETE FROM attempts
+	WHERE last_attempt < ? AND locked_until < ?
+	`
+)
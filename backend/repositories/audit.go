@@ -0,0 +1,207 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+)
+
+type AuditRepository struct {
+	database *sql.DB
+}
+
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{database: database.GetDB()}
+}
+
+// Computes the hash of an event, its id is already set
+type SealAuditEventFunc func(previousHash string) string
+
+// Appends the event after the last one, in a transaction so the chain cannot fork
+func (repository *AuditRepository) AppendAuditEvent(
+	event *models.AuditEvent,
+	seal SealAuditEventFunc,
+) error {
+	transaction, err := repository.database.Begin()
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to append audit event",
+			err,
+		)
+	}
+	defer transaction.Rollback()
+
+	var lastId int64
+	var previousHash string
+	err = transaction.QueryRow(QueryLastAuditEvent).Scan(&lastId, &previousHash)
+	if err != nil && err != sql.ErrNoRows {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to append audit event",
+			err,
+		)
+	}
+
+	// Ids are never reused, so events deleted from the end leave a gap
+	var sequence int64
+	err = transaction.QueryRow(QueryAuditSequence).Scan(&sequence)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to append audit event",
+			err,
+		)
+	}
+
+	event.Id = max(lastId, sequence) + 1
+	event.Hash = seal(previousHash)
+
+	_, err = transaction.Exec(
+		QueryAppendAuditEvent,
+		event.Id,
+		unixSeconds(event.CreatedAt),
+		event.Event,
+		event.AccountId,
+		event.Address,
+		event.SessionId,
+		event.TokenId,
+		event.Details,
+		event.Hash,
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to append audit event",
+			err,
+		)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to append audit event",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Returns the matching events, newest first
+func (repository *AuditRepository) GetAuditEvents(
+	filter *models.AuditFilter,
+) ([]*models.AuditEvent, error) {
+	since := unixSeconds(filter.Since)
+	until := unixSeconds(filter.Until)
+
+	rows, err := repository.database.Query(
+		QueryAuditEventsMatching,
+		filter.Event,
+		filter.Event,
+		filter.Event,
+		filter.AccountId,
+		filter.AccountId,
+		since,
+		since,
+		until,
+		until,
+		filter.Limit,
+		filter.Offset,
+	)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get audit events",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to get audit events",
+				err,
+			)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Visits every event from the oldest one, stopping at the first error
+func (repository *AuditRepository) WalkAuditChain(
+	visit func(event *models.AuditEvent) error,
+) error {
+	rows, err := repository.database.Query(QueryAuditChain)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to read audit events",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to read audit events",
+				err,
+			)
+		}
+
+		if err := visit(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Returns the highest id ever given to an event
+func (repository *AuditRepository) GetAuditSequence() (int64, error) {
+	var sequence int64
+	err := repository.database.QueryRow(QueryAuditSequence).Scan(&sequence)
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to read audit sequence",
+			err,
+		)
+	}
+
+	return sequence, nil
+}
+
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	event := &models.AuditEvent{}
+
+	var createdAt int64
+	err := row.Scan(
+		&event.Id,
+		&createdAt,
+		&event.Event,
+		&event.AccountId,
+		&event.Address,
+		&event.SessionId,
+		&event.TokenId,
+		&event.Details,
+		&event.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.CreatedAt = unixTime(createdAt)
+
+	return event, nil
+}
@@ -0,0 +1,33 @@
+package repositories
+
+const (
+	QueryLastAuditEvent = `
+	SELECT id, hash
+	FROM audit_events
+	ORDER BY id DESC
+	LIMIT 1
+	`
+	QueryAppendAuditEvent = `
+	INSERT INTO audit_events (id, created_at, event, account_id, address, session_id, token_id, details, hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	QueryAuditEventsMatching = `
+	SELECT id, created_at, event, account_id, address, session_id, token_id, details, hash
+	FROM audit_events
+	WHERE (? = '' OR event = ? OR event LIKE ? || '.%')
+	AND (? = '' OR account_id = ?)
+	AND (? = 0 OR created_at >= ?)
+	AND (? = 0 OR created_at <= ?)
+	ORDER BY id DESC
+	LIMIT ? OFFSET ?
+	`
+	QueryAuditChain = `
+	SELECT id, created_at, event, account_id, address, session_id, token_id, details, hash
+	FROM audit_events
+	ORDER BY id
+	`
+	// The highest id ever handed out, it outlives deleted rows
+	QueryAuditSequence = `
+	SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'audit_events'), 0)
+	`
+)
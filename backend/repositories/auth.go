@@ -46,7 +46,19 @@ func (repository *AuthRepository) GetUser() (*models.User, error) {
 	row := repository.database.QueryRow(QueryGetUser)
 
 	var user models.User
-	err := row.Scan(&user.Id, &user.Passphrase, &user.Validated, &user.Recovery)
+	err := row.Scan(
+		&user.Id,
+		&user.Passphrase,
+		&user.Validated,
+		&user.Recovery,
+		&user.Keys.Passphrase,
+		&user.Keys.Recovery,
+		&user.Keys.Environment,
+		&user.Keys.Keyset,
+		&user.TwoFactor.Secret,
+		&user.TwoFactor.RecoveryCodes,
+		&user.TwoFactor.LastStep,
+	)
 	if err != nil {
 		return nil, schemas.NewAPIError(
 			schemas.ErrDatabase,
@@ -61,8 +73,17 @@ func (repository *AuthRepository) GetUser() (*models.User, error) {
 func (repository *AuthRepository) CreateUser(
 	passphrase string,
 	recoveryKey string,
+	keys *models.WrappedKeys,
 ) error {
-	_, err := repository.database.Exec(QueryCreateUser, passphrase, recoveryKey)
+	_, err := repository.database.Exec(
+		QueryCreateUser,
+		passphrase,
+		recoveryKey,
+		keys.Passphrase,
+		keys.Recovery,
+		keys.Environment,
+		keys.Keyset,
+	)
 	if err != nil {
 		return schemas.NewAPIError(
 			schemas.ErrDatabase,
@@ -117,8 +138,9 @@ func (repository *AuthRepository) ValidateUser() error {
 
 func (repository *AuthRepository) UpdateUser(
 	passphrase string,
+	wrappedKey string,
 ) error {
-	_, err := repository.database.Exec(QueryUpdatePassphrase, passphrase)
+	_, err := repository.database.Exec(QueryUpdatePassphrase, passphrase, wrappedKey)
 	if err != nil {
 		return schemas.NewAPIError(
 			schemas.ErrDatabase,
@@ -130,18 +152,163 @@ func (repository *AuthRepository) UpdateUser(
 	return nil
 }
 
-func (repository *AuthRepository) GetRecoveryKey() (string, error) {
-	row := repository.database.QueryRow(QueryGetRecoveryKey)
+func (repository *AuthRepository) UpdatePassphraseHash(
+	passphrase string,
+) error {
+	_, err := repository.database.Exec(QueryUpdatePassphraseHash, passphrase)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update passphrase hash",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *AuthRepository) UpdateEnvironmentKey(
+	wrappedKey string,
+) error {
+	_, err := repository.database.Exec(QueryUpdateEnvironmentKey, wrappedKey)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update environment key",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Stores the hash of a new recovery key and the root key wrapped with it
+func (repository *AuthRepository) UpdateRecoveryKey(
+	recoveryHash string,
+	wrappedKey string,
+) error {
+	_, err := repository.database.Exec(QueryUpdateRecoveryKey, recoveryHash, wrappedKey)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update recovery key",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *AuthRepository) UpdateRecoveryKeyHash(
+	recoveryHash string,
+) error {
+	_, err := repository.database.Exec(QueryUpdateRecoveryHash, recoveryHash)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update recovery key hash",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Replaces the passphrase and the recovery key at once after a recovery
+func (repository *AuthRepository) UpdateCredentials(
+	passphrase string,
+	wrappedKey string,
+	recoveryHash string,
+	wrappedRecoveryKey string,
+) error {
+	_, err := repository.database.Exec(
+		QueryUpdateCredentials,
+		passphrase,
+		wrappedKey,
+		recoveryHash,
+		wrappedRecoveryKey,
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update credentials",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Storing an empty secret disables two-factor authentication
+func (repository *AuthRepository) UpdateTwoFactor(
+	twoFactor *models.TwoFactor,
+) error {
+	_, err := repository.database.Exec(
+		QueryUpdateTwoFactor,
+		twoFactor.Secret,
+		twoFactor.RecoveryCodes,
+		twoFactor.LastStep,
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update two-factor authentication",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Records the last accepted time step, false if a newer one was already used
+func (repository *AuthRepository) UseTwoFactorStep(step int64) (bool, error) {
+	result, err := repository.database.Exec(QueryUpdateTwoFactorStep, step, step)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update two-factor time step",
+			err,
+		)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update two-factor time step",
+			err,
+		)
+	}
+
+	return affected > 0, nil
+}
+
+// Replaces the recovery codes, false if they changed since they were read
+func (repository *AuthRepository) ReplaceTwoFactorRecoveryCodes(
+	previous string,
+	recoveryCodes string,
+) (bool, error) {
+	result, err := repository.database.Exec(
+		QueryUpdateTwoFactorRecoveryCodes,
+		recoveryCodes,
+		previous,
+	)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update recovery codes",
+			err,
+		)
+	}
 
-	var recoveryKey string
-	err := row.Scan(&recoveryKey)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return "", schemas.NewAPIError(
+		return false, schemas.NewAPIError(
 			schemas.ErrDatabase,
-			"failed to get recovery key",
+			"failed to update recovery codes",
 			err,
 		)
 	}
 
-	return recoveryKey, nil
+	return affected > 0, nil
 }
@@ -1,10 +1,33 @@
 package repositories
 
 const (
-	QueryGetUserCount     = `SELECT COUNT(*) FROM user WHERE validated = TRUE`
-	QueryGetUser          = `SELECT id, passphrase, validated, recovery FROM user LIMIT 1`
-	QueryCreateUser       = `UPDATE user SET passphrase = ?, recovery = ? WHERE id = 1`
-	QueryValidateUser     = `UPDATE user SET validated = TRUE`
-	QueryUpdatePassphrase = `UPDATE user SET passphrase = ?`
-	QueryGetRecoveryKey   = `SELECT recovery FROM user LIMIT 1`
+	QueryGetUserCount = `SELECT COUNT(*) FROM user WHERE validated = TRUE`
+	QueryGetUser      = `
+	SELECT id, passphrase, validated, recovery, wrapped_key, wrapped_key_recovery, wrapped_key_env, keyset,
+		totp_secret, totp_recovery_codes, totp_last_step
+	FROM user LIMIT 1
+	`
+	QueryCreateUser = `
+	UPDATE user
+	SET passphrase = ?, recovery = ?, wrapped_key = ?, wrapped_key_recovery = ?, wrapped_key_env = ?, keyset = ?
+	WHERE id = 1
+	`
+	QueryValidateUser         = `UPDATE user SET validated = TRUE`
+	QueryUpdatePassphrase     = `UPDATE user SET passphrase = ?, wrapped_key = ?`
+	QueryUpdatePassphraseHash = `UPDATE user SET passphrase = ?`
+	QueryUpdateEnvironmentKey = `UPDATE user SET wrapped_key_env = ?`
+	QueryUpdateRecoveryKey    = `UPDATE user SET recovery = ?, wrapped_key_recovery = ?`
+	QueryUpdateRecoveryHash   = `UPDATE user SET recovery = ?`
+	QueryUpdateCredentials    = `
+	UPDATE user SET passphrase = ?, wrapped_key = ?, recovery = ?, wrapped_key_recovery = ?
+	`
+	QueryUpdateTwoFactor = `
+	UPDATE user SET totp_secret = ?, totp_recovery_codes = ?, totp_last_step = ?
+	`
+	QueryUpdateTwoFactorStep = `
+	UPDATE user SET totp_last_step = ? WHERE totp_last_step < ?
+	`
+	QueryUpdateTwoFactorRecoveryCodes = `
+	UPDATE user SET totp_recovery_codes = ? WHERE totp_recovery_codes = ?
+	`
 )
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+)
+
+type BreachesRepository struct {
+	database *sql.DB
+}
+
+func NewBreachesRepository() *BreachesRepository {
+	return &BreachesRepository{database: database.GetDB()}
+}
+
+// Adds a hash prefix of the dataset that is being imported
+type AddBreachHashFunc func(prefix string, count int) error
+
+// Replaces the local dataset in a single transaction, read receives the
+// function that adds each hash prefix. Returns the number of prefixes.
+func (repository *BreachesRepository) ImportDataset(
+	read func(add AddBreachHashFunc) error,
+) (int, error) {
+	transaction, err := repository.database.Begin()
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to start transaction",
+			err,
+		)
+	}
+	defer transaction.Rollback()
+
+	if _, err := transaction.Exec(QueryDeleteBreachHashes); err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete the breach dataset",
+			err,
+		)
+	}
+
+	statement, err := transaction.Prepare(QueryAddBreachHash)
+	if err != nil {
+		return 0, err
+	}
+	defer statement.Close()
+
+	err = read(func(prefix string, count int) error {
+		_, err := statement.Exec(prefix, count)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	if err := transaction.QueryRow(QueryCountBreachHashes).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to commit the breach dataset",
+			err,
+		)
+	}
+
+	return total, nil
+}
+
+// Returns 0 if the prefix is not in the dataset
+func (repository *BreachesRepository) GetOccurrences(prefix string) (int, error) {
+	var count int
+	err := repository.database.QueryRow(QueryGetBreachHash, prefix).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to look up the breach dataset",
+			err,
+		)
+	}
+
+	return count, nil
+}
+
+func (repository *BreachesRepository) CountDataset() (int, error) {
+	var count int
+	err := repository.database.QueryRow(QueryCountBreachHashes).Scan(&count)
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to count the breach dataset",
+			err,
+		)
+	}
+
+	return count, nil
+}
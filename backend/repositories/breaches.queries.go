@@ -0,0 +1,22 @@
+package repositories
+
+const (
+	QueryDeleteBreachHashes = `
+	DELETE FROM breach_hashes
+	`
+	QueryAddBreachHash = `
+	INSERT INTO breach_hashes (prefix, count)
+	VALUES (?, ?)
+	ON CONFLICT (prefix) DO UPDATE
+	SET count = count + excluded.count
+	`
+	QueryGetBreachHash = `
+	SELECT count
+	FROM breach_hashes
+	WHERE prefix = ?
+	`
+	QueryCountBreachHashes = `
+	SELECT COUNT(*)
+	FROM breach_hashes
+	`
+)
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/schemas"
+	"strconv"
+	"time"
+)
+
+// Keeps the replaced passphrase of an account in its history
+type HistoryUpsert struct {
+	// Encrypts the replaced passphrase for the history row with the given id,
+	// nil when the passphrase did not change
+	Seal       func(historyId string) (string, error)
+	ReplacedAt time.Time
+	// Whether the account asked to reprompt before revealing the replaced passphrase
+	Reprompt bool
+	// Older entries beyond the limit or replaced before KeepAfter are deleted
+	Limit     int
+	KeepAfter time.Time
+	// The entry that became the passphrase again, it leaves the history
+	RestoredId string
+}
+
+type HistoryRow struct {
+	Id         string
+	ReplacedAt time.Time
+}
+
+func recordHistory(transaction *sql.Tx, accountId string, history *HistoryUpsert) error {
+	if history.Seal != nil && history.Limit > 0 {
+		result, err := transaction.Exec(
+			QueryHistoryCreate,
+			accountId,
+			history.Reprompt,
+			unixSeconds(history.ReplacedAt),
+		)
+		if err != nil {
+			return err
+		}
+
+		lastInsertedId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		historyId := strconv.FormatInt(lastInsertedId, 10)
+
+		passphrase, err := history.Seal(historyId)
+		if err != nil {
+			return err
+		}
+
+		if _, err := transaction.Exec(QueryHistorySeal, passphrase, historyId); err != nil {
+			return err
+		}
+	}
+
+	if history.RestoredId != "" {
+		if _, err := transaction.Exec(QueryHistoryEntryDelete, history.RestoredId, accountId); err != nil {
+			return err
+		}
+	}
+
+	_, err := transaction.Exec(
+		QueryHistoryPrune,
+		accountId,
+		unixSeconds(history.KeepAfter),
+		accountId,
+		history.Limit,
+	)
+	return err
+}
+
+// Entries replaced before keepAfter are left out, newest first
+func (repository *AccountsRepository) GetHistory(
+	accountId string,
+	keepAfter time.Time,
+) ([]*HistoryRow, error) {
+	rows, err := repository.database.Query(QueryHistory, accountId, unixSeconds(keepAfter))
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get passphrase history",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	history := []*HistoryRow{}
+	for rows.Next() {
+		var row HistoryRow
+		var replacedAt int64
+		if err := rows.Scan(&row.Id, &replacedAt); err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to get passphrase history",
+				err,
+			)
+		}
+		row.ReplacedAt = unixTime(replacedAt)
+		history = append(history, &row)
+	}
+
+	return history, rows.Err()
+}
+
+// Returns the encrypted passphrase of a history entry of the account, and
+// whether the account asked to reprompt before revealing it back then
+func (repository *AccountsRepository) GetHistoryPassphrase(
+	accountId string,
+	historyId string,
+	keepAfter time.Time,
+) (string, bool, error) {
+	var passphrase string
+	var reprompt bool
+	err := repository.database.QueryRow(
+		QueryHistoryPassphrase,
+		historyId,
+		accountId,
+		unixSeconds(keepAfter),
+	).Scan(&passphrase, &reprompt)
+	if err == sql.ErrNoRows {
+		return "", false, schemas.NewAPIError(
+			schemas.ErrHistoryNotFound,
+			"History entry not found",
+			nil,
+		)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return passphrase, reprompt, nil
+}
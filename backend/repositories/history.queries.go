@@ -0,0 +1,44 @@
+package repositories
+
+const (
+	QueryHistoryCreate = `
+	INSERT INTO account_passphrase_history (account_id, passphrase, reprompt, replaced_at)
+	VALUES (?, '', ?, ?)
+	`
+	QueryHistorySeal = `
+	UPDATE account_passphrase_history
+	SET passphrase = ?
+	WHERE id = ?
+	`
+	QueryHistory = `
+	SELECT id, replaced_at
+	FROM account_passphrase_history
+	WHERE account_id = ? AND replaced_at >= ?
+	ORDER BY replaced_at DESC, id DESC
+	`
+	QueryHistoryPassphrase = `
+	SELECT passphrase, reprompt
+	FROM account_passphrase_history
+	WHERE id = ? AND account_id = ? AND replaced_at >= ?
+	`
+	QueryHistoryPrune = `
+	DELETE FROM account_passphrase_history
+	WHERE account_id = ? AND (replaced_at < ? OR id NOT IN (
+		SELECT id FROM account_passphrase_history
+		WHERE account_id = ?
+		ORDER BY replaced_at DESC, id DESC
+		LIMIT ?
+	))
+	`
+	QueryHistoryEntryDelete = `
+	DELETE FROM account_passphrase_history
+	WHERE id = ? AND account_id = ?
+	`
+	QueryHistoryDelete = `
+	DELETE FROM account_passphrase_history
+	WHERE account_id = ?
+	`
+	QueryHistoryDeleteAll = `
+	DELETE FROM account_passphrase_history
+	`
+)
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"time"
+)
+
+type PoliciesRepository struct {
+	database *sql.DB
+}
+
+func NewPoliciesRepository() *PoliciesRepository {
+	return &PoliciesRepository{database: database.GetDB()}
+}
+
+// Returns every profile, sorted by name
+func (repository *PoliciesRepository) GetPolicies() ([]*models.PolicyProfile, error) {
+	rows, err := repository.database.Query(QueryPolicies)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get policies",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	profiles := []*models.PolicyProfile{}
+	for rows.Next() {
+		profile, err := scanPolicyProfile(rows)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to get policies",
+				err,
+			)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// Returns nil if no profile has the given name
+func (repository *PoliciesRepository) GetPolicy(name string) (*models.PolicyProfile, error) {
+	profile, err := scanPolicyProfile(repository.database.QueryRow(QueryPolicy, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get policy",
+			err,
+		)
+	}
+
+	return profile, nil
+}
+
+// Creates the profile or replaces its rules, the creation time is kept
+func (repository *PoliciesRepository) UpsertPolicy(name string, policy string, at time.Time) error {
+	_, err := repository.database.Exec(QueryPolicyUpsert, name, policy, unixSeconds(at), unixSeconds(at))
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to save policy",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Profiles used by an account are not deleted
+func (repository *PoliciesRepository) DeletePolicy(name string) (bool, error) {
+	result, err := repository.database.Exec(QueryPolicyDelete, name, name)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete policy",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func scanPolicyProfile(row rowScanner) (*models.PolicyProfile, error) {
+	profile := &models.PolicyProfile{}
+
+	var createdAt, updatedAt int64
+	err := row.Scan(
+		&profile.Name,
+		&profile.Policy,
+		&createdAt,
+		&updatedAt,
+		&profile.Accounts,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.CreatedAt = unixTime(createdAt)
+	profile.UpdatedAt = unixTime(updatedAt)
+
+	return profile, nil
+}
@@ -0,0 +1,25 @@
+package repositories
+
+const (
+	QueryPolicies = `
+	SELECT name, policy, created_at, updated_at,
+		(SELECT COUNT(*) FROM accounts WHERE policy_profile = policies.name)
+	FROM policies
+	ORDER BY name
+	`
+	QueryPolicy = `
+	SELECT name, policy, created_at, updated_at,
+		(SELECT COUNT(*) FROM accounts WHERE policy_profile = policies.name)
+	FROM policies
+	WHERE name = ?
+	`
+	QueryPolicyUpsert = `
+	INSERT INTO policies (name, policy, created_at, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET policy = excluded.policy, updated_at = excluded.updated_at
+	`
+	QueryPolicyDelete = `
+	DELETE FROM policies
+	WHERE name = ? AND NOT EXISTS (SELECT 1 FROM accounts WHERE policy_profile = ?)
+	`
+)
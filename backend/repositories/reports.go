@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"time"
+)
+
+type ReportsRepository struct {
+	database *sql.DB
+}
+
+func NewReportsRepository() *ReportsRepository {
+	return &ReportsRepository{database: database.GetDB()}
+}
+
+// The encrypted fields a security report is made of
+type EncryptedReportRow struct {
+	Id                  string
+	Platform            string
+	Identifier          string
+	Url                 string
+	Passphrase          string
+	EncryptedStrength   string
+	EncryptedBreached   string
+	PassphraseChangedAt time.Time
+}
+
+func (repository *ReportsRepository) GetReportAccounts() ([]*EncryptedReportRow, error) {
+	rows, err := repository.database.Query(QueryReportAccounts)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get accounts",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	accounts := []*EncryptedReportRow{}
+	for rows.Next() {
+		var row EncryptedReportRow
+		var changedAt int64
+		err := rows.Scan(
+			&row.Id,
+			&row.Platform,
+			&row.Identifier,
+			&row.Url,
+			&row.Passphrase,
+			&row.EncryptedStrength,
+			&row.EncryptedBreached,
+			&changedAt,
+		)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to read accounts",
+				err,
+			)
+		}
+
+		row.PassphraseChangedAt = unixTime(changedAt)
+		accounts = append(accounts, &row)
+	}
+
+	return accounts, rows.Err()
+}
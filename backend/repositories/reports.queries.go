@@ -0,0 +1,9 @@
+package repositories
+
+const (
+	QueryReportAccounts = `
+	SELECT id, platform, identifier, url, passphrase, strength, breached, passphrase_changed_at
+	FROM accounts
+	ORDER BY id
+	`
+)
@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"time"
+)
+
+type SessionsRepository struct {
+	database *sql.DB
+}
+
+func NewSessionsRepository() *SessionsRepository {
+	return &SessionsRepository{database: database.GetDB()}
+}
+
+func (repository *SessionsRepository) CreateSession(session *models.Session) error {
+	_, err := repository.database.Exec(
+		QueryCreateSession,
+		session.Id,
+		session.Name,
+		session.UserAgent,
+		session.Address,
+		unixSeconds(session.CreatedAt),
+		unixSeconds(session.LastSeenAt),
+		unixSeconds(session.ExpiresAt),
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to create session",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// Returns nil if the session does not exist, because it was revoked or never created
+func (repository *SessionsRepository) GetSession(id string) (*models.Session, error) {
+	session, err := scanSession(repository.database.QueryRow(QueryGetSession, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get session",
+			err,
+		)
+	}
+
+	return session, nil
+}
+
+// Returns the sessions that have not expired, most recently used first
+func (repository *SessionsRepository) GetSessions() ([]*models.Session, error) {
+	rows, err := repository.database.Query(QueryGetSessions, time.Now().Unix())
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get sessions",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to get sessions",
+				err,
+			)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (repository *SessionsRepository) TouchSession(
+	id string,
+	lastSeenAt time.Time,
+	expiresAt time.Time,
+) error {
+	_, err := repository.database.Exec(
+		QueryTouchSession,
+		unixSeconds(lastSeenAt),
+		unixSeconds(expiresAt),
+		id,
+	)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update session",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *SessionsRepository) ReauthenticateSession(id string, at time.Time) error {
+	_, err := repository.database.Exec(QueryReauthenticateSession, unixSeconds(at), id)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update session",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *SessionsRepository) RenameSession(id string, name string) (bool, error) {
+	result, err := repository.database.Exec(QueryRenameSession, name, id)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to rename session",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (repository *SessionsRepository) DeleteSession(id string) (bool, error) {
+	result, err := repository.database.Exec(QueryDeleteSession, id)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete session",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Deletes every session except the given one, pass an empty id to delete all of them
+func (repository *SessionsRepository) DeleteOtherSessions(id string) error {
+	_, err := repository.database.Exec(QueryDeleteOtherSessions, id)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete sessions",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *SessionsRepository) DeleteExpiredSessions() error {
+	_, err := repository.database.Exec(QueryDeleteExpiredSessions, time.Now().Unix())
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete expired sessions",
+			err,
+		)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	session := &models.Session{}
+
+	var createdAt, lastSeenAt, expiresAt, reauthenticatedAt int64
+	err := row.Scan(
+		&session.Id,
+		&session.Name,
+		&session.UserAgent,
+		&session.Address,
+		&createdAt,
+		&lastSeenAt,
+		&expiresAt,
+		&reauthenticatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session.CreatedAt = unixTime(createdAt)
+	session.LastSeenAt = unixTime(lastSeenAt)
+	session.ExpiresAt = unixTime(expiresAt)
+	session.ReauthenticatedAt = unixTime(reauthenticatedAt)
+
+	return session, nil
+}
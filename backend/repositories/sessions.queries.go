@@ -0,0 +1,46 @@
+package repositories
+
+const (
+	QueryCreateSession = `
+	INSERT INTO sessions (id, name, user_agent, address, created_at, last_seen_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	QueryGetSession = `
+	SELECT id, name, user_agent, address, created_at, last_seen_at, expires_at, reauthenticated_at
+	FROM sessions
+	WHERE id = ?
+	`
+	QueryGetSessions = `
+	SELECT id, name, user_agent, address, created_at, last_seen_at, expires_at, reauthenticated_at
+	FROM sessions
+	WHERE expires_at > ?
+	ORDER BY last_seen_at DESC
+	`
+	QueryTouchSession = `
+	UPDATE sessions
+	SET last_seen_at = ?, expires_at = ?
+	WHERE id = ?
+	`
+	QueryReauthenticateSession = `
+	UPDATE sessions
+	SET reauthenticated_at = ?
+	WHERE id = ?
+	`
+	QueryRenameSession = `
+	UPDATE sessions
+	SET name = ?
+	WHERE id = ?
+	`
+	QueryDeleteSession = `
+	DELETE FROM sessions
+	WHERE id = ?
+	`
+	QueryDeleteOtherSessions = `
+	DELETE FROM sessions
+	WHERE id != ?
+	`
+	QueryDeleteExpiredSessions = `
+	DELETE FROM sessions
+	WHERE expires_at <= ?
+	`
+)
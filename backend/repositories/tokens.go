@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"database/sql"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"strings"
+	"time"
+)
+
+type TokensRepository struct {
+	database *sql.DB
+}
+
+func NewTokensRepository() *TokensRepository {
+	return &TokensRepository{database: database.GetDB()}
+}
+
+func (repository *TokensRepository) CreateToken(token *models.AccessToken) (int, error) {
+	result, err := repository.database.Exec(
+		QueryCreateToken,
+		token.Label,
+		token.Prefix,
+		token.Hash,
+		strings.Join(token.Scopes, " "),
+		token.WrappedKey,
+		unixSeconds(token.CreatedAt),
+	)
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to create token",
+			err,
+		)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to create token",
+			err,
+		)
+	}
+
+	return int(id), nil
+}
+
+// Returns nil if no token has the given hash
+func (repository *TokensRepository) GetTokenByHash(hash string) (*models.AccessToken, error) {
+	token, err := scanToken(repository.database.QueryRow(QueryGetTokenByHash, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get token",
+			err,
+		)
+	}
+
+	return token, nil
+}
+
+// Returns every token, newest first
+func (repository *TokensRepository) GetTokens() ([]*models.AccessToken, error) {
+	rows, err := repository.database.Query(QueryGetTokens)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to get tokens",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	tokens := []*models.AccessToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to get tokens",
+				err,
+			)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (repository *TokensRepository) TouchToken(id int, lastUsedAt time.Time) error {
+	_, err := repository.database.Exec(QueryTouchToken, unixSeconds(lastUsedAt), id)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to update token",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (repository *TokensRepository) RenameToken(id int, label string) (bool, error) {
+	result, err := repository.database.Exec(QueryRenameToken, label, id)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to rename token",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (repository *TokensRepository) DeleteToken(id int) (bool, error) {
+	result, err := repository.database.Exec(QueryDeleteToken, id)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete token",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (repository *TokensRepository) DeleteTokens() error {
+	_, err := repository.database.Exec(QueryDeleteTokens)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to delete tokens",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func scanToken(row rowScanner) (*models.AccessToken, error) {
+	token := &models.AccessToken{}
+
+	var scopes string
+	var createdAt, lastUsedAt int64
+	err := row.Scan(
+		&token.Id,
+		&token.Label,
+		&token.Prefix,
+		&token.Hash,
+		&scopes,
+		&token.WrappedKey,
+		&createdAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.CreatedAt = unixTime(createdAt)
+	token.LastUsedAt = unixTime(lastUsedAt)
+
+	return token, nil
+}
@@ -0,0 +1,35 @@
+package repositories
+
+const (
+	QueryCreateToken = `
+	INSERT INTO tokens (label, prefix, hash, scopes, wrapped_key, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	QueryGetTokenByHash = `
+	SELECT id, label, prefix, hash, scopes, wrapped_key, created_at, last_used_at
+	FROM tokens
+	WHERE hash = ?
+	`
+	QueryGetTokens = `
+	SELECT id, label, prefix, hash, scopes, wrapped_key, created_at, last_used_at
+	FROM tokens
+	ORDER BY created_at DESC, id DESC
+	`
+	QueryTouchToken = `
+	UPDATE tokens
+	SET last_used_at = ?
+	WHERE id = ?
+	`
+	QueryRenameToken = `
+	UPDATE tokens
+	SET label = ?
+	WHERE id = ?
+	`
+	QueryDeleteToken = `
+	DELETE FROM tokens
+	WHERE id = ?
+	`
+	QueryDeleteTokens = `
+	DELETE FROM tokens
+	`
+)
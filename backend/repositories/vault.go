@@ -0,0 +1,332 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"strings"
+)
+
+type VaultRepository struct {
+	database *sql.DB
+}
+
+func NewVaultRepository() *VaultRepository {
+	return &VaultRepository{database: database.GetDB()}
+}
+
+// Describes a single encrypted value that is being re-encrypted
+type EncryptedField struct {
+	Table   string
+	Column  string
+	RowId   string
+	Indexed bool
+}
+
+type encryptedColumn struct {
+	name string
+	// Column holding the blind index of the plaintext, if any
+	index string
+}
+
+type encryptedTable struct {
+	name    string
+	columns []encryptedColumn
+}
+
+// Every encrypted column in the database, re-encryption walks this list
+var encryptedTables = []encryptedTable{
+	{"accounts", []encryptedColumn{
+		{"platform", "platform_index"},
+		{"identifier", "identifier_index"},
+		{"url", ""},
+		{"passphrase", ""},
+		{"notes", ""},
+		{"strength", ""},
+		{"totp", ""},
+		{"breached", ""},
+		{"policy", ""},
+	}},
+	{"user", []encryptedColumn{
+		{"totp_secret", ""},
+	}},
+	{"account_passphrase_history", []encryptedColumn{
+		{"passphrase", ""},
+	}},
+}
+
+// Receives the field and its stored value, returns the new value and,
+// for indexed fields, the blind index of the plaintext
+type ReencryptFunc func(field EncryptedField, value string) (encrypted string, blindIndex string, err error)
+
+// Receives the number of re-encrypted rows and the total
+type ProgressFunc func(processed int, total int)
+
+// Counts rows with values that don't start with the current ciphertext
+// prefix or that have no blind index yet
+func (repository *VaultRepository) CountOutdated(currentPrefix string) (int, error) {
+	total := 0
+	for _, table := range encryptedTables {
+		conditions := []string{}
+		arguments := []any{}
+		for _, column := range table.columns {
+			conditions = append(conditions, fmt.Sprintf(
+				"(%[1]s IS NOT NULL AND %[1]s != '' AND substr(%[1]s, 1, ?) != ?)",
+				column.name,
+			))
+			arguments = append(arguments, len(currentPrefix), currentPrefix)
+			if column.index != "" {
+				conditions = append(conditions, column.index+" IS NULL")
+			}
+		}
+
+		var count int
+		err := repository.database.QueryRow(fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE %s",
+			table.name,
+			strings.Join(conditions, " OR "),
+		), arguments...).Scan(&count)
+		if err != nil {
+			return 0, schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to count outdated rows of "+table.name,
+				err,
+			)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// Rewrites every encrypted column in a single transaction, keeping the keys as they are
+func (repository *VaultRepository) Reencrypt(
+	transform ReencryptFunc,
+	progress ProgressFunc,
+) error {
+	return repository.inTransaction(func(transaction *sql.Tx) error {
+		return reencryptTables(transaction, transform, progress)
+	})
+}
+
+// Rewrites every encrypted column and stores the new passphrase hash and
+// wrapped keys in a single transaction, so the vault never ends up half migrated
+func (repository *VaultRepository) ReencryptWithKeys(
+	transform ReencryptFunc,
+	passphrase string,
+	keys *models.WrappedKeys,
+) error {
+	return repository.inTransaction(func(transaction *sql.Tx) error {
+		if err := reencryptTables(transaction, transform, nil); err != nil {
+			return err
+		}
+
+		_, err := transaction.Exec(
+			QueryVaultKeysUpdate,
+			passphrase,
+			keys.Passphrase,
+			keys.Recovery,
+			keys.Environment,
+			keys.Keyset,
+		)
+		if err != nil {
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to store wrapped keys",
+				err,
+			)
+		}
+
+		return nil
+	})
+}
+
+// Rewrites every encrypted column and stores the new sealed keyset in a single transaction
+func (repository *VaultRepository) RotateKeyset(
+	transform ReencryptFunc,
+	progress ProgressFunc,
+	sealedKeyset string,
+) error {
+	return repository.inTransaction(func(transaction *sql.Tx) error {
+		if err := reencryptTables(transaction, transform, progress); err != nil {
+			return err
+		}
+
+		_, err := transaction.Exec(QueryVaultKeysetUpdate, sealedKeyset)
+		if err != nil {
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to store keyset",
+				err,
+			)
+		}
+
+		return nil
+	})
+}
+
+func (repository *VaultRepository) inTransaction(
+	work func(transaction *sql.Tx) error,
+) error {
+	transaction, err := repository.database.Begin()
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to start transaction",
+			err,
+		)
+	}
+	defer transaction.Rollback()
+
+	if err := work(transaction); err != nil {
+		return err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to commit re-encryption",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func reencryptTables(
+	transaction *sql.Tx,
+	transform ReencryptFunc,
+	progress ProgressFunc,
+) error {
+	total := 0
+	for _, table := range encryptedTables {
+		var count int
+		err := transaction.QueryRow("SELECT COUNT(*) FROM " + table.name).Scan(&count)
+		if err != nil {
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to count "+table.name,
+				err,
+			)
+		}
+		total += count
+	}
+
+	processed := 0
+	for _, table := range encryptedTables {
+		err := reencryptTable(transaction, table, transform, func() {
+			processed++
+			if progress != nil {
+				progress(processed, total)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reencryptTable(
+	transaction *sql.Tx,
+	table encryptedTable,
+	transform ReencryptFunc,
+	rowDone func(),
+) error {
+	names := make([]string, len(table.columns))
+	assignments := []string{}
+	for index, column := range table.columns {
+		names[index] = column.name
+		assignments = append(assignments, column.name+" = ?")
+		if column.index != "" {
+			assignments = append(assignments, column.index+" = ?")
+		}
+	}
+
+	rows, err := transaction.Query(fmt.Sprintf(
+		"SELECT id, %s FROM %s",
+		strings.Join(names, ", "),
+		table.name,
+	))
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"failed to read "+table.name,
+			err,
+		)
+	}
+
+	type encryptedRow struct {
+		id     string
+		values []sql.NullString
+	}
+
+	records := []*encryptedRow{}
+	for rows.Next() {
+		record := &encryptedRow{values: make([]sql.NullString, len(table.columns))}
+		destinations := []any{&record.id}
+		for index := range record.values {
+			destinations = append(destinations, &record.values[index])
+		}
+
+		if err := rows.Scan(destinations...); err != nil {
+			rows.Close()
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				"failed to read "+table.name,
+				err,
+			)
+		}
+		records = append(records, record)
+	}
+	rows.Close()
+
+	update := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE id = ?",
+		table.name,
+		strings.Join(assignments, ", "),
+	)
+
+	for _, record := range records {
+		arguments := []any{}
+		for index, column := range table.columns {
+			value := record.values[index]
+			blindIndex := sql.NullString{}
+			if value.Valid && value.String != "" {
+				value.String, blindIndex.String, err = transform(EncryptedField{
+					Table:   table.name,
+					Column:  column.name,
+					RowId:   record.id,
+					Indexed: column.index != "",
+				}, value.String)
+				if err != nil {
+					return schemas.NewAPIError(
+						schemas.ErrEncryptionFailed,
+						fmt.Sprintf("failed to re-encrypt %s.%s of row %s", table.name, column.name, record.id),
+						err,
+					)
+				}
+				blindIndex.Valid = blindIndex.String != ""
+			}
+			arguments = append(arguments, value)
+			if column.index != "" {
+				arguments = append(arguments, blindIndex)
+			}
+		}
+		arguments = append(arguments, record.id)
+
+		if _, err := transaction.Exec(update, arguments...); err != nil {
+			return schemas.NewAPIError(
+				schemas.ErrDatabase,
+				fmt.Sprintf("failed to update row %s of %s", record.id, table.name),
+				err,
+			)
+		}
+
+		rowDone()
+	}
+
+	return nil
+}
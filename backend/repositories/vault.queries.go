@@ -0,0 +1,11 @@
+package repositories
+
+const (
+	QueryVaultKeysUpdate = `
+	UPDATE user
+	SET passphrase = ?, wrapped_key = ?, wrapped_key_recovery = ?, wrapped_key_env = ?, keyset = ?
+	`
+	QueryVaultKeysetUpdate = `
+	UPDATE user SET keyset = ?
+	`
+)
@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type RequestAccountsUpsert struct {
 	Platform   string `json:"platform" validate:"required"`
 	Identifier string `json:"identifier" validate:"required"`
@@ -7,6 +9,15 @@ type RequestAccountsUpsert struct {
 	Url        string `json:"url" validate:"required"`
 	Notes      string `json:"notes" validate:"omitempty"`
 	Strength   string `json:"strength" validate:"omitempty"`
+	// An otpauth:// URI or a base32 TOTP secret
+	Totp string `json:"totp" validate:"omitempty,max=2048"`
+	// Revealing the account asks for the master passphrase again
+	Reprompt bool `json:"reprompt"`
+	// Rules of the site, either its own or those of a named profile
+	Policy        *PassphrasePolicy `json:"policy,omitempty"`
+	PolicyProfile string            `json:"policyProfile,omitempty" validate:"omitempty,max=64"`
+	// Days after which the passphrase is due for rotation, 0 for never
+	RotationDays int `json:"rotationDays,omitempty" validate:"min=0,max=3650"`
 }
 
 type ResponseAccount struct {
@@ -16,6 +27,11 @@ type ResponseAccount struct {
 	Url        string `json:"url"`
 	Notes      string `json:"notes"`
 	Strength   int    `json:"strength"`
+	Reprompt   bool   `json:"reprompt"`
+	// The passphrase appears in a known breach
+	Breached bool `json:"breached"`
+	// The rotation interval of the account has passed
+	RotationDue bool `json:"rotationDue"`
 }
 
 type ResponseAccountDetails struct {
@@ -26,4 +42,60 @@ type ResponseAccountDetails struct {
 	Passphrase string `json:"passphrase"`
 	Notes      string `json:"notes"`
 	Strength   int    `json:"strength"`
+	Totp       string `json:"totp"`
+	Reprompt   bool   `json:"reprompt"`
+	Breached   bool   `json:"breached"`
+	// Only one of them is set, the profile is looked up by name
+	Policy        *PassphrasePolicy `json:"policy,omitempty"`
+	PolicyProfile string            `json:"policyProfile,omitempty"`
+	// Rules of the policy the passphrase breaks, it is saved anyway
+	Warnings []string `json:"warnings,omitempty"`
+	// Unknown for accounts saved before the times were tracked
+	CreatedAt           *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt           *time.Time `json:"updatedAt,omitempty"`
+	PassphraseChangedAt *time.Time `json:"passphraseChangedAt,omitempty"`
+	RotationDays        int        `json:"rotationDays"`
+	RotationDue         bool       `json:"rotationDue"`
+	// Empty without a rotation interval or when the passphrase age is unknown
+	RotationDueAt *time.Time `json:"rotationDueAt,omitempty"`
+}
+
+// An account whose rotation interval has passed
+type ResponseAccountDue struct {
+	ResponseAccount
+	RotationDays        int        `json:"rotationDays"`
+	PassphraseChangedAt *time.Time `json:"passphraseChangedAt"`
+	RotationDueAt       *time.Time `json:"rotationDueAt"`
+}
+
+type ResponseAccountUpdate struct {
+	Warnings []string `json:"warnings"`
+}
+
+// A previous passphrase of the account, revealed on its own
+type ResponsePassphraseHistory struct {
+	Id         string    `json:"id"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
+
+// Remaining is 0 for counter based (HOTP) codes
+type ResponseAccountTotp struct {
+	Code      string `json:"code"`
+	Remaining int    `json:"remaining"`
+	Period    int    `json:"period"`
+	Digits    int    `json:"digits"`
+	Type      string `json:"type"`
+}
+
+type ResponseBreachCheck struct {
+	Checked  int `json:"checked"`
+	Breached int `json:"breached"`
+	// Accounts that could not be checked, the source was unreachable
+	Failed int `json:"failed"`
+}
+
+// The local breach dataset, Source is the configured BREACH_SOURCE
+type ResponseBreachDataset struct {
+	Source   string `json:"source"`
+	Prefixes int    `json:"prefixes"`
 }
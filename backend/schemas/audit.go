@@ -0,0 +1,23 @@
+package schemas
+
+import "time"
+
+type ResponseAuditEvent struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Event     string    `json:"event"`
+	AccountId string    `json:"accountId,omitempty"`
+	Address   string    `json:"address"`
+	SessionId string    `json:"sessionId,omitempty"`
+	TokenId   int       `json:"tokenId,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	Hash      string    `json:"hash"`
+}
+
+// Problem describes the first event that breaks the chain
+type ResponseAuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+}
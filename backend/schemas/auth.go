@@ -1,5 +1,7 @@
 package schemas
 
+import "time"
+
 type ResponseIsInitialized struct {
 	Initialized bool `json:"initialized"`
 }
@@ -20,14 +22,41 @@ type RequestAuthLogin struct {
 	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
 }
 
+// Without a token, the login has to be completed with a second factor
 type ResponseAuthLogin struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+}
+
+// Code is either a TOTP code or a recovery code
+type RequestAuthLoginTwoFactor struct {
+	Challenge string `json:"challenge" validate:"required"`
+	Code      string `json:"code" validate:"required,max=32"`
 }
 
 type RequestAuthUpdatePassphrase struct {
 	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
 }
 
+// The passphrase is asked again before a new recovery key replaces the current one
+type RequestAuthRegenerateRecovery struct {
+	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
+}
+
+// Re-entering the passphrase unlocks sensitive operations for a while
+type RequestAuthReauthenticate struct {
+	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
+}
+
+type ResponseAuthReauthenticate struct {
+	Until time.Time `json:"until"`
+}
+
+type ResponseAuthRecoveryKey struct {
+	Recovery string `json:"recovery"`
+}
+
 type RequestAuthRecover struct {
 	RecoveryKey   string `json:"recoveryKey"`
 	NewPassphrase string `json:"newPassphrase"`
@@ -0,0 +1,54 @@
+package schemas
+
+import "time"
+
+// The .passenger file. Data holds the sealed BackupPayload, the other
+// fields are authenticated with it.
+type BackupFile struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      string    `json:"data"`
+}
+
+type BackupPayload struct {
+	Accounts []BackupAccount `json:"accounts"`
+	Manifest BackupManifest  `json:"manifest"`
+}
+
+type BackupAccount struct {
+	Platform   string `json:"platform"`
+	Identifier string `json:"identifier"`
+	Passphrase string `json:"passphrase"`
+	Url        string `json:"url"`
+	Notes      string `json:"notes"`
+	Totp       string `json:"totp"`
+	Reprompt   bool   `json:"reprompt"`
+	// The rules of a profile are copied, the vault restored to may not have it
+	Policy       *PassphrasePolicy `json:"policy,omitempty"`
+	RotationDays int               `json:"rotationDays,omitempty"`
+	// Keeps the rotation reminders, restored passphrases are otherwise new
+	PassphraseChangedAt *time.Time `json:"passphraseChangedAt,omitempty"`
+}
+
+// Digest is the SHA-256 of the JSON encoded accounts
+type BackupManifest struct {
+	Accounts int    `json:"accounts"`
+	Digest   string `json:"digest"`
+}
+
+type RequestBackupCreate struct {
+	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
+}
+
+// Merge keeps the accounts of the vault, replace deletes them first
+type RequestBackupRestore struct {
+	Passphrase string `validate:"required,max=128"`
+	Mode       string `validate:"required,oneof=merge replace"`
+}
+
+type ResponseBackupRestore struct {
+	Restored int `json:"restored"`
+	// Accounts of the backup that already exist in the vault
+	Skipped int `json:"skipped"`
+}
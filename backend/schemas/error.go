@@ -3,7 +3,9 @@ package schemas
 type APIError struct {
 	Code    string `json:"code"`
 	Message string `json:"message,omitempty"`
-	Stack   error  `json:"-"`
+	// Seconds before the request may be retried, sent as the Retry-After header
+	RetryAfter int   `json:"retryAfter,omitempty"`
+	Stack      error `json:"-"`
 }
 
 func (error *APIError) Error() string {
@@ -36,4 +38,21 @@ const (
 	ErrInvalidPlatform          APIErrorCode = "INVALID_PLATFORM"
 	ErrAccountNotFound          APIErrorCode = "ACCOUNT_NOT_FOUND"
 	ErrInvalidLength            APIErrorCode = "INVALID_LENGTH"
+	ErrVaultLocked              APIErrorCode = "VAULT_LOCKED"
+	ErrRotationInProgress       APIErrorCode = "ROTATION_IN_PROGRESS"
+	ErrTwoFactorAlreadyEnabled  APIErrorCode = "TWO_FACTOR_ALREADY_ENABLED"
+	ErrTwoFactorNotEnabled      APIErrorCode = "TWO_FACTOR_NOT_ENABLED"
+	ErrTotpNotFound             APIErrorCode = "TOTP_NOT_FOUND"
+	ErrTotpCounterChanged       APIErrorCode = "TOTP_COUNTER_CHANGED"
+	ErrTooManyAttempts          APIErrorCode = "TOO_MANY_ATTEMPTS"
+	ErrSessionNotFound          APIErrorCode = "SESSION_NOT_FOUND"
+	ErrTokenNotFound            APIErrorCode = "TOKEN_NOT_FOUND"
+	ErrInsufficientScope        APIErrorCode = "INSUFFICIENT_SCOPE"
+	ErrReauthenticationRequired APIErrorCode = "REAUTHENTICATION_REQUIRED"
+	ErrInvalidBackup            APIErrorCode = "INVALID_BACKUP"
+	ErrBreachCheckDisabled      APIErrorCode = "BREACH_CHECK_DISABLED"
+	ErrPayloadTooLarge          APIErrorCode = "PAYLOAD_TOO_LARGE"
+	ErrPolicyNotFound           APIErrorCode = "POLICY_NOT_FOUND"
+	ErrPolicyInUse              APIErrorCode = "POLICY_IN_USE"
+	ErrHistoryNotFound          APIErrorCode = "HISTORY_NOT_FOUND"
 )
@@ -1,7 +1,27 @@
 package schemas
 
+// Rules for character passphrases, see generator.Policy
+type GeneratePolicy struct {
+	Length           int            `json:"length,omitempty"`
+	Sets             []string       `json:"sets,omitempty"`
+	Minimums         map[string]int `json:"minimums,omitempty"`
+	ExcludeAmbiguous bool           `json:"excludeAmbiguous,omitempty"`
+	Symbols          string         `json:"symbols,omitempty"`
+	Forbidden        string         `json:"forbidden,omitempty"`
+	Prefix           string         `json:"prefix,omitempty"`
+	Pattern          string         `json:"pattern,omitempty"`
+}
+
 type ResponseGenerate struct {
 	Generated string `json:"generated"`
+	Mode      string `json:"mode"`
+	// Bits of randomness the passphrase was generated with
+	Entropy float64 `json:"entropy"`
+}
+
+type ResponseWordlist struct {
+	Name  string `json:"name"`
+	Words int    `json:"words"`
 }
 
 type RequestAlternate struct {
@@ -11,3 +31,32 @@ type RequestAlternate struct {
 type ResponseAlternate struct {
 	Alternative string `json:"alternative" `
 }
+
+// The user inputs, such as the platform and identifier, make passphrases containing them weaker
+type RequestStrength struct {
+	Passphrase string   `json:"passphrase" validate:"required"`
+	UserInputs []string `json:"userInputs"`
+}
+
+// A part of the passphrase that follows a guessable pattern
+type StrengthMatch struct {
+	Pattern    string  `json:"pattern"`
+	Token      string  `json:"token"`
+	Guesses    float64 `json:"guesses"`
+	Dictionary string  `json:"dictionary,omitempty"`
+	Reversed   bool    `json:"reversed,omitempty"`
+	L33t       bool    `json:"l33t,omitempty"`
+	Graph      string  `json:"graph,omitempty"`
+}
+
+type ResponseStrength struct {
+	Score        int             `json:"score"`
+	MaxScore     int             `json:"maxScore"`
+	Version      int             `json:"version"`
+	Guesses      float64         `json:"guesses"`
+	GuessesLog10 float64         `json:"guessesLog10"`
+	Entropy      float64         `json:"entropy"`
+	Warning      string          `json:"warning"`
+	Suggestions  []string        `json:"suggestions"`
+	Matches      []StrengthMatch `json:"matches"`
+}
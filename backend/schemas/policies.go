@@ -0,0 +1,27 @@
+package schemas
+
+import "time"
+
+// Rules of a site for its passphrases, every field is optional.
+// Classes are lowers, uppers, numbers and symbols.
+type PassphrasePolicy struct {
+	MinLength int `json:"minLength,omitempty" validate:"omitempty,min=1,max=4096"`
+	MaxLength int `json:"maxLength,omitempty" validate:"omitempty,min=1,max=4096"`
+	// Allowed classes, every class when empty
+	Sets []string `json:"sets,omitempty" validate:"omitempty,dive,oneof=lowers uppers numbers symbols"`
+	// Classes a passphrase needs at least one character of
+	Required []string `json:"required,omitempty" validate:"omitempty,dive,oneof=lowers uppers numbers symbols"`
+	// Allowed symbols, the default symbols of the generator when empty
+	Symbols string `json:"symbols,omitempty" validate:"omitempty,max=256"`
+	// Characters a passphrase can't contain
+	Forbidden string `json:"forbidden,omitempty" validate:"omitempty,max=256"`
+}
+
+// A named policy shared by accounts, Accounts is how many use it
+type ResponsePolicyProfile struct {
+	Name      string           `json:"name"`
+	Policy    PassphrasePolicy `json:"policy"`
+	Accounts  int              `json:"accounts"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
@@ -0,0 +1,32 @@
+package schemas
+
+import "time"
+
+// An account in a finding of the security report, without its passphrase
+type ReportAccount struct {
+	Id         string `json:"id"`
+	Platform   string `json:"platform"`
+	Identifier string `json:"identifier"`
+	Url        string `json:"url"`
+	Strength   int    `json:"strength"`
+	// Nil for accounts saved before passphrase ages were tracked
+	PassphraseChangedAt *time.Time `json:"passphraseChangedAt"`
+}
+
+// Accounts sharing the same passphrase
+type ReportReusedGroup struct {
+	Accounts []ReportAccount `json:"accounts"`
+}
+
+// Score goes from 0 to 100, a vault without findings scores 100
+type ResponseSecurityReport struct {
+	Score       int                 `json:"score"`
+	Accounts    int                 `json:"accounts"`
+	MaxAgeDays  int                 `json:"maxAgeDays"`
+	Reused      []ReportReusedGroup `json:"reused"`
+	Weak        []ReportAccount     `json:"weak"`
+	Breached    []ReportAccount     `json:"breached"`
+	Old         []ReportAccount     `json:"old"`
+	InsecureUrl []ReportAccount     `json:"insecureUrl"`
+	MissingUrl  []ReportAccount     `json:"missingUrl"`
+}
@@ -0,0 +1,19 @@
+package schemas
+
+import "time"
+
+type ResponseSession struct {
+	Id         string    `json:"id"`
+	Name       string    `json:"name"`
+	UserAgent  string    `json:"userAgent"`
+	Address    string    `json:"address"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// The session making the request
+	Current bool `json:"current"`
+}
+
+type RequestSessionRename struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
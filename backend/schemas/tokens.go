@@ -0,0 +1,28 @@
+package schemas
+
+import "time"
+
+type RequestTokenCreate struct {
+	Label  string   `json:"label" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=accounts:read accounts:write transfer generate export"`
+}
+
+type RequestTokenRename struct {
+	Label string `json:"label" validate:"required,max=64"`
+}
+
+type ResponseToken struct {
+	Id     int      `json:"id"`
+	Label  string   `json:"label"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// Nil until the token is used for the first time
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// The secret is only returned once, when the token is created
+type ResponseTokenCreated struct {
+	ResponseToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,24 @@
+package schemas
+
+type ResponseTwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+type ResponseTwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+type RequestTwoFactorConfirm struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type ResponseTwoFactorRecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type RequestTwoFactorDisable struct {
+	Passphrase string `json:"passphrase" validate:"required,min=12,max=128"`
+}
@@ -0,0 +1,19 @@
+package schemas
+
+import "time"
+
+type ResponseVaultKey struct {
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Active    bool      `json:"active"`
+}
+
+type ResponseRotationStatus struct {
+	Running     bool       `json:"running"`
+	Processed   int        `json:"processed"`
+	Total       int        `json:"total"`
+	ActiveKeyId int        `json:"activeKeyId"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
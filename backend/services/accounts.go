@@ -1,25 +1,37 @@
 package services
 
 import (
+	"passenger-go/backend/models"
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/repositories"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/otp"
 	"passenger-go/backend/utilities/strength"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
 
 type AccountsService struct {
-	repository *repositories.AccountsRepository
-	validator  *validator.Validate
+	repository      *repositories.AccountsRepository
+	validator       *validator.Validate
+	auditService    *AuditService
+	sessionsService *SessionsService
+	breachService   *BreachService
+	policiesService *PoliciesService
 }
 
 func NewAccountsService() *AccountsService {
 	return &AccountsService{
-		repository: repositories.NewAccountsRepository(),
-		validator:  pipes.GetValidator(),
+		repository:      repositories.NewAccountsRepository(),
+		validator:       pipes.GetValidator(),
+		auditService:    NewAuditService(),
+		sessionsService: NewSessionsService(),
+		breachService:   NewBreachService(),
+		policiesService: NewPoliciesService(),
 	}
 }
 
@@ -44,93 +56,380 @@ func (service *AccountsService) GetAccounts() ([]*schemas.ResponseAccount, error
 	return decryptedAccounts, nil
 }
 
+// Finds accounts with exactly the given platform and/or identifier
+func (service *AccountsService) FindAccounts(
+	platform string,
+	identifier string,
+) ([]*schemas.ResponseAccount, error) {
+	platformIndex, identifierIndex := "", ""
+
+	var err error
+	if platform != "" {
+		platformIndex, err = encrypt.BlindIndex(platform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if identifier != "" {
+		identifierIndex, err = encrypt.BlindIndex(identifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accounts, err := service.repository.FindAccountsWithEncryptedData(platformIndex, identifierIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedAccounts := make([]*schemas.ResponseAccount, len(accounts))
+	for i, account := range accounts {
+		decrypted, err := service.decryptAccountRowToResponse(account)
+		if err != nil {
+			return nil, err
+		}
+		decryptedAccounts[i] = decrypted
+	}
+
+	return decryptedAccounts, nil
+}
+
+// The details include the passphrase, so reading them is audited as a reveal
 func (service *AccountsService) GetAccount(
 	id string,
+	actor *models.Actor,
 ) (*schemas.ResponseAccountDetails, error) {
-	account, err := service.repository.GetAccountWithEncryptedData(id)
+	row, err := service.repository.GetAccountWithEncryptedData(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return service.decryptAccountDetailsRowToResponse(account)
+	err = service.sessionsService.RequireRevealReauthentication(actor, row.Reprompt)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := service.decryptAccountDetailsRowToResponse(row)
+	if err != nil {
+		return nil, err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountReveal, account.Id, "details")
+	return account, nil
 }
 
 func (service *AccountsService) GetPassphrase(
 	id string,
+	actor *models.Actor,
 ) (string, error) {
-	passphrase, err := service.repository.GetPassphrase(id)
+	id, err := normalizeAccountId(id)
 	if err != nil {
 		return "", err
 	}
 
-	return encrypt.Decrypt(passphrase)
+	if err := service.requireReveal(id, actor); err != nil {
+		return "", err
+	}
+
+	encryptedPassphrase, err := service.repository.GetPassphrase(id)
+	if err != nil {
+		return "", err
+	}
+
+	passphrase, err := encrypt.Decrypt(encryptedPassphrase, accountField("passphrase", id))
+	if err != nil {
+		return "", err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountReveal, id, "passphrase")
+	return passphrase, nil
+}
+
+func (service *AccountsService) accountDetails(
+	id string,
+) (*schemas.ResponseAccountDetails, error) {
+	account, err := service.repository.GetAccountWithEncryptedData(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.decryptAccountDetailsRowToResponse(account)
+}
+
+// Asks for sudo mode before revealing an account that needs it
+func (service *AccountsService) requireReveal(id string, actor *models.Actor) error {
+	reprompt, err := service.repository.GetReprompt(id)
+	if err != nil {
+		return err
+	}
+
+	return service.sessionsService.RequireRevealReauthentication(actor, reprompt)
+}
+
+// Returns the current one-time code of the account.
+// HOTP codes advance the stored counter, so every call returns a new code.
+func (service *AccountsService) GetTotp(
+	id string,
+	actor *models.Actor,
+) (*schemas.ResponseAccountTotp, error) {
+	id, err := normalizeAccountId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.requireReveal(id, actor); err != nil {
+		return nil, err
+	}
+
+	encryptedTotp, err := service.repository.GetTotp(id)
+	if err != nil {
+		return nil, err
+	}
+	if encryptedTotp == "" {
+		return nil, schemas.NewAPIError(
+			schemas.ErrTotpNotFound,
+			"The account has no TOTP secret",
+			nil,
+		)
+	}
+
+	uri, err := encrypt.Decrypt(encryptedTotp, accountField("totp", id))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := otp.ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type == otp.TypeHOTP {
+		return service.nextHotp(id, encryptedTotp, key)
+	}
+
+	now := time.Now()
+	code, err := key.Code(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseAccountTotp{
+		Code:      code,
+		Remaining: key.Remaining(now),
+		Period:    key.Period,
+		Digits:    key.Digits,
+		Type:      key.Type,
+	}, nil
+}
+
+// Uses the code at the stored counter and saves the incremented counter
+func (service *AccountsService) nextHotp(
+	id string,
+	encryptedTotp string,
+	key *otp.Key,
+) (*schemas.ResponseAccountTotp, error) {
+	code, err := key.CodeAt(key.Counter)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Counter++
+	advanced, err := encrypt.Encrypt(key.URI(), accountField("totp", id))
+	if err != nil {
+		return nil, err
+	}
+
+	// A concurrent request already used this counter
+	updated, err := service.repository.UpdateTotp(id, encryptedTotp, advanced)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, schemas.NewAPIError(
+			schemas.ErrTotpCounterChanged,
+			"The HOTP counter changed, please try again",
+			nil,
+		)
+	}
+
+	return &schemas.ResponseAccountTotp{
+		Code:   code,
+		Digits: key.Digits,
+		Type:   key.Type,
+	}, nil
 }
 
 func (service *AccountsService) CreateAccount(
 	body *schemas.RequestAccountsUpsert,
+	actor *models.Actor,
 ) (*schemas.ResponseAccountDetails, error) {
 	err := service.validator.Struct(body)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate strength before encryption
-	strengthScore, err := strength.CalculateStrength(body.Passphrase)
+	// A passphrase breaking the policy is saved with warnings, the site has the last word
+	policy, err := service.policiesService.upsertPolicy(body)
 	if err != nil {
 		return nil, err
 	}
 
-	// Encrypt all fields
-	encryptedBody, err := service.encryptRequestBodyWithStrength(body, strengthScore)
+	// Calculate strength before encryption
+	strengthScore, err := accountStrength(body)
 	if err != nil {
 		return nil, err
 	}
 
-	account, err := service.repository.CreateAccount(encryptedBody)
+	// Encrypt all fields once the row id is known
+	now := time.Now()
+	id, err := service.repository.CreateAccount(func(id string) (*repositories.EncryptedAccountUpsert, error) {
+		account, err := service.encryptRequestBodyWithStrength(id, body, strengthScore)
+		if err != nil {
+			return nil, err
+		}
+
+		account.PassphraseChangedAt = now
+		return account, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	service.auditService.Record(actor, models.AuditAccountCreate, id, "")
+	service.breachService.CheckLater(id)
+
+	rotationDueAt, _ := rotationDue(body.RotationDays, now, now)
+
 	// Return decrypted account
 	return &schemas.ResponseAccountDetails{
-		Id:         account.Id,
-		Platform:   body.Platform,
-		Identifier: body.Identifier,
-		Passphrase: body.Passphrase,
-		Url:        body.Url,
-		Notes:      body.Notes,
-		Strength:   strengthScore,
+		Id:            id,
+		Platform:      body.Platform,
+		Identifier:    body.Identifier,
+		Passphrase:    body.Passphrase,
+		Url:           body.Url,
+		Notes:         body.Notes,
+		Strength:      strengthScore,
+		Totp:          normalizedTotp(body.Totp),
+		Reprompt:      body.Reprompt,
+		Policy:        body.Policy,
+		PolicyProfile: body.PolicyProfile,
+		Warnings:      policyViolations(body.Passphrase, policy),
+
+		CreatedAt:           &now,
+		UpdatedAt:           &now,
+		PassphraseChangedAt: &now,
+		RotationDays:        body.RotationDays,
+		RotationDueAt:       rotationDueAt,
 	}, nil
 }
 
 func (service *AccountsService) UpdateAccount(
 	id string,
 	body *schemas.RequestAccountsUpsert,
-) error {
+	actor *models.Actor,
+) ([]string, error) {
+	id, err := normalizeAccountId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clearing the flag would let the account be revealed without sudo mode
+	if !body.Reprompt {
+		reprompt, err := service.repository.GetReprompt(id)
+		if err != nil {
+			return nil, err
+		}
+		if reprompt {
+			if err := service.sessionsService.RequireRevealReauthentication(actor, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	warnings, err := service.updateAccount(id, body, "")
+	if err != nil {
+		return nil, err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountUpdate, id, "")
+	return warnings, nil
+}
+
+// A replaced passphrase goes to the history, restoredId is the history entry
+// the new passphrase comes from
+func (service *AccountsService) updateAccount(
+	id string,
+	body *schemas.RequestAccountsUpsert,
+	restoredId string,
+) ([]string, error) {
 	err := service.validator.Struct(body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	policy, err := service.policiesService.upsertPolicy(body)
+	if err != nil {
+		return nil, err
 	}
 
 	// Calculate strength before encryption
-	strengthScore, err := strength.CalculateStrength(body.Passphrase)
+	strengthScore, err := accountStrength(body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Ciphertexts are random, so the stored passphrase is decrypted to tell whether it changed
+	encryptedPassphrase, err := service.repository.GetPassphrase(id)
+	if err != nil {
+		return nil, err
+	}
+
+	previousPassphrase, err := encrypt.Decrypt(encryptedPassphrase, accountField("passphrase", id))
+	if err != nil {
+		return nil, err
 	}
 
 	// Encrypt all fields
-	encryptedBody, err := service.encryptRequestBodyWithStrength(body, strengthScore)
+	encryptedBody, err := service.encryptRequestBodyWithStrength(id, body, strengthScore)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return service.repository.UpdateAccount(id, encryptedBody)
+	history := newHistoryUpsert(restoredId)
+	if body.Passphrase != previousPassphrase {
+		history.Reprompt, err = service.repository.GetReprompt(id)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedBody.PassphraseChanged = true
+		encryptedBody.PassphraseChangedAt = time.Now()
+		history.ReplacedAt = encryptedBody.PassphraseChangedAt
+		history.Seal = func(historyId string) (string, error) {
+			return encrypt.Encrypt(previousPassphrase, historyField(historyId))
+		}
+	}
+
+	err = service.repository.UpdateAccount(id, encryptedBody, history)
+	if err != nil {
+		return nil, err
+	}
+
+	service.breachService.CheckLater(id)
+	return policyViolations(body.Passphrase, policy), nil
 }
 
 func (service *AccountsService) DeleteAccount(
 	id string,
+	actor *models.Actor,
 ) error {
-	return service.repository.DeleteAccount(id)
+	err := service.repository.DeleteAccount(id)
+	if err != nil {
+		return err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountDelete, id, "")
+	return nil
 }
 
 func (service *AccountsService) GetUniqueIdentifiers() ([]string, error) {
@@ -141,84 +440,118 @@ func (service *AccountsService) GetUniqueIdentifiers() ([]string, error) {
 
 	// Decrypt all identifiers
 	decryptedIdentifiers := make([]string, len(encryptedIdentifiers))
-	for i, encryptedId := range encryptedIdentifiers {
-		decrypted, err := encrypt.DecryptDeterministic(encryptedId)
+	for i, row := range encryptedIdentifiers {
+		decrypted, err := encrypt.Decrypt(row.Identifier, accountField("identifier", row.Id))
 		if err != nil {
 			return nil, err
 		}
 		decryptedIdentifiers[i] = decrypted
 	}
 
+	// Ciphertexts are random, so they can only be sorted after decryption
+	sort.Strings(decryptedIdentifiers)
+
 	return decryptedIdentifiers, nil
 }
 
 // Helper function to encrypt request body fields with strength
-func (service *AccountsService) encryptRequestBodyWithStrength(body *schemas.RequestAccountsUpsert, strengthScore int) (*schemas.RequestAccountsUpsert, error) {
-	encryptedPlatform, err := encrypt.EncryptDeterministic(body.Platform)
+func (service *AccountsService) encryptRequestBodyWithStrength(id string, body *schemas.RequestAccountsUpsert, strengthScore int) (*repositories.EncryptedAccountUpsert, error) {
+	encryptedPlatform, err := encrypt.Encrypt(body.Platform, accountField("platform", id))
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedIdentifier, err := encrypt.EncryptDeterministic(body.Identifier)
+	encryptedIdentifier, err := encrypt.Encrypt(body.Identifier, accountField("identifier", id))
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedPassphrase, err := encrypt.Encrypt(body.Passphrase)
+	encryptedPassphrase, err := encrypt.Encrypt(body.Passphrase, accountField("passphrase", id))
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedUrl, err := encrypt.EncryptDeterministic(body.Url)
+	encryptedUrl, err := encrypt.Encrypt(body.Url, accountField("url", id))
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedNotes, err := encrypt.EncryptDeterministic(body.Notes)
+	encryptedNotes, err := encrypt.Encrypt(body.Notes, accountField("notes", id))
 	if err != nil {
 		return nil, err
 	}
 
 	// Encrypt strength as string
-	encryptedStrength, err := encrypt.EncryptDeterministic(strconv.Itoa(strengthScore))
+	encryptedStrength, err := encrypt.Encrypt(strconv.Itoa(strengthScore), accountField("strength", id))
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedTotp, err := encryptTotp(body.Totp, id)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedPolicy, err := encryptPolicy(body.Policy, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return &schemas.RequestAccountsUpsert{
-		Platform:   encryptedPlatform,
-		Identifier: encryptedIdentifier,
-		Passphrase: encryptedPassphrase,
-		Url:        encryptedUrl,
-		Notes:      encryptedNotes,
-		Strength:   encryptedStrength,
+	// Blind indexes enforce uniqueness without revealing equal values
+	platformIndex, err := encrypt.BlindIndex(body.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	identifierIndex, err := encrypt.BlindIndex(body.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repositories.EncryptedAccountUpsert{
+		RequestAccountsUpsert: schemas.RequestAccountsUpsert{
+			Platform:      encryptedPlatform,
+			Identifier:    encryptedIdentifier,
+			Passphrase:    encryptedPassphrase,
+			Url:           encryptedUrl,
+			Notes:         encryptedNotes,
+			Strength:      encryptedStrength,
+			Totp:          encryptedTotp,
+			Reprompt:      body.Reprompt,
+			PolicyProfile: body.PolicyProfile,
+			RotationDays:  body.RotationDays,
+		},
+		PlatformIndex:   platformIndex,
+		IdentifierIndex: identifierIndex,
+		StrengthVersion: strength.Version,
+		EncryptedPolicy: encryptedPolicy,
 	}, nil
 }
 
 // Helper function to decrypt account row data
 func (service *AccountsService) decryptAccountRowToResponse(account *repositories.EncryptedAccountRow) (*schemas.ResponseAccount, error) {
-	decryptedPlatform, err := encrypt.DecryptDeterministic(account.Platform)
+	decryptedPlatform, err := encrypt.Decrypt(account.Platform, accountField("platform", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedIdentifier, err := encrypt.DecryptDeterministic(account.Identifier)
+	decryptedIdentifier, err := encrypt.Decrypt(account.Identifier, accountField("identifier", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedUrl, err := encrypt.DecryptDeterministic(account.Url)
+	decryptedUrl, err := encrypt.Decrypt(account.Url, accountField("url", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedNotes, err := encrypt.DecryptDeterministic(account.Notes)
+	decryptedNotes, err := encrypt.Decrypt(account.Notes, accountField("notes", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
 	// Decrypt and convert strength from string to int
-	decryptedStrengthStr, err := encrypt.DecryptDeterministic(account.EncryptedStrength)
+	decryptedStrengthStr, err := encrypt.Decrypt(account.EncryptedStrength, accountField("strength", account.Id))
 	if err != nil {
 		return nil, err
 	}
@@ -228,45 +561,55 @@ func (service *AccountsService) decryptAccountRowToResponse(account *repositorie
 		return nil, err
 	}
 
+	breached, err := decryptBreached(account.EncryptedBreached, account.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rotationIsDue := rotationDue(account.RotationDays, account.PassphraseChangedAt, time.Now())
+
 	return &schemas.ResponseAccount{
-		Id:         account.Id,
-		Platform:   decryptedPlatform,
-		Identifier: decryptedIdentifier,
-		Url:        decryptedUrl,
-		Notes:      decryptedNotes,
-		Strength:   strengthScore,
+		Id:          account.Id,
+		Platform:    decryptedPlatform,
+		Identifier:  decryptedIdentifier,
+		Url:         decryptedUrl,
+		Notes:       decryptedNotes,
+		Strength:    strengthScore,
+		Reprompt:    account.Reprompt,
+		Breached:    breached,
+		RotationDue: rotationIsDue,
 	}, nil
 }
 
 // Helper function to decrypt account details row data
 func (service *AccountsService) decryptAccountDetailsRowToResponse(account *repositories.EncryptedAccountDetailsRow) (*schemas.ResponseAccountDetails, error) {
-	decryptedPlatform, err := encrypt.DecryptDeterministic(account.Platform)
+	decryptedPlatform, err := encrypt.Decrypt(account.Platform, accountField("platform", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedIdentifier, err := encrypt.DecryptDeterministic(account.Identifier)
+	decryptedIdentifier, err := encrypt.Decrypt(account.Identifier, accountField("identifier", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedPassphrase, err := encrypt.Decrypt(account.Passphrase)
+	decryptedPassphrase, err := encrypt.Decrypt(account.Passphrase, accountField("passphrase", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedUrl, err := encrypt.DecryptDeterministic(account.Url)
+	decryptedUrl, err := encrypt.Decrypt(account.Url, accountField("url", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedNotes, err := encrypt.DecryptDeterministic(account.Notes)
+	decryptedNotes, err := encrypt.Decrypt(account.Notes, accountField("notes", account.Id))
 	if err != nil {
 		return nil, err
 	}
 
 	// Decrypt and convert strength from string to int
-	decryptedStrengthStr, err := encrypt.DecryptDeterministic(account.EncryptedStrength)
+	decryptedStrengthStr, err := encrypt.Decrypt(account.EncryptedStrength, accountField("strength", account.Id))
 	if err != nil {
 		return nil, err
 	}
@@ -276,13 +619,109 @@ func (service *AccountsService) decryptAccountDetailsRowToResponse(account *repo
 		return nil, err
 	}
 
+	decryptedTotp := ""
+	if account.Totp != "" {
+		decryptedTotp, err = encrypt.Decrypt(account.Totp, accountField("totp", account.Id))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	breached, err := decryptBreached(account.EncryptedBreached, account.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := decryptPolicy(account.EncryptedPolicy, account.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	rotationDueAt, rotationIsDue := rotationDue(account.RotationDays, account.PassphraseChangedAt, time.Now())
+
 	return &schemas.ResponseAccountDetails{
-		Id:         account.Id,
-		Platform:   decryptedPlatform,
-		Identifier: decryptedIdentifier,
-		Passphrase: decryptedPassphrase,
-		Url:        decryptedUrl,
-		Notes:      decryptedNotes,
-		Strength:   strengthScore,
+		Id:            account.Id,
+		Platform:      decryptedPlatform,
+		Identifier:    decryptedIdentifier,
+		Passphrase:    decryptedPassphrase,
+		Url:           decryptedUrl,
+		Notes:         decryptedNotes,
+		Strength:      strengthScore,
+		Totp:          decryptedTotp,
+		Reprompt:      account.Reprompt,
+		Breached:      breached,
+		Policy:        policy,
+		PolicyProfile: account.PolicyProfile,
+
+		CreatedAt:           knownTime(account.CreatedAt),
+		UpdatedAt:           knownTime(account.UpdatedAt),
+		PassphraseChangedAt: knownTime(account.PassphraseChangedAt),
+		RotationDays:        account.RotationDays,
+		RotationDue:         rotationIsDue,
+		RotationDueAt:       rotationDueAt,
 	}, nil
 }
+
+// The id is part of the associated data, so it must be written the way the
+// database returns it: "01" finds the same row as "1" but wouldn't decrypt
+func normalizeAccountId(id string) (string, error) {
+	rowId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrAccountNotFound,
+			"Account not found",
+			nil,
+		)
+	}
+	return strconv.FormatInt(rowId, 10), nil
+}
+
+// Stores the secret as a canonical otpauth:// URI, accounts without one keep an empty column
+func encryptTotp(value string, id string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	key, err := otp.Parse(value)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Invalid TOTP secret or otpauth URI",
+			err,
+		)
+	}
+
+	return encrypt.Encrypt(key.URI(), accountField("totp", id))
+}
+
+// Accounts that were not checked yet have an empty column
+func decryptBreached(value string, id string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	decrypted, err := encrypt.Decrypt(value, accountField("breached", id))
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(decrypted)
+}
+
+// Returns the URI that is stored for the secret, validation already rejected invalid ones
+func normalizedTotp(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	key, err := otp.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return key.URI()
+}
+
+// Binds a ciphertext to its column and row of the accounts table
+func accountField(column string, id string) []byte {
+	return encrypt.AssociatedData("accounts", column, id)
+}
@@ -0,0 +1,175 @@
+/**
+ * Tamper-evident audit log.
+ * Services record security relevant events: logins, reveals and changes
+ * of accounts, imports, exports, passphrase changes and recoveries.
+ * Events are only appended. Each one is sealed with an HMAC over the
+ * previous event's HMAC, so editing or deleting an event breaks the chain
+ * from that point on, and Verify reports where. Events never contain
+ * account fields, which are encrypted, only the id of the account.
+ */
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"passenger-go/backend/models"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/logger"
+	"sync"
+	"time"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// Appending reads the last event and writes the next one, which must not interleave
+var auditMutex sync.Mutex
+
+var errAuditChainBroken = errors.New("audit chain broken")
+
+type AuditService struct {
+	repository *repositories.AuditRepository
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{
+		repository: repositories.NewAuditRepository(),
+	}
+}
+
+// Appends an event. A failure is logged, it never fails the audited action.
+func (service *AuditService) Record(
+	actor *models.Actor,
+	event string,
+	accountId string,
+	details string,
+) {
+	if actor == nil {
+		actor = &models.Actor{}
+	}
+
+	auditEvent := &models.AuditEvent{
+		CreatedAt: time.Now(),
+		Event:     event,
+		AccountId: accountId,
+		Address:   actor.Address,
+		SessionId: actor.SessionId,
+		TokenId:   actor.TokenId,
+		Details:   details,
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	err := service.repository.AppendAuditEvent(auditEvent, func(previousHash string) string {
+		return encrypt.ChainAuditEntry(previousHash, auditEntry(auditEvent))
+	})
+	if err != nil {
+		log := logger.GetLogger()
+		log.Printf("Failed to record %s audit event: %v", event, err)
+	}
+}
+
+// Lists the matching events, newest first
+func (service *AuditService) List(filter *models.AuditFilter) ([]*schemas.ResponseAuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	filter.Limit = min(filter.Limit, auditMaxLimit)
+	filter.Offset = max(filter.Offset, 0)
+
+	events, err := service.repository.GetAuditEvents(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*schemas.ResponseAuditEvent, len(events))
+	for i, event := range events {
+		response[i] = &schemas.ResponseAuditEvent{
+			Id:        event.Id,
+			CreatedAt: event.CreatedAt,
+			Event:     event.Event,
+			AccountId: event.AccountId,
+			Address:   event.Address,
+			SessionId: event.SessionId,
+			TokenId:   event.TokenId,
+			Details:   event.Details,
+			Hash:      event.Hash,
+		}
+	}
+
+	return response, nil
+}
+
+// Walks the chain from the first event and reports the first one that was
+// deleted or modified. Events deleted from the end are detected with the
+// id sequence of the table.
+func (service *AuditService) Verify() (*schemas.ResponseAuditVerification, error) {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	result := &schemas.ResponseAuditVerification{}
+	expectedId := int64(1)
+	previousHash := ""
+
+	err := service.repository.WalkAuditChain(func(event *models.AuditEvent) error {
+		if event.Id != expectedId {
+			result.BrokenAt = expectedId
+			result.Problem = fmt.Sprintf("Event %d is missing", expectedId)
+			return errAuditChainBroken
+		}
+
+		if !encrypt.VerifyAuditEntry(previousHash, auditEntry(event), event.Hash) {
+			result.BrokenAt = event.Id
+			result.Problem = fmt.Sprintf("Event %d was modified", event.Id)
+			return errAuditChainBroken
+		}
+
+		previousHash = event.Hash
+		expectedId++
+		result.Checked++
+		return nil
+	})
+	if err != nil && err != errAuditChainBroken {
+		return nil, err
+	}
+
+	if result.Problem == "" {
+		sequence, err := service.repository.GetAuditSequence()
+		if err != nil {
+			return nil, err
+		}
+
+		if sequence == expectedId {
+			result.BrokenAt = expectedId
+			result.Problem = fmt.Sprintf("Event %d was deleted", expectedId)
+		} else if sequence > expectedId {
+			result.BrokenAt = expectedId
+			result.Problem = fmt.Sprintf("Events %d to %d were deleted", expectedId, sequence)
+		}
+	}
+
+	result.Valid = result.Problem == ""
+	return result, nil
+}
+
+// The sealed fields of an event, everything but its own hash
+func auditEntry(event *models.AuditEvent) []byte {
+	entry, _ := json.Marshal([]any{
+		event.Id,
+		event.CreatedAt.Unix(),
+		event.Event,
+		event.AccountId,
+		event.Address,
+		event.SessionId,
+		event.TokenId,
+		event.Details,
+	})
+	return entry
+}
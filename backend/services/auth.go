@@ -4,6 +4,12 @@
  * Service can create a user but cannot delete it.
  * JWT based stateless authentication is used.
  *
+ * Accounts are encrypted with a keyset of random data keys, sealed by a
+ * random root key. The root key is only stored wrapped by keys derived
+ * from the passphrase and the recovery key (and optionally by
+ * AES_GCM_SECRET). Logging in unwraps the keyset into the keyring for
+ * the lifetime of the session.
+ *
  * Register Flow:
  * 1. User requests to register
  * 2. Service creates a temporary user
@@ -19,19 +25,32 @@
 package services
 
 import (
+	"crypto/subtle"
+	"passenger-go/backend/models"
 	"passenger-go/backend/repositories"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/utilities/encrypt"
 	"passenger-go/backend/utilities/jwtoken"
+	"passenger-go/backend/utilities/keyring"
 )
 
 type AuthService struct {
-	repository *repositories.AuthRepository
+	repository      *repositories.AuthRepository
+	vaultRepository *repositories.VaultRepository
+	sessionsService *SessionsService
+	tokensService   *TokensService
+	auditService    *AuditService
+	strengthService *StrengthService
 }
 
 func NewAuthService() *AuthService {
 	return &AuthService{
-		repository: repositories.NewAuthRepository(),
+		repository:      repositories.NewAuthRepository(),
+		vaultRepository: repositories.NewVaultRepository(),
+		sessionsService: NewSessionsService(),
+		tokensService:   NewTokensService(),
+		auditService:    NewAuditService(),
+		strengthService: NewStrengthService(),
 	}
 }
 
@@ -59,11 +78,11 @@ func (service *AuthService) RegisterUser(passphrase string) (recoveryKey string,
 		)
 	}
 
-	encryptedPassphrase, err := encrypt.Encrypt(passphrase)
+	hashedPassphrase, err := encrypt.HashPassword(passphrase)
 	if err != nil {
 		return "", schemas.NewAPIError(
 			schemas.ErrEncryptionFailed,
-			"Couldn't encrypt passphrase",
+			"Couldn't hash passphrase",
 			err,
 		)
 	}
@@ -78,8 +97,28 @@ func (service *AuthService) RegisterUser(passphrase string) (recoveryKey string,
 		)
 	}
 
+	keyset, err := newKeyset()
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := wrapKeyset(keyset, passphrase, recoveryKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Only a hash of the recovery key is stored, it is shown to the user once
+	hashedRecoveryKey, err := encrypt.HashPassword(recoveryKey)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash recovery key",
+			err,
+		)
+	}
+
 	// Create a temporary user
-	err = service.repository.CreateUser(encryptedPassphrase, recoveryKey)
+	err = service.repository.CreateUser(hashedPassphrase, hashedRecoveryKey, keys)
 	if err != nil {
 		return "", err
 	}
@@ -105,7 +144,7 @@ func (service *AuthService) CompleteRegistration(recovery string) error {
 		)
 	}
 
-	if user.Recovery != recovery {
+	if !verifyRecoveryKey(recovery, user.Recovery) {
 		return schemas.NewAPIError(
 			schemas.ErrInvalidCredentials,
 			"Invalid recovery key",
@@ -116,50 +155,109 @@ func (service *AuthService) CompleteRegistration(recovery string) error {
 	return service.repository.ValidateUser()
 }
 
-// Generate a JWT token for the user
-func (service *AuthService) LoginUser(passphrase string) (string, error) {
+// Generate a JWT token for the user, or a challenge if a second factor is enabled
+func (service *AuthService) LoginUser(
+	passphrase string,
+	device *models.Device,
+) (*schemas.ResponseAuthLogin, error) {
 	user, err := service.repository.GetUser()
 	if err != nil {
-		return "", schemas.NewAPIError(
+		return nil, schemas.NewAPIError(
 			schemas.ErrNotInitializedYet,
 			"You haven't initialized the application yet",
 			err,
 		)
 	}
 
-	// Decrypt the stored passphrase
-	storedPassphrase, err := encrypt.Decrypt(user.Passphrase)
+	keyset, err := service.unwrapKeyset(user, passphrase)
 	if err != nil {
-		return "", schemas.NewAPIError(
-			schemas.ErrDecryptionFailed,
-			"Couldn't decrypt stored passphrase",
-			err,
-		)
+		service.recordFailure(models.AuditLoginFailure, device.Address, err, "passphrase")
+		return nil, err
 	}
+	defer keyset.Wipe()
 
-	// Compare the decrypted stored passphrase with the provided one
-	if storedPassphrase != passphrase {
-		return "", schemas.NewAPIError(
-			schemas.ErrInvalidCredentials,
-			"Invalid credentials",
-			nil,
-		)
+	err = service.syncEnvironmentKey(user, keyset.Root)
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := jwtoken.GenerateJWT(user.Id)
+	err = service.upgradeVault(keyset)
 	if err != nil {
-		return "", schemas.NewAPIError(
-			schemas.ErrJWTGenerationFailed,
-			"Failed to generate JWT",
-			err,
-		)
+		return nil, err
+	}
+
+	err = service.upgradeRecoveryKey(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactor.Enabled() {
+		challenge, err := pendingLogins.open(keyset)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrUnexpected,
+				"Failed to start two-factor login",
+				err,
+			)
+		}
+
+		return &schemas.ResponseAuthLogin{
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		}, nil
+	}
+
+	token, err := service.openSession(user, keyset, device)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseAuthLogin{Token: token}, nil
+}
+
+// Opens the session of a completed login and records it
+func (service *AuthService) openSession(
+	user *models.User,
+	keyset *keyring.Keyset,
+	device *models.Device,
+) (string, error) {
+	token, sessionId, err := service.sessionsService.Open(user.Id, keyset, device)
+	if err != nil {
+		return "", err
 	}
 
+	service.auditService.Record(
+		&models.Actor{Address: device.Address, SessionId: sessionId},
+		models.AuditLoginSuccess,
+		"",
+		"",
+	)
+
+	// Strengths scored by an older estimator could not be updated while the vault was locked
+	service.strengthService.RecomputeLater()
+
 	return token, nil
 }
 
+// Records a failed login or recovery, when it failed on the credentials
+func (service *AuthService) recordFailure(event string, address string, err error, details string) {
+	if apiError, ok := err.(*schemas.APIError); ok && apiError.Code == string(schemas.ErrInvalidCredentials) {
+		service.auditService.Record(&models.Actor{Address: address}, event, "", details)
+	}
+}
+
+// Revokes the session of the token, locks the vault if it was the last one
+func (service *AuthService) LogoutUser(token string) {
+	sessionId, err := jwtoken.ParseJWT(token)
+	if err != nil {
+		return
+	}
+
+	service.sessionsService.Revoke(sessionId)
+}
+
 // Protected by JWT token
-func (service *AuthService) UpdatePassphrase(newPassphrase string) error {
+func (service *AuthService) UpdatePassphrase(newPassphrase string, actor *models.Actor) error {
 	initialized, err := service.Status()
 	if err != nil {
 		return err
@@ -173,56 +271,409 @@ func (service *AuthService) UpdatePassphrase(newPassphrase string) error {
 		)
 	}
 
-	encryptedNewPassphrase, err := encrypt.Encrypt(newPassphrase)
+	// The session that passed the guard holds the keyset
+	keyset, err := keyring.Current()
 	if err != nil {
-		return schemas.NewAPIError(
-			schemas.ErrEncryptionFailed,
-			"Couldn't encrypt passphrase",
-			err,
-		)
+		return err
+	}
+	defer keyset.Wipe()
+
+	err = service.rewrapPassphraseKey(keyset.Root, newPassphrase)
+	if err != nil {
+		return err
 	}
 
-	return service.repository.UpdateUser(encryptedNewPassphrase)
+	service.auditService.Record(actor, models.AuditPassphraseChange, "", "")
+	return nil
 }
 
+// Sets a new passphrase with the recovery key.
+// The recovery key is used up: a new one is returned, to be shown to the user once.
 func (service *AuthService) RecoverUser(
 	recoveryKey string,
 	newPassphrase string,
-) error {
+	actor *models.Actor,
+) (string, error) {
 	isInitialized, err := service.Status()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if !isInitialized {
-		return schemas.NewAPIError(
+		return "", schemas.NewAPIError(
 			schemas.ErrNotInitializedYet,
 			"You haven't initialized the application yet",
 			nil,
 		)
 	}
 
-	actualRecoveryKey, err := service.repository.GetRecoveryKey()
+	user, err := service.repository.GetUser()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if actualRecoveryKey != recoveryKey {
-		return schemas.NewAPIError(
+	if !verifyRecoveryKey(recoveryKey, user.Recovery) {
+		err := schemas.NewAPIError(
 			schemas.ErrInvalidCredentials,
 			"Invalid recovery key",
 			nil,
 		)
+		service.recordFailure(models.AuditRecoveryFailure, actor.Address, err, "recovery key")
+		return "", err
 	}
 
-	encryptedNewPassphrase, err := encrypt.Encrypt(newPassphrase)
+	var root []byte
+	if user.Keys.Recovery == "" {
+		keyset, err := service.migrateLegacyVault(user, newPassphrase, recoveryKey)
+		if err != nil {
+			return "", err
+		}
+		defer keyset.Wipe()
+
+		root = keyset.Root
+	} else {
+		root, err = encrypt.UnwrapKeyWithPassphrase(user.Keys.Recovery, recoveryKey)
+		if err != nil {
+			return "", schemas.NewAPIError(
+				schemas.ErrDecryptionFailed,
+				"Couldn't unwrap root key with recovery key",
+				err,
+			)
+		}
+		defer clear(root)
+	}
+
+	recovery, err := service.resetCredentials(root, newPassphrase)
+	if err != nil {
+		return "", err
+	}
+
+	// Whoever knew the old passphrase is logged out, and their tokens stop working
+	err = service.sessionsService.RevokeOthers("")
+	if err != nil {
+		return "", err
+	}
+
+	err = service.tokensService.RevokeAll()
+	if err != nil {
+		return "", err
+	}
+
+	service.auditService.Record(actor, models.AuditRecoverySuccess, "", "")
+
+	return recovery, nil
+}
+
+// Pins the keyset at startup if the root key is also wrapped with AES_GCM_SECRET
+func (service *AuthService) UnlockWithEnvironmentKey() error {
+	if !encrypt.EnvironmentWrapEnabled() {
+		return nil
+	}
+
+	user, err := service.repository.GetUser()
+	if err != nil || user.Keys.Environment == "" {
+		return nil
+	}
+
+	root, current, err := encrypt.UnwrapKeyWithEnvironment(user.Keys.Environment)
 	if err != nil {
 		return schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Couldn't unwrap root key with AES_GCM_SECRET",
+			err,
+		)
+	}
+
+	keyset, err := openKeyset(user, root)
+	if err != nil {
+		return err
+	}
+
+	// Wrap again with the active secret if it was wrapped by a retired one
+	if !current {
+		if err := service.storeEnvironmentKey(root); err != nil {
+			return err
+		}
+	}
+
+	if err := service.upgradeVault(keyset); err != nil {
+		return err
+	}
+
+	keyring.Pin(keyset)
+	return nil
+}
+
+// Accounts written by older versions were encrypted deterministically or
+// without associated data. Once the keyset is known, they are re-encrypted
+// with random nonces, bound to their row and column, and indexed.
+func (service *AuthService) upgradeVault(keyset *keyring.Keyset) error {
+	outdated, err := service.vaultRepository.CountOutdated(encrypt.BoundCiphertextPrefix)
+	if err != nil || outdated == 0 {
+		return err
+	}
+
+	return service.vaultRepository.Reencrypt(
+		reencryptTo(keyset, decryptStored(keyset)),
+		nil,
+	)
+}
+
+func (service *AuthService) unwrapKeyset(
+	user *models.User,
+	passphrase string,
+) (*keyring.Keyset, error) {
+	// Vaults created before envelope encryption have no wrapped key yet
+	if user.Keys.Passphrase == "" {
+		storedPassphrase, err := encrypt.DecryptLegacy(user.Passphrase)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrDecryptionFailed,
+				"Couldn't decrypt stored passphrase",
+				err,
+			)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(storedPassphrase), []byte(passphrase)) != 1 {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidCredentials,
+				"Invalid credentials",
+				nil,
+			)
+		}
+
+		return service.migrateLegacyVault(user, passphrase, user.Recovery)
+	}
+
+	matches, needsRehash, err := encrypt.VerifyPassword(passphrase, user.Passphrase)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Couldn't verify stored passphrase hash",
+			err,
+		)
+	}
+
+	if !matches {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid credentials",
+			nil,
+		)
+	}
+
+	root, err := encrypt.UnwrapKeyWithPassphrase(user.Keys.Passphrase, passphrase)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Couldn't unwrap root key",
+			err,
+		)
+	}
+
+	// Upgrade older or cheaper hashes while we know the passphrase
+	if needsRehash {
+		hashedPassphrase, err := encrypt.HashPassword(passphrase)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrEncryptionFailed,
+				"Couldn't hash passphrase",
+				err,
+			)
+		}
+
+		err = service.repository.UpdatePassphraseHash(hashedPassphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return openKeyset(user, root)
+}
+
+// Moves a vault encrypted with AES_GCM_SECRET to a fresh wrapped keyset.
+// Legacy vaults stored the recovery key itself, which wraps the new root key.
+func (service *AuthService) migrateLegacyVault(
+	user *models.User,
+	passphrase string,
+	recoveryKey string,
+) (*keyring.Keyset, error) {
+	keyset, err := newKeyset()
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassphrase, err := encrypt.HashPassword(passphrase)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash passphrase",
+			err,
+		)
+	}
+
+	keys, err := wrapKeyset(keyset, passphrase, recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.vaultRepository.ReencryptWithKeys(
+		reencryptTo(keyset, func(value string, _ []byte) (string, error) {
+			return encrypt.DecryptLegacy(value)
+		}),
+		hashedPassphrase,
+		keys,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyset, nil
+}
+
+func (service *AuthService) rewrapPassphraseKey(
+	root []byte,
+	passphrase string,
+) error {
+	hashedPassphrase, err := encrypt.HashPassword(passphrase)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash passphrase",
+			err,
+		)
+	}
+
+	wrappedKey, err := encrypt.WrapKeyWithPassphrase(root, passphrase)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	return service.repository.UpdateUser(hashedPassphrase, wrappedKey)
+}
+
+// Adds or removes the AES_GCM_SECRET wrapped copy to match the configuration
+func (service *AuthService) syncEnvironmentKey(
+	user *models.User,
+	root []byte,
+) error {
+	if !encrypt.EnvironmentWrapEnabled() {
+		if user.Keys.Environment == "" {
+			return nil
+		}
+		return service.repository.UpdateEnvironmentKey("")
+	}
+
+	if user.Keys.Environment != "" {
+		// Keep it if the active secret opens it, wrap again if a retired one did
+		if _, current, err := encrypt.UnwrapKeyWithEnvironment(user.Keys.Environment); err == nil && current {
+			return nil
+		}
+	}
+
+	return service.storeEnvironmentKey(root)
+}
+
+func (service *AuthService) storeEnvironmentKey(root []byte) error {
+	wrappedKey, err := encrypt.WrapKeyWithEnvironment(root)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	return service.repository.UpdateEnvironmentKey(wrappedKey)
+}
+
+func newKeyset() (*keyring.Keyset, error) {
+	root, err := encrypt.GenerateDataKey()
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't generate root key",
+			err,
+		)
+	}
+
+	material, err := encrypt.GenerateDataKey()
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't generate data key",
+			err,
+		)
+	}
+
+	return keyring.NewKeyset(root, material), nil
+}
+
+func openKeyset(user *models.User, root []byte) (*keyring.Keyset, error) {
+	keyset, err := encrypt.OpenKeyset(root, user.Keys.Keyset)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Couldn't open keyset",
+			err,
+		)
+	}
+
+	return keyset, nil
+}
+
+func wrapKeyset(
+	keyset *keyring.Keyset,
+	passphrase string,
+	recoveryKey string,
+) (*models.WrappedKeys, error) {
+	passphraseKey, err := encrypt.WrapKeyWithPassphrase(keyset.Root, passphrase)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	recoveryWrappedKey, err := encrypt.WrapKeyWithPassphrase(keyset.Root, recoveryKey)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	environmentKey := ""
+	if encrypt.EnvironmentWrapEnabled() {
+		environmentKey, err = encrypt.WrapKeyWithEnvironment(keyset.Root)
+		if err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrEncryptionFailed,
+				"Couldn't wrap root key",
+				err,
+			)
+		}
+	}
+
+	sealedKeyset, err := encrypt.SealKeyset(keyset)
+	if err != nil {
+		return nil, schemas.NewAPIError(
 			schemas.ErrEncryptionFailed,
-			"Couldn't encrypt passphrase",
+			"Couldn't seal keyset",
 			err,
 		)
 	}
 
-	return service.repository.UpdateUser(encryptedNewPassphrase)
+	return &models.WrappedKeys{
+		Passphrase:  passphraseKey,
+		Recovery:    recoveryWrappedKey,
+		Environment: environmentKey,
+		Keyset:      sealedKeyset,
+	}, nil
 }
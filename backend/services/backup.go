@@ -0,0 +1,296 @@
+/**
+ * Encrypted, portable backups.
+ * A .passenger file is a JSON document: a format marker and version, the
+ * time of the backup and the sealed payload. The payload holds every
+ * account in clear text with a manifest of their count and digest, and
+ * is encrypted with a key derived from a passphrase chosen for the
+ * backup. The header is authenticated with the payload, so nothing can
+ * be changed without the passphrase. Restoring re-encrypts the accounts
+ * with the keys of the vault, which may be a fresh install with other
+ * secrets.
+ */
+
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"passenger-go/backend/models"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	BackupFormat  = "passenger-backup"
+	BackupVersion = 1
+
+	BackupModeMerge   = "merge"
+	BackupModeReplace = "replace"
+
+	// Larger uploads are refused before they are read
+	BackupMaxSize = 64 << 20
+)
+
+type BackupService struct {
+	accountsService *AccountsService
+	repository      *repositories.AccountsRepository
+	auditService    *AuditService
+	breachService   *BreachService
+	validator       *validator.Validate
+}
+
+func NewBackupService() *BackupService {
+	return &BackupService{
+		accountsService: NewAccountsService(),
+		repository:      repositories.NewAccountsRepository(),
+		auditService:    NewAuditService(),
+		breachService:   NewBreachService(),
+		validator:       pipes.GetValidator(),
+	}
+}
+
+// Returns the .passenger file of every account, sealed with the passphrase
+func (service *BackupService) Create(passphrase string, actor *models.Actor) ([]byte, error) {
+	accounts, err := service.accountsService.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &schemas.BackupPayload{
+		Accounts: make([]schemas.BackupAccount, len(accounts)),
+	}
+	for i, account := range accounts {
+		details, err := service.accountsService.accountDetails(account.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		policy := details.Policy
+		if details.PolicyProfile != "" {
+			policy, err = service.accountsService.policiesService.profilePolicy(details.PolicyProfile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		payload.Accounts[i] = schemas.BackupAccount{
+			Platform:   details.Platform,
+			Identifier: details.Identifier,
+			Passphrase: details.Passphrase,
+			Url:        details.Url,
+			Notes:      details.Notes,
+			Totp:       details.Totp,
+			Reprompt:   details.Reprompt,
+			Policy:     policy,
+
+			RotationDays:        details.RotationDays,
+			PassphraseChangedAt: details.PassphraseChangedAt,
+		}
+	}
+
+	payload.Manifest, err = backupManifest(payload.Accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	serialized, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(serialized)
+
+	file := &schemas.BackupFile{
+		Format:    BackupFormat,
+		Version:   BackupVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	file.Data, err = encrypt.SealBackup(serialized, passphrase, backupHeader(file))
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't encrypt the backup",
+			err,
+		)
+	}
+
+	encoded, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	service.auditService.Record(
+		actor,
+		models.AuditVaultBackup,
+		"",
+		fmt.Sprintf("%d accounts", len(accounts)),
+	)
+
+	return encoded, nil
+}
+
+// Checks the whole backup before the vault is changed, then restores it in a single transaction
+func (service *BackupService) Restore(
+	content []byte,
+	passphrase string,
+	mode string,
+	actor *models.Actor,
+) (*schemas.ResponseBackupRestore, error) {
+	if mode != BackupModeMerge && mode != BackupModeReplace {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"The restore mode must be merge or replace",
+			nil,
+		)
+	}
+
+	payload, err := openBackup(content, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	seals := make([]repositories.SealAccountFunc, len(payload.Accounts))
+	for i, account := range payload.Accounts {
+		body := &schemas.RequestAccountsUpsert{
+			Platform:     account.Platform,
+			Identifier:   account.Identifier,
+			Passphrase:   account.Passphrase,
+			Url:          account.Url,
+			Notes:        account.Notes,
+			Totp:         account.Totp,
+			Reprompt:     account.Reprompt,
+			Policy:       account.Policy,
+			RotationDays: account.RotationDays,
+		}
+
+		if err := service.validator.Struct(body); err != nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidBackup,
+				"Account "+strconv.Itoa(i+1)+" of the backup is invalid",
+				err,
+			)
+		}
+
+		strengthScore, err := accountStrength(body)
+		if err != nil {
+			return nil, err
+		}
+
+		changedAt := time.Now()
+		if account.PassphraseChangedAt != nil {
+			changedAt = *account.PassphraseChangedAt
+		}
+
+		seals[i] = func(id string) (*repositories.EncryptedAccountUpsert, error) {
+			account, err := service.accountsService.encryptRequestBodyWithStrength(id, body, strengthScore)
+			if err != nil {
+				return nil, err
+			}
+
+			account.PassphraseChangedAt = changedAt
+			return account, nil
+		}
+	}
+
+	restored, skipped, err := service.repository.RestoreAccounts(mode == BackupModeReplace, seals)
+	if err != nil {
+		return nil, err
+	}
+
+	service.auditService.Record(
+		actor,
+		models.AuditVaultRestore,
+		"",
+		fmt.Sprintf("%s: %d restored, %d skipped", mode, restored, skipped),
+	)
+	service.breachService.CheckLater("")
+
+	return &schemas.ResponseBackupRestore{
+		Restored: restored,
+		Skipped:  skipped,
+	}, nil
+}
+
+// The name of a backup file made at the given time
+func BackupFilename(at time.Time) string {
+	return "passenger-" + at.Format(time.DateOnly) + ".passenger"
+}
+
+func openBackup(content []byte, passphrase string) (*schemas.BackupPayload, error) {
+	file := &schemas.BackupFile{}
+	if err := json.Unmarshal(content, file); err != nil || file.Format != BackupFormat {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidBackup,
+			"The file is not a Passenger backup",
+			err,
+		)
+	}
+
+	if file.Version != BackupVersion {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidBackup,
+			"Unsupported backup version "+strconv.Itoa(file.Version),
+			nil,
+		)
+	}
+
+	serialized, err := encrypt.OpenBackup(file.Data, passphrase, backupHeader(file))
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidBackup,
+			"Wrong backup passphrase, or the backup was modified",
+			err,
+		)
+	}
+	defer clear(serialized)
+
+	payload := &schemas.BackupPayload{}
+	if err := json.Unmarshal(serialized, payload); err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidBackup,
+			"The backup content is invalid",
+			err,
+		)
+	}
+
+	manifest, err := backupManifest(payload.Accounts)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != payload.Manifest {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidBackup,
+			"The backup content does not match its manifest",
+			nil,
+		)
+	}
+
+	return payload, nil
+}
+
+func backupManifest(accounts []schemas.BackupAccount) (schemas.BackupManifest, error) {
+	serialized, err := json.Marshal(accounts)
+	if err != nil {
+		return schemas.BackupManifest{}, err
+	}
+	defer clear(serialized)
+
+	digest := sha256.Sum256(serialized)
+	return schemas.BackupManifest{
+		Accounts: len(accounts),
+		Digest:   hex.EncodeToString(digest[:]),
+	}, nil
+}
+
+// The fields of the file that are authenticated with the payload
+func backupHeader(file *schemas.BackupFile) []byte {
+	return fmt.Appendf(nil, "%s\x00%d\x00%d", file.Format, file.Version, file.CreatedAt.Unix())
+}
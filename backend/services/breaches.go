@@ -0,0 +1,242 @@
+/**
+ * Breached passphrase checks.
+ * Every account keeps an encrypted flag telling whether its passphrase
+ * appears in a known breach. BREACH_SOURCE picks where hashes are looked
+ * up: nowhere by default, the local dataset imported into the database, or
+ * the range API at BREACH_API_URL, the only source leaving the server.
+ * Accounts are checked in the background every BREACH_CHECK_INTERVAL while
+ * the vault is unlocked, after they are saved, and on demand.
+ */
+
+package services
+
+import (
+	"errors"
+	"io"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/breach"
+	"passenger-go/backend/utilities/config"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/logger"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	BreachSourceApi     = config.BreachSourceApi
+	BreachSourceDataset = config.BreachSourceDataset
+	BreachSourceOff     = config.BreachSourceOff
+
+	// Larger datasets are refused, the import is one transaction
+	BreachDatasetMaxSize = 2 << 30
+)
+
+var (
+	breachSource        string
+	breachApiUrl        string
+	breachCheckInterval time.Duration
+
+	// Flags of concurrent checks are written one check at a time
+	breachCheckMutex sync.Mutex
+)
+
+func configureBreaches(config *config.Config) {
+	breachSource = config.BreachSource
+	breachApiUrl = config.BreachApiUrl
+	breachCheckInterval = config.BreachCheckInterval
+}
+
+type BreachService struct {
+	accountsRepository *repositories.AccountsRepository
+	repository         *repositories.BreachesRepository
+}
+
+func NewBreachService() *BreachService {
+	return &BreachService{
+		accountsRepository: repositories.NewAccountsRepository(),
+		repository:         repositories.NewBreachesRepository(),
+	}
+}
+
+// Looks hashes up in the imported dataset
+type datasetSource struct {
+	repository *repositories.BreachesRepository
+}
+
+func (source *datasetSource) Occurrences(hash string) (int, error) {
+	return source.repository.GetOccurrences(hash[:breach.DatasetPrefixLength])
+}
+
+func (service *BreachService) source() (breach.Source, error) {
+	switch breachSource {
+	case BreachSourceApi:
+		return breach.NewRangeSource(breachApiUrl), nil
+	case BreachSourceDataset:
+		return &datasetSource{repository: service.repository}, nil
+	}
+
+	return nil, schemas.NewAPIError(
+		schemas.ErrBreachCheckDisabled,
+		"Breach checks are disabled, set BREACH_SOURCE to enable them",
+		nil,
+	)
+}
+
+// Checks the account with the given id, or every account if it is empty
+func (service *BreachService) Check(id string) (*schemas.ResponseBreachCheck, error) {
+	source, err := service.source()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := service.accountsRepository.GetEncryptedPassphrases(id)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" && len(rows) == 0 {
+		return nil, schemas.NewAPIError(
+			schemas.ErrAccountNotFound,
+			"Account not found",
+			nil,
+		)
+	}
+
+	result := &schemas.ResponseBreachCheck{}
+
+	// Looked up without the lock, a slow source must not hold up other checks
+	type lookup struct {
+		row   *repositories.EncryptedPassphraseRow
+		count int
+	}
+	lookups := []lookup{}
+	// Reused passphrases are only looked up once
+	occurrences := map[string]int{}
+	for _, row := range rows {
+		passphrase, err := encrypt.Decrypt(row.Passphrase, accountField("passphrase", row.Id))
+		if err != nil {
+			return nil, err
+		}
+
+		hash := breach.Hash(passphrase)
+		count, found := occurrences[hash]
+		if !found {
+			count, err = source.Occurrences(hash)
+			if err != nil {
+				result.Failed++
+				continue
+			}
+			occurrences[hash] = count
+		}
+		lookups = append(lookups, lookup{row: row, count: count})
+	}
+
+	breachCheckMutex.Lock()
+	defer breachCheckMutex.Unlock()
+
+	for _, lookup := range lookups {
+		breached, err := encrypt.Encrypt(strconv.FormatBool(lookup.count > 0), accountField("breached", lookup.row.Id))
+		if err != nil {
+			return nil, err
+		}
+
+		// Skipped when the passphrase changed in the meantime, its own check follows
+		updated, err := service.accountsRepository.UpdateBreached(lookup.row.Id, lookup.row.Passphrase, breached)
+		if err != nil {
+			return nil, err
+		}
+		if !updated {
+			continue
+		}
+
+		result.Checked++
+		if lookup.count > 0 {
+			result.Breached++
+		}
+	}
+
+	return result, nil
+}
+
+// Checks a saved account without holding up the request that saved it
+func (service *BreachService) CheckLater(id string) {
+	if breachSource == BreachSourceOff {
+		return
+	}
+
+	go func() {
+		if _, err := service.Check(id); err != nil {
+			log := logger.GetLogger()
+			log.Printf("Breach check of account %s failed: %v", id, err)
+		}
+	}()
+}
+
+// Replaces the local dataset with the hash prefixes read from the file
+func (service *BreachService) ImportDataset(reader io.Reader) (*schemas.ResponseBreachDataset, error) {
+	count, err := service.repository.ImportDataset(func(add repositories.AddBreachHashFunc) error {
+		return breach.ReadDataset(reader, add)
+	})
+	if errors.Is(err, breach.ErrInvalidDataset) {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			err.Error(),
+			err,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseBreachDataset{
+		Source:   breachSource,
+		Prefixes: count,
+	}, nil
+}
+
+func (service *BreachService) GetDataset() (*schemas.ResponseBreachDataset, error) {
+	count, err := service.repository.CountDataset()
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseBreachDataset{
+		Source:   breachSource,
+		Prefixes: count,
+	}, nil
+}
+
+// Checks every account each BREACH_CHECK_INTERVAL. Runs while the vault is
+// locked are skipped, the passphrases can't be decrypted.
+func StartBreachChecks() {
+	if breachSource == BreachSourceOff || breachCheckInterval == 0 {
+		return
+	}
+
+	service := NewBreachService()
+	go func() {
+		log := logger.GetLogger()
+		ticker := time.NewTicker(breachCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := service.Check("")
+			var apiError *schemas.APIError
+			if errors.As(err, &apiError) && apiError.Code == string(schemas.ErrVaultLocked) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Breach check failed: %v", err)
+				continue
+			}
+
+			log.Printf(
+				"Breach check: %d accounts checked, %d breached, %d failed",
+				result.Checked,
+				result.Breached,
+				result.Failed,
+			)
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+package services
+
+import "passenger-go/backend/utilities/config"
+
+// Hands the settings to the services, before any of them is used
+func Configure(config *config.Config) error {
+	configureBreaches(config)
+	configureSudo(config)
+	configureHistory(config)
+	return loadWordlists(config.WordlistsDir)
+}
@@ -1,15 +1,68 @@
 package services
 
 import (
-	"math/rand"
+	"errors"
+	"fmt"
+	"os"
 	"passenger-go/backend/pipes"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/utilities/generator"
+	"passenger-go/backend/utilities/strength"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/go-playground/validator/v10"
 )
 
+const (
+	GenerateModeChars = "chars"
+	GenerateModeWords = "words"
+)
+
+// Wordlists for word based passphrases, by name
+var wordlists = map[string]*generator.Wordlist{}
+
+var wordlistName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// The embedded EFF list is always available. Every <name>.txt file in
+// the directory adds a list, selected with its name.
+func loadWordlists(directory string) error {
+	wordlists[generator.WordlistEff] = generator.EffWordlist()
+	if directory == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(directory, "*.txt"))
+	if err != nil {
+		return fmt.Errorf("WORDLISTS_DIR can't be read: %w", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		if !wordlistName.MatchString(name) || name == generator.WordlistEff {
+			return fmt.Errorf("wordlist %s must be named with lowercase letters, digits, - and _, and not %s", path, generator.WordlistEff)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("wordlist %s can't be read: %w", path, err)
+		}
+
+		wordlist, err := generator.ParseWordlist(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("wordlist %s is invalid: %w", path, err)
+		}
+		wordlists[name] = wordlist
+	}
+
+	return nil
+}
+
 type GenerateService struct {
 	validator *validator.Validate
 }
@@ -20,75 +73,255 @@ func NewGenerateService() *GenerateService {
 	}
 }
 
+const (
+	defaultGenerateLength = 32
+	minGenerateLength     = 8
+	maxGenerateLength     = 4096
+)
+
+// Missing fields take the defaults: 32 characters of every set, at least one of each
 func (service *GenerateService) Generate(
-	length int,
-) *schemas.ResponseGenerate {
-	actualLength := min(max(length, 8), 4096)
+	body *schemas.GeneratePolicy,
+) (*schemas.ResponseGenerate, error) {
+	if body.Length == 0 {
+		body.Length = defaultGenerateLength
+	}
+	body.Length = min(max(body.Length, minGenerateLength), maxGenerateLength)
+
+	return service.generate(body)
+}
+
+// Follows the policy of an account or profile. The length defaults to 32
+// within its limits, and every allowed set has a character when it fits.
+func (service *GenerateService) GenerateWithPolicy(
+	body *schemas.GeneratePolicy,
+	rules *schemas.PassphrasePolicy,
+) (*schemas.ResponseGenerate, error) {
+	allowed := rules.Sets
+	if len(allowed) == 0 {
+		allowed = generator.CharacterSets
+	}
+
+	for _, name := range body.Sets {
+		if !slices.Contains(allowed, name) {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"The policy doesn't allow "+name,
+				nil,
+			)
+		}
+	}
+	if len(body.Sets) == 0 {
+		body.Sets = slices.Clone(allowed)
+	}
+
+	lowest, highest := max(rules.MinLength, 1), maxGenerateLength
+	if rules.MaxLength != 0 {
+		highest = rules.MaxLength
+	}
+	if body.Length == 0 {
+		body.Length = min(max(defaultGenerateLength, lowest), highest)
+	} else if body.Length < lowest || body.Length > highest {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidLength,
+			fmt.Sprintf("The policy needs a length between %d and %d", lowest, highest),
+			nil,
+		)
+	}
 
-	passphrase := make([]byte, actualLength)
-	for index := range actualLength {
-		passphrase[index] = generator.Chars[rand.Intn(len(generator.Chars))]
+	if body.Minimums == nil {
+		body.Minimums = map[string]int{}
+		if body.Length-utf8.RuneCountInString(body.Prefix) >= len(body.Sets) {
+			body.Minimums = requireEverySet(body.Sets)
+		}
+	}
+	for _, name := range rules.Required {
+		if !slices.Contains(body.Sets, name) {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"The policy requires "+name,
+				nil,
+			)
+		}
+		body.Minimums[name] = max(body.Minimums[name], 1)
 	}
 
-	/**
-	 * We do not use a while loop to ensure that
-	 * the passphrase contains at least two characters
-	 * from each set. Using a while loop, can result
-	 * in an infinite loop if the random number
-	 * generator keeps generating the same index.
-	 */
+	if rules.Symbols != "" {
+		for _, character := range body.Symbols {
+			if !strings.ContainsRune(rules.Symbols, character) {
+				return nil, schemas.NewAPIError(
+					schemas.ErrInvalidRequest,
+					"The policy doesn't allow the symbol "+string(character),
+					nil,
+				)
+			}
+		}
+		if body.Symbols == "" {
+			body.Symbols = rules.Symbols
+		}
+	}
+	body.Forbidden = rules.Forbidden + body.Forbidden
 
-	/* Generate 8 different indices */
-	positions := make([]int, actualLength)
-	for index := range actualLength {
-		positions[index] = index
+	response, err := service.generate(body)
+	if err != nil {
+		return nil, err
 	}
 
-	// Shuffle the positions array
-	for index := len(positions) - 1; index > 0; index-- {
-		j := rand.Intn(index + 1)
-		positions[index], positions[j] = positions[j], positions[index]
+	// A prefix or pattern can still break the rules
+	if violations := policyViolations(response.Generated, rules); len(violations) > 0 {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"The prefix or pattern breaks the policy: "+strings.Join(violations, ". "),
+			nil,
+		)
 	}
 
-	// Take the first 8 positions
-	selectedPositions := positions[:8]
+	return response, nil
+}
+
+func (service *GenerateService) generate(
+	body *schemas.GeneratePolicy,
+) (*schemas.ResponseGenerate, error) {
+	policy := generator.Policy{
+		Length:           body.Length,
+		Sets:             body.Sets,
+		Minimums:         body.Minimums,
+		ExcludeAmbiguous: body.ExcludeAmbiguous,
+		Symbols:          body.Symbols,
+		Forbidden:        body.Forbidden,
+		Prefix:           body.Prefix,
+		Pattern:          body.Pattern,
+	}
 
-	// Ensure that the passphrase contains at least two characters from each set
-	characterSets := []string{
-		generator.Lowers,
-		generator.Uppers,
-		generator.Numbers,
-		generator.Specials,
+	// Without sets, those the exclusions leave empty are skipped and get no minimum.
+	// An invalid policy has no sets, Generate reports why.
+	if policy.Minimums == nil {
+		sets, _ := policy.AllowedSets()
+		policy.Minimums = requireEverySet(sets)
 	}
 
-	for position := range 8 {
-		setIndex := position % 4
-		set := characterSets[setIndex]
-		passphrase[selectedPositions[position]] = set[rand.Intn(len(set))]
+	passphrase, entropy, err := policy.Generate()
+	if errors.Is(err, generator.ErrInvalidPolicy) {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Invalid policy: "+strings.TrimPrefix(err.Error(), generator.ErrInvalidPolicy.Error()+": "),
+			err,
+		)
+	}
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Failed to generate passphrase",
+			err,
+		)
 	}
 
 	return &schemas.ResponseGenerate{
-		Generated: string(passphrase),
+		Generated: passphrase,
+		Mode:      GenerateModeChars,
+		Entropy:   entropy,
+	}, nil
+}
+
+func requireEverySet(sets []string) map[string]int {
+	minimums := map[string]int{}
+	for _, name := range sets {
+		minimums[name] = 1
 	}
+	return minimums
+}
+
+func (service *GenerateService) GenerateWords(
+	name string,
+	options generator.WordOptions,
+) (*schemas.ResponseGenerate, error) {
+	wordlist, found := wordlists[name]
+	if !found {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Unknown wordlist "+name,
+			nil,
+		)
+	}
+
+	passphrase, entropy, err := wordlist.Generate(options)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Failed to generate passphrase",
+			err,
+		)
+	}
+
+	return &schemas.ResponseGenerate{
+		Generated: passphrase,
+		Mode:      GenerateModeWords,
+		Entropy:   entropy,
+	}, nil
+}
+
+func (service *GenerateService) GetWordlists() []schemas.ResponseWordlist {
+	names := make([]string, 0, len(wordlists))
+	for name := range wordlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	response := make([]schemas.ResponseWordlist, len(names))
+	for index, name := range names {
+		response[index] = schemas.ResponseWordlist{
+			Name:  name,
+			Words: wordlists[name].Size(),
+		}
+	}
+
+	return response
 }
 
 func (service *GenerateService) Alternate(
 	passphrase string,
-) *schemas.ResponseAlternate {
-	var output strings.Builder
+) (*schemas.ResponseAlternate, error) {
+	alternative, err := generator.Alternate(passphrase)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Failed to alternate passphrase",
+			err,
+		)
+	}
 
-	for _, character := range passphrase {
-		lowerChar := strings.ToLower(string(character))
+	return &schemas.ResponseAlternate{
+		Alternative: alternative,
+	}, nil
+}
+
+func (service *GenerateService) Strength(
+	body *schemas.RequestStrength,
+) *schemas.ResponseStrength {
+	result := strength.Estimate(body.Passphrase, body.UserInputs...)
 
-		if alternatives, exists := generator.ManipulateMap[lowerChar]; exists {
-			randomIndex := rand.Intn(len(alternatives))
-			output.WriteString(alternatives[randomIndex])
-		} else {
-			output.WriteString(lowerChar)
+	matches := make([]schemas.StrengthMatch, len(result.Matches))
+	for index, match := range result.Matches {
+		matches[index] = schemas.StrengthMatch{
+			Pattern:    match.Pattern,
+			Token:      match.Token,
+			Guesses:    match.Guesses,
+			Dictionary: match.Dictionary,
+			Reversed:   match.Reversed,
+			L33t:       match.L33t,
+			Graph:      match.Graph,
 		}
 	}
 
-	return &schemas.ResponseAlternate{
-		Alternative: output.String(),
+	return &schemas.ResponseStrength{
+		Score:        result.Score,
+		MaxScore:     strength.MaxScore,
+		Version:      strength.Version,
+		Guesses:      result.Guesses,
+		GuessesLog10: result.GuessesLog10,
+		Entropy:      result.Entropy,
+		Warning:      result.Feedback.Warning,
+		Suggestions:  result.Feedback.Suggestions,
+		Matches:      matches,
 	}
 }
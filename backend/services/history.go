@@ -0,0 +1,153 @@
+package services
+
+import (
+	"passenger-go/backend/models"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/config"
+	"passenger-go/backend/utilities/encrypt"
+	"strconv"
+	"time"
+)
+
+var (
+	historyLimit  int
+	historyMaxAge time.Duration
+)
+
+func configureHistory(config *config.Config) {
+	historyLimit = config.PassphraseHistoryLimit
+	historyMaxAge = config.PassphraseHistoryMaxAge
+}
+
+// Entries replaced before it are expired, the zero time keeps all of them
+func historyKeepAfter() time.Time {
+	if historyMaxAge == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-historyMaxAge)
+}
+
+// Expired entries and those beyond the limit are pruned on every update
+func newHistoryUpsert(restoredId string) *repositories.HistoryUpsert {
+	return &repositories.HistoryUpsert{
+		Limit:      historyLimit,
+		KeepAfter:  historyKeepAfter(),
+		RestoredId: restoredId,
+	}
+}
+
+func historyField(id string) []byte {
+	return encrypt.AssociatedData("account_passphrase_history", "passphrase", id)
+}
+
+// Lists the previous passphrases of the account without revealing them
+func (service *AccountsService) GetHistory(
+	id string,
+) ([]*schemas.ResponsePassphraseHistory, error) {
+	// A missing account would otherwise look like one without history
+	if _, err := service.repository.GetReprompt(id); err != nil {
+		return nil, err
+	}
+
+	rows, err := service.repository.GetHistory(id, historyKeepAfter())
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]*schemas.ResponsePassphraseHistory, len(rows))
+	for i, row := range rows {
+		history[i] = &schemas.ResponsePassphraseHistory{
+			Id:         row.Id,
+			ReplacedAt: row.ReplacedAt,
+		}
+	}
+
+	return history, nil
+}
+
+func (service *AccountsService) GetHistoryPassphrase(
+	id string,
+	historyId string,
+	actor *models.Actor,
+) (string, error) {
+	passphrase, err := service.historyPassphrase(id, historyId, actor)
+	if err != nil {
+		return "", err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountReveal, id, "history")
+	return passphrase, nil
+}
+
+// Makes a previous passphrase the current one, the current one goes to the history
+func (service *AccountsService) RestoreHistory(
+	id string,
+	historyId string,
+	actor *models.Actor,
+) ([]string, error) {
+	account, err := service.accountDetails(id)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := service.historyPassphrase(account.Id, historyId, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings, err := service.updateAccount(account.Id, &schemas.RequestAccountsUpsert{
+		Platform:      account.Platform,
+		Identifier:    account.Identifier,
+		Passphrase:    passphrase,
+		Url:           account.Url,
+		Notes:         account.Notes,
+		Totp:          account.Totp,
+		Reprompt:      account.Reprompt,
+		Policy:        account.Policy,
+		PolicyProfile: account.PolicyProfile,
+		RotationDays:  account.RotationDays,
+	}, historyId)
+	if err != nil {
+		return nil, err
+	}
+
+	service.auditService.Record(actor, models.AuditAccountUpdate, account.Id, "history restore")
+	return warnings, nil
+}
+
+// Entries keep the reprompt flag the account had when they were replaced,
+// clearing it since then doesn't reveal them without sudo mode
+func (service *AccountsService) historyPassphrase(
+	id string,
+	historyId string,
+	actor *models.Actor,
+) (string, error) {
+	// The id is part of the associated data, so it must match the stored one
+	rowId, err := strconv.ParseInt(historyId, 10, 64)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrHistoryNotFound,
+			"History entry not found",
+			nil,
+		)
+	}
+	historyId = strconv.FormatInt(rowId, 10)
+
+	encryptedPassphrase, replacedReprompt, err := service.repository.GetHistoryPassphrase(id, historyId, historyKeepAfter())
+	if err != nil {
+		return "", err
+	}
+
+	reprompt, err := service.repository.GetReprompt(id)
+	if err != nil {
+		return "", err
+	}
+
+	err = service.sessionsService.RequireRevealReauthentication(actor, reprompt || replacedReprompt)
+	if err != nil {
+		return "", err
+	}
+
+	return encrypt.Decrypt(encryptedPassphrase, historyField(historyId))
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"passenger-go/backend/models"
+	"passenger-go/backend/pipes"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/generator"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var policyProfileName = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+type PoliciesService struct {
+	repository         *repositories.PoliciesRepository
+	accountsRepository *repositories.AccountsRepository
+	validator          *validator.Validate
+}
+
+func NewPoliciesService() *PoliciesService {
+	return &PoliciesService{
+		repository:         repositories.NewPoliciesRepository(),
+		accountsRepository: repositories.NewAccountsRepository(),
+		validator:          pipes.GetValidator(),
+	}
+}
+
+func (service *PoliciesService) GetProfiles() ([]*schemas.ResponsePolicyProfile, error) {
+	profiles, err := service.repository.GetPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*schemas.ResponsePolicyProfile, len(profiles))
+	for i, profile := range profiles {
+		response[i], err = policyProfileToResponse(profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func (service *PoliciesService) GetProfile(name string) (*schemas.ResponsePolicyProfile, error) {
+	profile, err := service.repository.GetPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrPolicyNotFound,
+			"Policy profile not found",
+			nil,
+		)
+	}
+
+	return policyProfileToResponse(profile)
+}
+
+// Creates the profile or replaces its rules, accounts using it follow the new rules
+func (service *PoliciesService) SaveProfile(
+	name string,
+	policy *schemas.PassphrasePolicy,
+) (*schemas.ResponsePolicyProfile, error) {
+	if !policyProfileName.MatchString(name) {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"A profile name has 1 to 64 lowercase letters, digits, - and _",
+			nil,
+		)
+	}
+
+	if err := service.checkPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	serialized, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.repository.UpsertPolicy(name, string(serialized), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return service.GetProfile(name)
+}
+
+func (service *PoliciesService) DeleteProfile(name string) error {
+	deleted, err := service.repository.DeletePolicy(name)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return nil
+	}
+
+	// Either the profile doesn't exist or an account still uses it
+	profile, err := service.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	return schemas.NewAPIError(
+		schemas.ErrPolicyInUse,
+		fmt.Sprintf("Accounts still use the profile: %d", profile.Accounts),
+		nil,
+	)
+}
+
+// Returns the policy of the account or of the profile, nil when neither has one
+func (service *PoliciesService) Resolve(
+	accountId string,
+	profile string,
+) (*schemas.PassphrasePolicy, error) {
+	if accountId != "" && profile != "" {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Use either an account or a profile",
+			nil,
+		)
+	}
+
+	if profile != "" {
+		return service.profilePolicy(profile)
+	}
+	if accountId != "" {
+		return service.accountPolicy(accountId)
+	}
+	return nil, nil
+}
+
+// The stored policy of an account, its own or that of its profile
+func (service *PoliciesService) accountPolicy(id string) (*schemas.PassphrasePolicy, error) {
+	encryptedPolicy, profile, err := service.accountsRepository.GetPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile != "" {
+		return service.profilePolicy(profile)
+	}
+	return decryptPolicy(encryptedPolicy, id)
+}
+
+func (service *PoliciesService) profilePolicy(name string) (*schemas.PassphrasePolicy, error) {
+	profile, err := service.GetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile.Policy, nil
+}
+
+// The policy an account is saved with, after checking that it can be followed
+func (service *PoliciesService) upsertPolicy(
+	body *schemas.RequestAccountsUpsert,
+) (*schemas.PassphrasePolicy, error) {
+	if body.Policy != nil && body.PolicyProfile != "" {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"An account has either its own policy or a profile",
+			nil,
+		)
+	}
+
+	if body.PolicyProfile != "" {
+		profile, err := service.repository.GetPolicy(body.PolicyProfile)
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			return nil, schemas.NewAPIError(
+				schemas.ErrInvalidRequest,
+				"Unknown policy profile "+body.PolicyProfile,
+				nil,
+			)
+		}
+
+		response, err := policyProfileToResponse(profile)
+		if err != nil {
+			return nil, err
+		}
+		return &response.Policy, nil
+	}
+
+	if body.Policy != nil {
+		if err := service.checkPolicy(body.Policy); err != nil {
+			return nil, err
+		}
+	}
+	return body.Policy, nil
+}
+
+// Refuses policies no passphrase could follow
+func (service *PoliciesService) checkPolicy(policy *schemas.PassphrasePolicy) error {
+	if err := service.validator.Struct(policy); err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"Cannot validate policy",
+			err,
+		)
+	}
+
+	invalid := func(message string) error {
+		return schemas.NewAPIError(schemas.ErrInvalidRequest, "Invalid policy: "+message, nil)
+	}
+
+	if policy.MaxLength != 0 && policy.MaxLength < policy.MinLength {
+		return invalid("the maximum length is below the minimum")
+	}
+
+	for _, name := range policy.Required {
+		if len(policy.Sets) != 0 && !slices.Contains(policy.Sets, name) {
+			return invalid(name + " are required but not allowed")
+		}
+	}
+	if policy.MaxLength != 0 && len(policy.Required) > policy.MaxLength {
+		return invalid("the maximum length is below the number of required classes")
+	}
+
+	for _, character := range policy.Symbols {
+		if characterClass(character) != generator.SetSymbols {
+			return invalid("symbols can't contain letters or digits")
+		}
+	}
+
+	return nil
+}
+
+// Describes every rule of the policy the passphrase breaks
+func policyViolations(passphrase string, policy *schemas.PassphrasePolicy) []string {
+	violations := []string{}
+	if policy == nil {
+		return violations
+	}
+
+	length := utf8.RuneCountInString(passphrase)
+	if policy.MinLength != 0 && length < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("The passphrase is shorter than %d characters", policy.MinLength))
+	}
+	if policy.MaxLength != 0 && length > policy.MaxLength {
+		violations = append(violations, fmt.Sprintf("The passphrase is longer than %d characters", policy.MaxLength))
+	}
+
+	classes := map[string]bool{}
+	symbols, forbidden := []rune{}, []rune{}
+	for _, character := range passphrase {
+		class := characterClass(character)
+		classes[class] = true
+
+		if strings.ContainsRune(policy.Forbidden, character) && !slices.Contains(forbidden, character) {
+			forbidden = append(forbidden, character)
+		}
+		if class == generator.SetSymbols && policy.Symbols != "" &&
+			!strings.ContainsRune(policy.Symbols, character) && !slices.Contains(symbols, character) {
+			symbols = append(symbols, character)
+		}
+	}
+
+	for _, name := range generator.CharacterSets {
+		if classes[name] && len(policy.Sets) != 0 && !slices.Contains(policy.Sets, name) {
+			violations = append(violations, "The passphrase contains "+name+", which are not allowed")
+		}
+		if !classes[name] && slices.Contains(policy.Required, name) {
+			violations = append(violations, "The passphrase contains no "+name+", which are required")
+		}
+	}
+
+	if len(symbols) > 0 {
+		violations = append(violations, "The passphrase contains symbols that are not allowed: "+string(symbols))
+	}
+	if len(forbidden) > 0 {
+		violations = append(violations, "The passphrase contains forbidden characters: "+string(forbidden))
+	}
+
+	return violations
+}
+
+// Letters without a case count as lowers, anything but letters and digits as symbols
+func characterClass(character rune) string {
+	switch {
+	case unicode.IsUpper(character):
+		return generator.SetUppers
+	case unicode.IsLetter(character):
+		return generator.SetLowers
+	case unicode.IsDigit(character):
+		return generator.SetNumbers
+	default:
+		return generator.SetSymbols
+	}
+}
+
+// Accounts without a policy of their own have an empty column
+func decryptPolicy(value string, id string) (*schemas.PassphrasePolicy, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	decrypted, err := encrypt.Decrypt(value, accountField("policy", id))
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &schemas.PassphrasePolicy{}
+	if err := json.Unmarshal([]byte(decrypted), policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func encryptPolicy(policy *schemas.PassphrasePolicy, id string) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+
+	serialized, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+
+	return encrypt.Encrypt(string(serialized), accountField("policy", id))
+}
+
+func policyProfileToResponse(profile *models.PolicyProfile) (*schemas.ResponsePolicyProfile, error) {
+	response := &schemas.ResponsePolicyProfile{
+		Name:      profile.Name,
+		Accounts:  profile.Accounts,
+		CreatedAt: profile.CreatedAt,
+		UpdatedAt: profile.UpdatedAt,
+	}
+
+	if err := json.Unmarshal([]byte(profile.Policy), &response.Policy); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,164 @@
+/**
+ * The recovery key unwraps the root key when the passphrase is lost.
+ * Only an Argon2id hash of it is stored, next to the root key wrapped
+ * with it. It is shown to the user exactly once: at registration, after
+ * it was used to recover the vault, and when it is regenerated.
+ */
+
+package services
+
+import (
+	"crypto/subtle"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/keyring"
+	"strings"
+)
+
+// Protected by JWT token, replaces a lost recovery key after checking the passphrase
+func (service *AuthService) RegenerateRecoveryKey(passphrase string) (string, error) {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return "", err
+	}
+
+	matches, _, err := encrypt.VerifyPassword(passphrase, user.Passphrase)
+	if err != nil || !matches {
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid passphrase",
+			err,
+		)
+	}
+
+	keyset, err := keyring.Current()
+	if err != nil {
+		return "", err
+	}
+	defer keyset.Wipe()
+
+	recoveryKey, hashedRecoveryKey, wrappedKey, err := newRecoveryKey(keyset.Root, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	err = service.repository.UpdateRecoveryKey(hashedRecoveryKey, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	return recoveryKey, nil
+}
+
+// Sets the new passphrase and replaces the used recovery key
+func (service *AuthService) resetCredentials(
+	root []byte,
+	passphrase string,
+) (string, error) {
+	hashedPassphrase, err := encrypt.HashPassword(passphrase)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash passphrase",
+			err,
+		)
+	}
+
+	wrappedKey, err := encrypt.WrapKeyWithPassphrase(root, passphrase)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	recoveryKey, hashedRecoveryKey, wrappedRecoveryKey, err := newRecoveryKey(root, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	err = service.repository.UpdateCredentials(
+		hashedPassphrase,
+		wrappedKey,
+		hashedRecoveryKey,
+		wrappedRecoveryKey,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return recoveryKey, nil
+}
+
+// Older versions stored the recovery key itself, it is hashed once the vault no longer needs it
+func (service *AuthService) upgradeRecoveryKey(user *models.User) error {
+	if user.Recovery == "" || isRecoveryKeyHash(user.Recovery) {
+		return nil
+	}
+
+	hashedRecoveryKey, err := encrypt.HashPassword(user.Recovery)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash recovery key",
+			err,
+		)
+	}
+
+	return service.repository.UpdateRecoveryKeyHash(hashedRecoveryKey)
+}
+
+// Generates a recovery key and returns it with its hash and the root key wrapped with it
+func newRecoveryKey(
+	root []byte,
+	passphrase string,
+) (recoveryKey string, hashedRecoveryKey string, wrappedKey string, err error) {
+	recoveryKey, err = encrypt.GenerateRecoveryKey(passphrase)
+	if err != nil {
+		return "", "", "", schemas.NewAPIError(
+			schemas.ErrRecoveryGenerationFailed,
+			"Failed to generate recovery key",
+			err,
+		)
+	}
+
+	hashedRecoveryKey, err = encrypt.HashPassword(recoveryKey)
+	if err != nil {
+		return "", "", "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't hash recovery key",
+			err,
+		)
+	}
+
+	wrappedKey, err = encrypt.WrapKeyWithPassphrase(root, recoveryKey)
+	if err != nil {
+		return "", "", "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+
+	return recoveryKey, hashedRecoveryKey, wrappedKey, nil
+}
+
+// Checks the recovery key in constant time, against its hash or a stored key of older versions
+func verifyRecoveryKey(recoveryKey string, stored string) bool {
+	if stored == "" {
+		return false
+	}
+
+	if !isRecoveryKeyHash(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(recoveryKey)) == 1
+	}
+
+	matches, _, err := encrypt.VerifyPassword(recoveryKey, stored)
+	return err == nil && matches
+}
+
+func isRecoveryKeyHash(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$")
+}
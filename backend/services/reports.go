@@ -0,0 +1,194 @@
+/**
+ * Security report of the vault.
+ * Passphrases are decrypted to find the ones shared by several accounts,
+ * but only the accounts of each group are returned. The score starts at
+ * 100 and every account loses its share of it for each finding, weighted
+ * by how easily the finding leads to a compromise.
+ */
+
+package services
+
+import (
+	"crypto/sha256"
+	"math"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReportMaxAgeDays = 365
+
+	// Passphrases scoring at most this are reported as weak, on the scale of 0 to 4
+	reportWeakStrength = 2
+)
+
+// How much of its share an account loses for each finding
+var reportPenalties = struct {
+	breached, reused, weak, old, insecureUrl, missingUrl float64
+}{
+	breached:    1,
+	reused:      0.5,
+	weak:        0.5,
+	old:         0.2,
+	insecureUrl: 0.2,
+	missingUrl:  0.1,
+}
+
+type ReportsService struct {
+	repository *repositories.ReportsRepository
+}
+
+func NewReportsService() *ReportsService {
+	return &ReportsService{
+		repository: repositories.NewReportsRepository(),
+	}
+}
+
+// Passphrases that were not changed for maxAgeDays are reported as old
+func (service *ReportsService) Security(maxAgeDays int) (*schemas.ResponseSecurityReport, error) {
+	rows, err := service.repository.GetReportAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &schemas.ResponseSecurityReport{
+		Accounts:    len(rows),
+		MaxAgeDays:  maxAgeDays,
+		Reused:      []schemas.ReportReusedGroup{},
+		Weak:        []schemas.ReportAccount{},
+		Breached:    []schemas.ReportAccount{},
+		Old:         []schemas.ReportAccount{},
+		InsecureUrl: []schemas.ReportAccount{},
+		MissingUrl:  []schemas.ReportAccount{},
+	}
+
+	oldBefore := time.Now().AddDate(0, 0, -maxAgeDays)
+	penalties := make([]float64, len(rows))
+	// Accounts grouped by a digest of their passphrase, kept in memory only
+	groups := map[[sha256.Size]byte][]int{}
+	order := [][sha256.Size]byte{}
+	accounts := make([]schemas.ReportAccount, len(rows))
+
+	for i, row := range rows {
+		account, passphrase, breached, err := decryptReportRow(row)
+		if err != nil {
+			return nil, err
+		}
+		accounts[i] = *account
+
+		digest := sha256.Sum256([]byte(passphrase))
+		if _, found := groups[digest]; !found {
+			order = append(order, digest)
+		}
+		groups[digest] = append(groups[digest], i)
+
+		if breached {
+			report.Breached = append(report.Breached, *account)
+			penalties[i] += reportPenalties.breached
+		}
+		if account.Strength <= reportWeakStrength {
+			report.Weak = append(report.Weak, *account)
+			penalties[i] += reportPenalties.weak
+		}
+		if row.PassphraseChangedAt.IsZero() || row.PassphraseChangedAt.Before(oldBefore) {
+			report.Old = append(report.Old, *account)
+			penalties[i] += reportPenalties.old
+		}
+
+		url := strings.TrimSpace(account.Url)
+		if url == "" {
+			report.MissingUrl = append(report.MissingUrl, *account)
+			penalties[i] += reportPenalties.missingUrl
+		} else if strings.HasPrefix(strings.ToLower(url), "http://") {
+			report.InsecureUrl = append(report.InsecureUrl, *account)
+			penalties[i] += reportPenalties.insecureUrl
+		}
+	}
+
+	for _, digest := range order {
+		members := groups[digest]
+		if len(members) < 2 {
+			continue
+		}
+
+		group := schemas.ReportReusedGroup{Accounts: make([]schemas.ReportAccount, len(members))}
+		for j, i := range members {
+			group.Accounts[j] = accounts[i]
+			penalties[i] += reportPenalties.reused
+		}
+		report.Reused = append(report.Reused, group)
+	}
+
+	report.Score = reportScore(penalties)
+	return report, nil
+}
+
+func reportScore(penalties []float64) int {
+	if len(penalties) == 0 {
+		return 100
+	}
+
+	total := 0.0
+	for _, penalty := range penalties {
+		total += math.Max(0, 1-penalty)
+	}
+
+	return int(math.Round(100 * total / float64(len(penalties))))
+}
+
+func decryptReportRow(
+	row *repositories.EncryptedReportRow,
+) (*schemas.ReportAccount, string, bool, error) {
+	platform, err := encrypt.Decrypt(row.Platform, accountField("platform", row.Id))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	identifier, err := encrypt.Decrypt(row.Identifier, accountField("identifier", row.Id))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	url, err := encrypt.Decrypt(row.Url, accountField("url", row.Id))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	passphrase, err := encrypt.Decrypt(row.Passphrase, accountField("passphrase", row.Id))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	decryptedStrength, err := encrypt.Decrypt(row.EncryptedStrength, accountField("strength", row.Id))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	strengthScore, err := strconv.Atoi(decryptedStrength)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	breached, err := decryptBreached(row.EncryptedBreached, row.Id)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	account := &schemas.ReportAccount{
+		Id:         row.Id,
+		Platform:   platform,
+		Identifier: identifier,
+		Url:        url,
+		Strength:   strengthScore,
+	}
+	if !row.PassphraseChangedAt.IsZero() {
+		changedAt := row.PassphraseChangedAt
+		account.PassphraseChangedAt = &changedAt
+	}
+
+	return account, passphrase, breached, nil
+}
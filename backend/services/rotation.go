@@ -0,0 +1,68 @@
+package services
+
+import (
+	"passenger-go/backend/schemas"
+	"sort"
+	"time"
+)
+
+// Returns when the passphrase is due for rotation, nil without an interval.
+// A passphrase of unknown age is due as soon as the account has one.
+func rotationDue(days int, changedAt time.Time, now time.Time) (*time.Time, bool) {
+	if days == 0 {
+		return nil, false
+	}
+	if changedAt.IsZero() {
+		return nil, true
+	}
+
+	dueAt := changedAt.AddDate(0, 0, days)
+	return &dueAt, !now.Before(dueAt)
+}
+
+// Times that were never tracked are left out of responses
+func knownTime(at time.Time) *time.Time {
+	if at.IsZero() {
+		return nil
+	}
+	return &at
+}
+
+// Lists the accounts whose rotation interval has passed, the longest overdue first
+func (service *AccountsService) GetDueAccounts() ([]*schemas.ResponseAccountDue, error) {
+	rows, err := service.repository.GetAccountsWithEncryptedData()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accounts := []*schemas.ResponseAccountDue{}
+	for _, row := range rows {
+		dueAt, due := rotationDue(row.RotationDays, row.PassphraseChangedAt, now)
+		if !due {
+			continue
+		}
+
+		account, err := service.decryptAccountRowToResponse(row)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, &schemas.ResponseAccountDue{
+			ResponseAccount:     *account,
+			RotationDays:        row.RotationDays,
+			PassphraseChangedAt: knownTime(row.PassphraseChangedAt),
+			RotationDueAt:       dueAt,
+		})
+	}
+
+	// Passphrases of unknown age come first
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if accounts[i].RotationDueAt == nil || accounts[j].RotationDueAt == nil {
+			return accounts[i].RotationDueAt == nil && accounts[j].RotationDueAt != nil
+		}
+		return accounts[i].RotationDueAt.Before(*accounts[j].RotationDueAt)
+	})
+
+	return accounts, nil
+}
@@ -0,0 +1,259 @@
+/**
+ * Server-side sessions.
+ * Every login opens a session that is stored with the device it came
+ * from. A token is only accepted while its session exists, so revoking
+ * the session ends the token at once. Sessions slide: each request
+ * extends them by the idle timeout, up to the lifetime of the token.
+ * The keyring keeps the keyset unlocked for exactly the same sessions.
+ */
+
+package services
+
+import (
+	"passenger-go/backend/models"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/jwtoken"
+	"passenger-go/backend/utilities/keyring"
+	"strings"
+	"time"
+)
+
+const (
+	sessionIdleTimeout = 30 * time.Minute
+	// Writing the last seen time on every request is not worth it
+	sessionTouchInterval = time.Minute
+
+	maxUserAgentLength = 512
+)
+
+type SessionsService struct {
+	repository *repositories.SessionsRepository
+}
+
+func NewSessionsService() *SessionsService {
+	return &SessionsService{
+		repository: repositories.NewSessionsRepository(),
+	}
+}
+
+// Opens a session for the unlocked keyset and returns its JWT and id
+func (service *SessionsService) Open(
+	userId int,
+	keyset *keyring.Keyset,
+	device *models.Device,
+) (token string, sessionId string, err error) {
+	if err := service.repository.DeleteExpiredSessions(); err != nil {
+		return "", "", err
+	}
+
+	sessionId, err = keyring.OpenSession(keyset, sessionIdleTimeout)
+	if err != nil {
+		return "", "", schemas.NewAPIError(
+			schemas.ErrJWTGenerationFailed,
+			"Failed to open session",
+			err,
+		)
+	}
+
+	now := time.Now()
+	userAgent := truncate(device.UserAgent, maxUserAgentLength)
+	err = service.repository.CreateSession(&models.Session{
+		Id:         sessionId,
+		Name:       deviceName(userAgent),
+		UserAgent:  userAgent,
+		Address:    device.Address,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionIdleTimeout),
+	})
+	if err != nil {
+		keyring.CloseSession(sessionId)
+		return "", "", err
+	}
+
+	token, err = jwtoken.GenerateJWT(userId, sessionId)
+	if err != nil {
+		service.Revoke(sessionId)
+		return "", "", schemas.NewAPIError(
+			schemas.ErrJWTGenerationFailed,
+			"Failed to generate JWT",
+			err,
+		)
+	}
+
+	return token, sessionId, nil
+}
+
+// Returns the session of a token if it is still alive, and extends it
+func (service *SessionsService) Authenticate(token string) (string, error) {
+	sessionId, err := jwtoken.ParseJWT(token)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid or expired token",
+			err,
+		)
+	}
+
+	session, err := service.repository.GetSession(sessionId)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if session == nil || !now.Before(session.ExpiresAt) {
+		service.Revoke(sessionId)
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Session has been revoked or has expired, please login again",
+			nil,
+		)
+	}
+
+	expiresAt := now.Add(sessionIdleTimeout)
+	if maxExpiresAt := session.CreatedAt.Add(jwtoken.TokenLifetime); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+
+	// The keys are gone after a restart, unless the vault is pinned
+	if !keyring.TouchSession(sessionId, expiresAt) {
+		service.Revoke(sessionId)
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Session has ended, please login again",
+			nil,
+		)
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		err = service.repository.TouchSession(sessionId, now, expiresAt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return sessionId, nil
+}
+
+// Lists the active sessions, marking the one making the request
+func (service *SessionsService) List(currentId string) ([]*schemas.ResponseSession, error) {
+	sessions, err := service.repository.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*schemas.ResponseSession, len(sessions))
+	for i, session := range sessions {
+		response[i] = &schemas.ResponseSession{
+			Id:         session.Id,
+			Name:       session.Name,
+			UserAgent:  session.UserAgent,
+			Address:    session.Address,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.Id == currentId,
+		}
+	}
+
+	return response, nil
+}
+
+func (service *SessionsService) Rename(id string, name string) error {
+	renamed, err := service.repository.RenameSession(id, name)
+	if err != nil {
+		return err
+	}
+
+	if !renamed {
+		return schemas.NewAPIError(
+			schemas.ErrSessionNotFound,
+			"Session not found",
+			nil,
+		)
+	}
+
+	return nil
+}
+
+// Ends a session, its token is refused from now on
+func (service *SessionsService) Revoke(id string) error {
+	keyring.CloseSession(id)
+
+	deleted, err := service.repository.DeleteSession(id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return schemas.NewAPIError(
+			schemas.ErrSessionNotFound,
+			"Session not found",
+			nil,
+		)
+	}
+
+	return nil
+}
+
+// Ends every session but the current one, an empty id ends them all
+func (service *SessionsService) RevokeOthers(currentId string) error {
+	keyring.CloseOtherSessions(currentId)
+
+	return service.repository.DeleteOtherSessions(currentId)
+}
+
+// A readable name such as "Firefox on Linux", guessed from the user agent
+func deviceName(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := ""
+	for _, candidate := range browsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	system := ""
+	for _, candidate := range systems {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
@@ -0,0 +1,114 @@
+/**
+ * Stored passphrase strengths.
+ * Every account keeps the version of the estimator that scored it. When
+ * the estimator changes, the outdated strengths are recomputed as soon as
+ * the vault is unlocked, at startup or after a login.
+ */
+
+package services
+
+import (
+	"errors"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/logger"
+	"passenger-go/backend/utilities/strength"
+	"strconv"
+	"sync"
+)
+
+// Logins opening several sessions at once don't recompute twice
+var strengthRecomputeMutex sync.Mutex
+
+// The platform and identifier make a passphrase weaker when it contains them
+func accountStrength(body *schemas.RequestAccountsUpsert) (int, error) {
+	return strength.CalculateStrength(body.Passphrase, body.Platform, body.Identifier)
+}
+
+type StrengthService struct {
+	accountsRepository *repositories.AccountsRepository
+}
+
+func NewStrengthService() *StrengthService {
+	return &StrengthService{
+		accountsRepository: repositories.NewAccountsRepository(),
+	}
+}
+
+// Scores the accounts that an older estimator scored, returns how many were updated
+func (service *StrengthService) Recompute() (int, error) {
+	strengthRecomputeMutex.Lock()
+	defer strengthRecomputeMutex.Unlock()
+
+	rows, err := service.accountsRepository.GetOutdatedStrengths(strength.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, row := range rows {
+		platform, err := encrypt.Decrypt(row.Platform, accountField("platform", row.Id))
+		if err != nil {
+			return updated, err
+		}
+
+		identifier, err := encrypt.Decrypt(row.Identifier, accountField("identifier", row.Id))
+		if err != nil {
+			return updated, err
+		}
+
+		passphrase, err := encrypt.Decrypt(row.Passphrase, accountField("passphrase", row.Id))
+		if err != nil {
+			return updated, err
+		}
+
+		body := &schemas.RequestAccountsUpsert{
+			Platform:   platform,
+			Identifier: identifier,
+			Passphrase: passphrase,
+		}
+
+		strengthScore, err := accountStrength(body)
+		if err != nil {
+			return updated, err
+		}
+
+		encryptedStrength, err := encrypt.Encrypt(strconv.Itoa(strengthScore), accountField("strength", row.Id))
+		if err != nil {
+			return updated, err
+		}
+
+		// Skipped when the account was saved in the meantime, it has the current version then
+		ok, err := service.accountsRepository.UpdateStrength(row.Id, row.Passphrase, encryptedStrength, strength.Version)
+		if err != nil {
+			return updated, err
+		}
+		if ok {
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+// Recomputes without holding up the request that unlocked the vault
+func (service *StrengthService) RecomputeLater() {
+	go func() {
+		log := logger.GetLogger()
+
+		updated, err := service.Recompute()
+		var apiError *schemas.APIError
+		if errors.As(err, &apiError) && apiError.Code == string(schemas.ErrVaultLocked) {
+			return
+		}
+		if err != nil {
+			log.Printf("Strength recompute failed: %v", err)
+			return
+		}
+
+		if updated > 0 {
+			log.Printf("Strength recompute: %d accounts updated to version %d", updated, strength.Version)
+		}
+	}()
+}
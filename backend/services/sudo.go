@@ -0,0 +1,105 @@
+/**
+ * Sudo mode.
+ * A session is enough to use the vault, but the most sensitive operations
+ * also need the master passphrase to have been re-entered recently:
+ * exporting the vault, changing the passphrase, creating access tokens and
+ * revealing accounts marked to always reprompt (or every account when
+ * SUDO_REVEAL is set). Re-entering it marks the session, which stays in
+ * sudo mode for SUDO_WINDOW. Access tokens are never asked: creating one
+ * already required sudo mode, and its scopes limit what it can do. Only
+ * tokens granted the export scope can export the vault or back it up.
+ */
+
+package services
+
+import (
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/config"
+	"passenger-go/backend/utilities/encrypt"
+	"time"
+)
+
+var (
+	sudoWindow time.Duration
+	sudoReveal = false
+)
+
+func configureSudo(config *config.Config) {
+	sudoWindow = config.SudoWindow
+	sudoReveal = config.SudoReveal
+}
+
+// Protected by JWT token, checks the passphrase and puts the session in sudo mode
+func (service *AuthService) Reauthenticate(
+	sessionId string,
+	passphrase string,
+) (*schemas.ResponseAuthReauthenticate, error) {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, _, err := encrypt.VerifyPassword(passphrase, user.Passphrase)
+	if err != nil || !matches {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid passphrase",
+			err,
+		)
+	}
+
+	until, err := service.sessionsService.Reauthenticate(sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseAuthReauthenticate{Until: until}, nil
+}
+
+// Marks the session as reauthenticated now and returns when sudo mode ends
+func (service *SessionsService) Reauthenticate(sessionId string) (time.Time, error) {
+	now := time.Now()
+	err := service.repository.ReauthenticateSession(sessionId, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return now.Add(sudoWindow), nil
+}
+
+// Refuses sessions that did not re-enter the passphrase within the sudo window.
+// Requests without a session, made with an access token, are left to their scopes.
+func (service *SessionsService) RequireReauthentication(sessionId string) error {
+	if sessionId == "" {
+		return nil
+	}
+
+	session, err := service.repository.GetSession(sessionId)
+	if err != nil {
+		return err
+	}
+
+	if session == nil || session.ReauthenticatedAt.IsZero() ||
+		time.Since(session.ReauthenticatedAt) > sudoWindow {
+		return schemas.NewAPIError(
+			schemas.ErrReauthenticationRequired,
+			"Please enter your passphrase again to continue",
+			nil,
+		)
+	}
+
+	return nil
+}
+
+// Revealing an account needs sudo mode when it is marked to reprompt, or always with SUDO_REVEAL
+func (service *SessionsService) RequireRevealReauthentication(
+	actor *models.Actor,
+	reprompt bool,
+) error {
+	if actor == nil || (!reprompt && !sudoReveal) {
+		return nil
+	}
+
+	return service.RequireReauthentication(actor.SessionId)
+}
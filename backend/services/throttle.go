@@ -0,0 +1,111 @@
+/**
+ * Brute-force protection for the endpoints that check a secret.
+ *
+ * Every attempt is counted before the secret is checked, so parallel
+ * requests cannot slip past the limit, and a successful attempt clears
+ * the count. After a few free attempts, each one locks the endpoint for
+ * the client with an exponentially growing delay, up to a maximum.
+ * The counts are kept in the database and survive restarts; they are
+ * forgotten once the client stays quiet for a day.
+ */
+
+package services
+
+import (
+	"math"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/logger"
+	"sync"
+	"time"
+)
+
+const (
+	ThrottleLogin          = "login"
+	ThrottleLoginTwoFactor = "login-totp"
+	ThrottleRecover        = "recover"
+	ThrottleValidate       = "validate"
+	ThrottleTwoFactorOff   = "two-factor-disable"
+	ThrottleRecoveryKey    = "recovery-key"
+	ThrottleReauthenticate = "reauthenticate"
+
+	throttleFreeAttempts = 3
+	throttleBaseDelay    = time.Second
+	throttleMaxDelay     = 15 * time.Minute
+	throttleWindow       = 24 * time.Hour
+)
+
+// Counting an attempt reads and writes its row, which must not interleave
+var throttleMutex sync.Mutex
+
+type ThrottleService struct {
+	repository *repositories.AttemptsRepository
+}
+
+func NewThrottleService() *ThrottleService {
+	return &ThrottleService{
+		repository: repositories.NewAttemptsRepository(),
+	}
+}
+
+// Counts an attempt of the client, or refuses it while the client is locked out
+func (service *ThrottleService) Attempt(client string, endpoint string) error {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+
+	now := time.Now()
+	if err := service.repository.DeleteStaleAttempts(now.Add(-throttleWindow)); err != nil {
+		return err
+	}
+
+	attempt, err := service.repository.GetAttempt(client, endpoint)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Locked(now) {
+		log := logger.GetLogger()
+		retryAfter := int(math.Ceil(attempt.LockedUntil.Sub(now).Seconds()))
+		log.Printf("Refused %s attempt from %s, locked for %ds", endpoint, client, retryAfter)
+
+		apiError := schemas.NewAPIError(
+			schemas.ErrTooManyAttempts,
+			"Too many failed attempts, please try again later",
+			nil,
+		)
+		apiError.RetryAfter = retryAfter
+		return apiError
+	}
+
+	attempt.Failures++
+	attempt.LastAttempt = now
+	if attempt.Failures > throttleFreeAttempts {
+		attempt.LockedUntil = now.Add(throttleDelay(attempt.Failures - throttleFreeAttempts))
+	}
+
+	return service.repository.SaveAttempt(attempt)
+}
+
+// Clears the count after a success and logs failed credentials
+func (service *ThrottleService) Record(client string, endpoint string, err error) {
+	log := logger.GetLogger()
+
+	if err == nil {
+		if err := service.repository.DeleteAttempt(client, endpoint); err != nil {
+			log.Printf("Failed to clear %s attempts of %s: %v", endpoint, client, err)
+		}
+		return
+	}
+
+	if apiError, ok := err.(*schemas.APIError); ok && apiError.Code == string(schemas.ErrInvalidCredentials) {
+		log.Printf("Failed %s attempt from %s", endpoint, client)
+	}
+}
+
+// Doubles with every attempt past the free ones
+func throttleDelay(excess int) time.Duration {
+	if excess > 30 {
+		return throttleMaxDelay
+	}
+	return min(throttleBaseDelay<<(excess-1), throttleMaxDelay)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"os"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/database"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "passenger-services")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := database.Open(filepath.Join(directory, "passenger.db")); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	database.GetDB().Close()
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+var errWrongPassphrase = schemas.NewAPIError(schemas.ErrInvalidCredentials, "Invalid passphrase", nil)
+
+// Makes an attempt that fails, as a wrong passphrase would
+func failAttempt(t *testing.T, service *ThrottleService, client string) error {
+	t.Helper()
+
+	if err := service.Attempt(client, ThrottleLogin); err != nil {
+		return err
+	}
+	service.Record(client, ThrottleLogin, errWrongPassphrase)
+	return nil
+}
+
+func TestThrottleLocksOutAfterTheFreeAttempts(t *testing.T) {
+	service := NewThrottleService()
+	client := "192.0.2.1"
+
+	// The attempt past the free ones is still checked, then locks the client
+	for attempt := 1; attempt <= throttleFreeAttempts+1; attempt++ {
+		if err := failAttempt(t, service, client); err != nil {
+			t.Fatalf("attempt %d was refused: %v", attempt, err)
+		}
+	}
+
+	err := failAttempt(t, service, client)
+	apiError, ok := err.(*schemas.APIError)
+	if !ok || apiError.Code != string(schemas.ErrTooManyAttempts) {
+		t.Fatalf("got %v, want %s", err, schemas.ErrTooManyAttempts)
+	}
+	if apiError.RetryAfter <= 0 {
+		t.Errorf("retry after %ds, want a delay", apiError.RetryAfter)
+	}
+
+	// Other clients and endpoints are counted apart
+	if err := failAttempt(t, service, "192.0.2.2"); err != nil {
+		t.Errorf("another client was refused: %v", err)
+	}
+	if err := service.Attempt(client, ThrottleRecover); err != nil {
+		t.Errorf("another endpoint was refused: %v", err)
+	}
+}
+
+func TestThrottleResetsAfterASuccess(t *testing.T) {
+	service := NewThrottleService()
+	client := "192.0.2.3"
+
+	for range throttleFreeAttempts {
+		if err := failAttempt(t, service, client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := service.Attempt(client, ThrottleLogin); err != nil {
+		t.Fatal(err)
+	}
+	service.Record(client, ThrottleLogin, nil)
+
+	// Every free attempt is available again
+	for attempt := 1; attempt <= throttleFreeAttempts+1; attempt++ {
+		if err := failAttempt(t, service, client); err != nil {
+			t.Fatalf("attempt %d after the success was refused: %v", attempt, err)
+		}
+	}
+}
+
+func TestThrottleDelayGrowsUpToTheMaximum(t *testing.T) {
+	if throttleDelay(1) != throttleBaseDelay || throttleDelay(3) != 4*throttleBaseDelay {
+		t.Errorf("delays %v and %v don't double", throttleDelay(1), throttleDelay(3))
+	}
+	if throttleDelay(20) != throttleMaxDelay || throttleDelay(1000) != throttleMaxDelay {
+		t.Errorf("delays %v and %v exceed the maximum", throttleDelay(20), throttleDelay(1000))
+	}
+}
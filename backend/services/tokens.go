@@ -0,0 +1,307 @@
+/**
+ * Personal access tokens.
+ * Scripts and clients authenticate with a long-lived token sent as
+ * "Authorization: Bearer psg_...", limited to the scopes it was granted.
+ * Only a SHA-256 hash of the token is stored. Tokens granted a scope
+ * that needs the vault also store the root key wrapped with the token
+ * itself, so they can unlock the vault on their own while nobody is
+ * logged in. Like a login session, the keyset stays unlocked for such a
+ * token until it has been idle for a while.
+ */
+
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"passenger-go/backend/models"
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/keyring"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	AccessTokenPrefix = "psg_"
+
+	accessTokenSize = 32
+	// Enough of the token to recognize it in the list
+	accessTokenVisibleLength = len(AccessTokenPrefix) + 8
+)
+
+type TokensService struct {
+	repository     *repositories.TokensRepository
+	authRepository *repositories.AuthRepository
+}
+
+func NewTokensService() *TokensService {
+	return &TokensService{
+		repository:     repositories.NewTokensRepository(),
+		authRepository: repositories.NewAuthRepository(),
+	}
+}
+
+// Creates a token for the unlocked vault, the secret is only returned this once
+func (service *TokensService) Create(
+	label string,
+	scopes []string,
+) (*schemas.ResponseTokenCreated, error) {
+	scopes = normalizedScopes(scopes)
+	if len(scopes) == 0 {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"At least one scope is required",
+			nil,
+		)
+	}
+
+	secret, err := newAccessToken()
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Failed to generate access token",
+			err,
+		)
+	}
+
+	// Tokens that never touch the vault get no key to unlock it
+	wrappedKey := ""
+	if models.NeedsVault(scopes) {
+		wrappedKey, err = wrapRootKey(secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token := &models.AccessToken{
+		Label:      label,
+		Prefix:     secret[:accessTokenVisibleLength],
+		Hash:       hashAccessToken(secret),
+		Scopes:     scopes,
+		WrappedKey: wrappedKey,
+		CreatedAt:  time.Now(),
+	}
+
+	token.Id, err = service.repository.CreateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseTokenCreated{
+		ResponseToken: *tokenResponse(token),
+		Token:         secret,
+	}, nil
+}
+
+// Returns the token matching the secret, and unlocks the vault for it if needed
+func (service *TokensService) Authenticate(secret string) (*models.AccessToken, error) {
+	token, err := service.repository.GetTokenByHash(hashAccessToken(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid or revoked access token",
+			nil,
+		)
+	}
+
+	now := time.Now()
+	sessionId := tokenSessionId(token.Id)
+	if token.NeedsVault() && !keyring.TouchSession(sessionId, now.Add(sessionIdleTimeout)) {
+		err = service.unlock(token, secret, sessionId, now.Add(sessionIdleTimeout))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if now.Sub(token.LastUsedAt) >= sessionTouchInterval {
+		err = service.repository.TouchToken(token.Id, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func (service *TokensService) List() ([]*schemas.ResponseToken, error) {
+	tokens, err := service.repository.GetTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*schemas.ResponseToken, len(tokens))
+	for i, token := range tokens {
+		response[i] = tokenResponse(token)
+	}
+
+	return response, nil
+}
+
+func (service *TokensService) Rename(id int, label string) error {
+	renamed, err := service.repository.RenameToken(id, label)
+	if err != nil {
+		return err
+	}
+
+	if !renamed {
+		return schemas.NewAPIError(
+			schemas.ErrTokenNotFound,
+			"Token not found",
+			nil,
+		)
+	}
+
+	return nil
+}
+
+// Revokes a token, it is refused from now on
+func (service *TokensService) Revoke(id int) error {
+	keyring.CloseSession(tokenSessionId(id))
+
+	deleted, err := service.repository.DeleteToken(id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return schemas.NewAPIError(
+			schemas.ErrTokenNotFound,
+			"Token not found",
+			nil,
+		)
+	}
+
+	return nil
+}
+
+func (service *TokensService) RevokeAll() error {
+	tokens, err := service.repository.GetTokens()
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		keyring.CloseSession(tokenSessionId(token.Id))
+	}
+
+	return service.repository.DeleteTokens()
+}
+
+// Unwraps the root key with the token while the vault is locked
+func (service *TokensService) unlock(
+	token *models.AccessToken,
+	secret string,
+	sessionId string,
+	until time.Time,
+) error {
+	if token.WrappedKey == "" {
+		return schemas.NewAPIError(
+			schemas.ErrVaultLocked,
+			"The vault is locked and the access token cannot unlock it",
+			nil,
+		)
+	}
+
+	user, err := service.authRepository.GetUser()
+	if err != nil {
+		return err
+	}
+
+	root, err := encrypt.UnwrapKeyWithPassphrase(token.WrappedKey, secret)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Couldn't unwrap root key with access token",
+			err,
+		)
+	}
+	defer clear(root)
+
+	keyset, err := openKeyset(user, root)
+	if err != nil {
+		return err
+	}
+	defer keyset.Wipe()
+
+	keyring.UnlockSession(sessionId, keyset, until)
+	return nil
+}
+
+// Wraps the root key of the unlocked vault with the token
+func wrapRootKey(secret string) (string, error) {
+	keyset, err := keyring.Current()
+	if err != nil {
+		return "", err
+	}
+	defer keyset.Wipe()
+
+	wrappedKey, err := encrypt.WrapKeyWithPassphrase(keyset.Root, secret)
+	if err != nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't wrap root key",
+			err,
+		)
+	}
+	return wrappedKey, nil
+}
+
+func newAccessToken() (string, error) {
+	secret := make([]byte, accessTokenSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// The token is random and long, a plain hash is enough to store it
+func hashAccessToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tokens hold the keyset under their own keyring session
+func tokenSessionId(id int) string {
+	return fmt.Sprintf("token-%d", id)
+}
+
+// Removes duplicates and keeps the scopes in their documented order
+func normalizedScopes(scopes []string) []string {
+	normalized := []string{}
+	for _, scope := range models.Scopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized
+}
+
+func tokenResponse(token *models.AccessToken) *schemas.ResponseToken {
+	response := &schemas.ResponseToken{
+		Id:        token.Id,
+		Label:     token.Label,
+		Prefix:    token.Prefix,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+	if !token.LastUsedAt.IsZero() {
+		lastUsedAt := token.LastUsedAt
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
+
+// Tells access tokens apart from login JWTs
+func IsAccessToken(credential string) bool {
+	return strings.HasPrefix(credential, AccessTokenPrefix)
+}
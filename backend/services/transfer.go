@@ -1,17 +1,22 @@
 package services
 
 import (
+	"encoding/csv"
 	"fmt"
+	"passenger-go/backend/models"
 	"passenger-go/backend/schemas"
+	"strings"
 )
 
 type TransferService struct {
 	accountsService *AccountsService
+	auditService    *AuditService
 }
 
 func NewTransferService() *TransferService {
 	return &TransferService{
 		accountsService: NewAccountsService(),
+		auditService:    NewAuditService(),
 	}
 }
 
@@ -22,6 +27,7 @@ type ImportResult struct {
 
 func (service *TransferService) Import(
 	accounts []schemas.RequestAccountsUpsert,
+	actor *models.Actor,
 ) (*ImportResult, error) {
 	successCount := 0
 	failedOnes := []schemas.RequestAccountsUpsert{}
@@ -33,8 +39,9 @@ func (service *TransferService) Import(
 			Passphrase: account.Passphrase,
 			Url:        account.Url,
 			Notes:      account.Notes,
+			Totp:       account.Totp,
 			// Strength will be calculated automatically in the service
-		})
+		}, actor)
 		if err != nil {
 			failedOnes = append(failedOnes, account)
 			continue
@@ -42,6 +49,13 @@ func (service *TransferService) Import(
 		successCount++
 	}
 
+	service.auditService.Record(
+		actor,
+		models.AuditVaultImport,
+		"",
+		fmt.Sprintf("%d imported, %d failed", successCount, len(failedOnes)),
+	)
+
 	if successCount > 0 {
 		return &ImportResult{
 			SuccessCount: successCount,
@@ -55,38 +69,45 @@ func (service *TransferService) Import(
 	}, nil
 }
 
-func (service *TransferService) Export() (string, error) {
+func (service *TransferService) Export(actor *models.Actor) (string, error) {
 	accounts, err := service.accountsService.GetAccounts()
 	if err != nil {
 		return "", err
 	}
 
-	csv := "platform,identifier,passphrase,url,notes\n"
+	builder := &strings.Builder{}
+	writer := csv.NewWriter(builder)
+	writer.Write([]string{"platform", "identifier", "passphrase", "url", "notes", "totp"})
+
 	for _, account := range accounts {
 		// Get the full account details including the decrypted passphrase
-		fullAccount, err := service.accountsService.GetAccount(account.Id)
+		fullAccount, err := service.accountsService.accountDetails(account.Id)
 		if err != nil {
 			return "", err
 		}
 
-		csv += convertAccountToCSV(schemas.RequestAccountsUpsert{
-			Platform:   fullAccount.Platform,
-			Identifier: fullAccount.Identifier,
-			Passphrase: fullAccount.Passphrase,
-			Url:        fullAccount.Url,
-			Notes:      fullAccount.Notes,
+		// Quoted by the writer, so notes and otpauth URIs may contain commas
+		writer.Write([]string{
+			fullAccount.Platform,
+			fullAccount.Identifier,
+			fullAccount.Passphrase,
+			fullAccount.Url,
+			fullAccount.Notes,
+			fullAccount.Totp,
 		})
 	}
 
-	return csv, nil
-}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
 
-func convertAccountToCSV(account schemas.RequestAccountsUpsert) string {
-	return fmt.Sprintf("%s,%s,%s,%s,%s\n",
-		account.Platform,
-		account.Identifier,
-		account.Passphrase,
-		account.Url,
-		account.Notes,
+	service.auditService.Record(
+		actor,
+		models.AuditVaultExport,
+		"",
+		fmt.Sprintf("%d accounts", len(accounts)),
 	)
+
+	return builder.String(), nil
 }
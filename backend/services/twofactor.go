@@ -0,0 +1,487 @@
+/**
+ * Optional TOTP two-factor authentication for the vault owner.
+ *
+ * Enrollment Flow:
+ * 1. User requests a new secret, it is kept in memory until confirmed
+ * 2. User scans the otpauth URI (or its QR code) with an authenticator app
+ * 3. User confirms with a code, the secret is stored encrypted with the keyset
+ *    and single-use recovery codes are returned once
+ *
+ * Login Flow:
+ * 1. The passphrase unwraps the keyset, which waits in a login challenge
+ * 2. A TOTP code or a recovery code completes the challenge and opens the session
+ *
+ * A TOTP code is accepted only once, recovery codes are stored as hashes.
+ */
+
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"passenger-go/backend/models"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/keyring"
+	"passenger-go/backend/utilities/otp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	twoFactorIssuer  = "Passenger"
+	twoFactorAccount = "vault"
+	// Accept the previous and next codes as well, for clock drift
+	twoFactorSkew = 1
+
+	loginChallengeLifetime = 5 * time.Minute
+	loginChallengeAttempts = 5
+	enrollmentLifetime     = 10 * time.Minute
+	recoveryCodeCount      = 10
+)
+
+// Logins waiting for a second factor, shared by every service instance
+var pendingLogins = &loginChallenges{challenges: map[string]*loginChallenge{}}
+
+type loginChallenge struct {
+	keyset    *keyring.Keyset
+	expiresAt time.Time
+	attempts  int
+}
+
+type loginChallenges struct {
+	mutex      sync.Mutex
+	challenges map[string]*loginChallenge
+}
+
+// The enrollment waiting for its first code
+var pendingEnrollment = &twoFactorEnrollment{}
+
+type twoFactorEnrollment struct {
+	mutex     sync.Mutex
+	key       *otp.Key
+	expiresAt time.Time
+}
+
+func (service *AuthService) TwoFactorStatus() (*schemas.ResponseTwoFactorStatus, error) {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := decodeRecoveryCodes(user.TwoFactor.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ResponseTwoFactorStatus{
+		Enabled:           user.TwoFactor.Enabled(),
+		RecoveryCodesLeft: len(hashes),
+	}, nil
+}
+
+// Protected by JWT token, starts an enrollment with a new secret
+func (service *AuthService) EnrollTwoFactor() (*schemas.ResponseTwoFactorEnrollment, error) {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactor.Enabled() {
+		return nil, schemas.NewAPIError(
+			schemas.ErrTwoFactorAlreadyEnabled,
+			"Two-factor authentication is already enabled",
+			nil,
+		)
+	}
+
+	key, err := otp.NewKey(twoFactorIssuer, twoFactorAccount)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't generate two-factor secret",
+			err,
+		)
+	}
+
+	qrCode, err := qrcode.Encode(key.URI(), qrcode.Medium, 256)
+	if err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Couldn't generate QR code",
+			err,
+		)
+	}
+
+	pendingEnrollment.start(key)
+
+	return &schemas.ResponseTwoFactorEnrollment{
+		Secret: key.EncodedSecret(),
+		Uri:    key.URI(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	}, nil
+}
+
+// Protected by JWT token, enables two-factor authentication once a code matches
+func (service *AuthService) ConfirmTwoFactor(code string) (*schemas.ResponseTwoFactorRecoveryCodes, error) {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactor.Enabled() {
+		return nil, schemas.NewAPIError(
+			schemas.ErrTwoFactorAlreadyEnabled,
+			"Two-factor authentication is already enabled",
+			nil,
+		)
+	}
+
+	key := pendingEnrollment.current()
+	if key == nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidRequest,
+			"The two-factor enrollment has expired, please start again",
+			nil,
+		)
+	}
+
+	step, ok := key.Validate(code, time.Now(), twoFactorSkew)
+	if !ok {
+		return nil, schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid two-factor code",
+			nil,
+		)
+	}
+
+	encryptedSecret, err := encrypt.Encrypt(key.EncodedSecret(), userField("totp_secret", user.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashedCodes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.repository.UpdateTwoFactor(&models.TwoFactor{
+		Secret:        encryptedSecret,
+		RecoveryCodes: hashedCodes,
+		LastStep:      step,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pendingEnrollment.clear()
+
+	return &schemas.ResponseTwoFactorRecoveryCodes{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// Protected by JWT token, the passphrase is required on top of the session
+func (service *AuthService) DisableTwoFactor(passphrase string) error {
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactor.Enabled() {
+		return schemas.NewAPIError(
+			schemas.ErrTwoFactorNotEnabled,
+			"Two-factor authentication is not enabled",
+			nil,
+		)
+	}
+
+	matches, _, err := encrypt.VerifyPassword(passphrase, user.Passphrase)
+	if err != nil || !matches {
+		return schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid passphrase",
+			err,
+		)
+	}
+
+	return service.repository.UpdateTwoFactor(&models.TwoFactor{})
+}
+
+// Completes a login challenge with a TOTP code or a recovery code
+func (service *AuthService) CompleteLogin(
+	challenge string,
+	code string,
+	device *models.Device,
+) (string, error) {
+	keyset := pendingLogins.keyset(challenge)
+	if keyset == nil {
+		return "", schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"The login has expired, please enter your passphrase again",
+			nil,
+		)
+	}
+	defer keyset.Wipe()
+
+	user, err := service.repository.GetUser()
+	if err != nil {
+		return "", err
+	}
+
+	verified, err := service.verifySecondFactor(user, keyset, code)
+	if err != nil {
+		return "", err
+	}
+
+	if !verified {
+		pendingLogins.fail(challenge)
+		err := schemas.NewAPIError(
+			schemas.ErrInvalidCredentials,
+			"Invalid two-factor code",
+			nil,
+		)
+		service.recordFailure(models.AuditLoginFailure, device.Address, err, "two-factor code")
+		return "", err
+	}
+
+	pendingLogins.close(challenge)
+	return service.openSession(user, keyset, device)
+}
+
+func (service *AuthService) verifySecondFactor(
+	user *models.User,
+	keyset *keyring.Keyset,
+	code string,
+) (bool, error) {
+	if !user.TwoFactor.Enabled() {
+		return true, nil
+	}
+
+	secret, err := encrypt.DecryptWithKeyset(
+		keyset,
+		user.TwoFactor.Secret,
+		userField("totp_secret", user.Id),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := otp.NewKeyFromSecret(secret)
+	if err != nil {
+		return false, schemas.NewAPIError(
+			schemas.ErrDecryptionFailed,
+			"Invalid two-factor secret",
+			err,
+		)
+	}
+
+	if step, ok := key.Validate(code, time.Now(), twoFactorSkew); ok {
+		// A code that was already used is refused
+		return service.repository.UseTwoFactorStep(step)
+	}
+
+	return service.useRecoveryCode(user, code)
+}
+
+// Recovery codes are single use, a matching one is removed
+func (service *AuthService) useRecoveryCode(user *models.User, code string) (bool, error) {
+	hashes, err := decodeRecoveryCodes(user.TwoFactor.RecoveryCodes)
+	if err != nil {
+		return false, err
+	}
+
+	hashed := hashRecoveryCode(code)
+	for index, candidate := range hashes {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(hashed)) != 1 {
+			continue
+		}
+
+		remaining := append(hashes[:index:index], hashes[index+1:]...)
+		encoded, err := json.Marshal(remaining)
+		if err != nil {
+			return false, schemas.NewAPIError(
+				schemas.ErrUnexpected,
+				"Couldn't encode recovery codes",
+				err,
+			)
+		}
+
+		// Fails if the same code was used concurrently
+		return service.repository.ReplaceTwoFactorRecoveryCodes(
+			user.TwoFactor.RecoveryCodes,
+			string(encoded),
+		)
+	}
+
+	return false, nil
+}
+
+// Returns the recovery codes to show once, and their hashes to store
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for index := range codes {
+		random := make([]byte, 5)
+		if _, err := rand.Read(random); err != nil {
+			return nil, "", schemas.NewAPIError(
+				schemas.ErrRecoveryGenerationFailed,
+				"Couldn't generate recovery codes",
+				err,
+			)
+		}
+
+		encoded := strings.ToLower(encoding.EncodeToString(random))
+		codes[index] = encoded[:4] + "-" + encoded[4:]
+		hashes[index] = hashRecoveryCode(codes[index])
+	}
+
+	serialized, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", schemas.NewAPIError(
+			schemas.ErrUnexpected,
+			"Couldn't encode recovery codes",
+			err,
+		)
+	}
+
+	return codes, string(serialized), nil
+}
+
+func decodeRecoveryCodes(serialized string) ([]string, error) {
+	hashes := []string{}
+	if serialized == "" {
+		return hashes, nil
+	}
+
+	if err := json.Unmarshal([]byte(serialized), &hashes); err != nil {
+		return nil, schemas.NewAPIError(
+			schemas.ErrDatabase,
+			"Invalid recovery codes",
+			err,
+		)
+	}
+	return hashes, nil
+}
+
+// Recovery codes are random, a plain hash is enough to store them
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// Binds a ciphertext to its column of the user table
+func userField(column string, id int) []byte {
+	return encrypt.AssociatedData("user", column, strconv.Itoa(id))
+}
+
+func (challenges *loginChallenges) open(keyset *keyring.Keyset) (string, error) {
+	identifier := make([]byte, 16)
+	if _, err := rand.Read(identifier); err != nil {
+		return "", err
+	}
+	challenge := hex.EncodeToString(identifier)
+
+	challenges.mutex.Lock()
+	defer challenges.mutex.Unlock()
+
+	challenges.prune()
+	challenges.challenges[challenge] = &loginChallenge{
+		keyset:    keyset.Clone(),
+		expiresAt: time.Now().Add(loginChallengeLifetime),
+	}
+
+	return challenge, nil
+}
+
+// Returns a copy of the keyset waiting for the challenge, nil if it expired
+func (challenges *loginChallenges) keyset(challenge string) *keyring.Keyset {
+	challenges.mutex.Lock()
+	defer challenges.mutex.Unlock()
+
+	challenges.prune()
+	pending, ok := challenges.challenges[challenge]
+	if !ok {
+		return nil
+	}
+	return pending.keyset.Clone()
+}
+
+// Counts a wrong code, the challenge is dropped after too many of them
+func (challenges *loginChallenges) fail(challenge string) {
+	challenges.mutex.Lock()
+	defer challenges.mutex.Unlock()
+
+	pending, ok := challenges.challenges[challenge]
+	if !ok {
+		return
+	}
+
+	pending.attempts++
+	if pending.attempts >= loginChallengeAttempts {
+		pending.keyset.Wipe()
+		delete(challenges.challenges, challenge)
+	}
+}
+
+func (challenges *loginChallenges) close(challenge string) {
+	challenges.mutex.Lock()
+	defer challenges.mutex.Unlock()
+
+	if pending, ok := challenges.challenges[challenge]; ok {
+		pending.keyset.Wipe()
+		delete(challenges.challenges, challenge)
+	}
+}
+
+// Must be called with the mutex locked
+func (challenges *loginChallenges) prune() {
+	now := time.Now()
+	for challenge, pending := range challenges.challenges {
+		if now.After(pending.expiresAt) {
+			pending.keyset.Wipe()
+			delete(challenges.challenges, challenge)
+		}
+	}
+}
+
+func (enrollment *twoFactorEnrollment) start(key *otp.Key) {
+	enrollment.mutex.Lock()
+	defer enrollment.mutex.Unlock()
+
+	enrollment.key = key
+	enrollment.expiresAt = time.Now().Add(enrollmentLifetime)
+}
+
+func (enrollment *twoFactorEnrollment) current() *otp.Key {
+	enrollment.mutex.Lock()
+	defer enrollment.mutex.Unlock()
+
+	if enrollment.key == nil || time.Now().After(enrollment.expiresAt) {
+		enrollment.key = nil
+		return nil
+	}
+	return enrollment.key
+}
+
+func (enrollment *twoFactorEnrollment) clear() {
+	enrollment.mutex.Lock()
+	defer enrollment.mutex.Unlock()
+
+	enrollment.key = nil
+}
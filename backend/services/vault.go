@@ -0,0 +1,214 @@
+/**
+ * Data key rotation.
+ * A rotation adds a new active data key to the keyset and re-encrypts
+ * every encrypted column with it in a single transaction. Previous keys
+ * stay in the keyset as retired keys, so anything still encrypted with
+ * them remains readable.
+ */
+
+package services
+
+import (
+	"passenger-go/backend/repositories"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/keyring"
+	"passenger-go/backend/utilities/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+type VaultService struct {
+	repository *repositories.VaultRepository
+}
+
+func NewVaultService() *VaultService {
+	return &VaultService{
+		repository: repositories.NewVaultRepository(),
+	}
+}
+
+// Shared by every service instance, only one rotation can run at a time
+var rotation = &rotationTracker{}
+
+type rotationTracker struct {
+	mutex  sync.Mutex
+	status schemas.ResponseRotationStatus
+}
+
+func (service *VaultService) GetKeys() ([]*schemas.ResponseVaultKey, error) {
+	keyset, err := keyring.Current()
+	if err != nil {
+		return nil, err
+	}
+	defer keyset.Wipe()
+
+	keys := []*schemas.ResponseVaultKey{}
+	for _, key := range keyset.Keys {
+		keys = append(keys, &schemas.ResponseVaultKey{
+			Id:        key.Id,
+			CreatedAt: key.CreatedAt,
+			Active:    key.Id == keyset.Active,
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Id < keys[j].Id
+	})
+
+	return keys, nil
+}
+
+func (service *VaultService) RotationStatus() *schemas.ResponseRotationStatus {
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+
+	status := rotation.status
+	return &status
+}
+
+// Starts a rotation in the background, progress is read with RotationStatus
+func (service *VaultService) StartRotation() (*schemas.ResponseRotationStatus, error) {
+	keyset, err := keyring.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	material, err := encrypt.GenerateDataKey()
+	if err != nil {
+		keyset.Wipe()
+		return nil, schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't generate data key",
+			err,
+		)
+	}
+
+	rotated := keyset.Rotate(material)
+	keyset.Wipe()
+
+	rotation.mutex.Lock()
+	if rotation.status.Running {
+		rotation.mutex.Unlock()
+		rotated.Wipe()
+		return nil, schemas.NewAPIError(
+			schemas.ErrRotationInProgress,
+			"A key rotation is already running",
+			nil,
+		)
+	}
+	startedAt := time.Now()
+	rotation.status = schemas.ResponseRotationStatus{
+		Running:     true,
+		ActiveKeyId: rotated.Active,
+		StartedAt:   &startedAt,
+	}
+	rotation.mutex.Unlock()
+
+	go service.rotate(rotated)
+
+	return service.RotationStatus(), nil
+}
+
+func (service *VaultService) rotate(rotated *keyring.Keyset) {
+	defer rotated.Wipe()
+	log := logger.GetLogger()
+
+	err := service.Rotate(rotated, func(processed int, total int) {
+		rotation.mutex.Lock()
+		defer rotation.mutex.Unlock()
+
+		rotation.status.Processed = processed
+		rotation.status.Total = total
+	})
+
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+
+	finishedAt := time.Now()
+	rotation.status.Running = false
+	rotation.status.FinishedAt = &finishedAt
+
+	if err != nil {
+		rotation.status.Error = err.Error()
+		log.Printf("Key rotation failed: %v", err)
+		return
+	}
+
+	log.Printf(
+		"Key rotation finished, %d rows re-encrypted with key %d",
+		rotation.status.Processed,
+		rotated.Active,
+	)
+}
+
+// Rotate re-encrypts the vault with the active key of the rotated keyset
+func (service *VaultService) Rotate(
+	rotated *keyring.Keyset,
+	progress repositories.ProgressFunc,
+) error {
+	sealedKeyset, err := encrypt.SealKeyset(rotated)
+	if err != nil {
+		return schemas.NewAPIError(
+			schemas.ErrEncryptionFailed,
+			"Couldn't seal keyset",
+			err,
+		)
+	}
+
+	err = service.repository.RotateKeyset(
+		reencryptTo(rotated, decryptStored(rotated)),
+		progress,
+		sealedKeyset,
+	)
+	if err != nil {
+		return err
+	}
+
+	keyring.Replace(rotated)
+	return nil
+}
+
+// Decrypts each value with decrypt and encrypts it again with the active
+// key of the keyset, bound to its row and column. Also computes the blind
+// index of indexed fields.
+func reencryptTo(
+	keyset *keyring.Keyset,
+	decrypt func(value string, associatedData []byte) (string, error),
+) repositories.ReencryptFunc {
+	return func(
+		field repositories.EncryptedField,
+		value string,
+	) (string, string, error) {
+		associatedData := encrypt.AssociatedData(field.Table, field.Column, field.RowId)
+
+		decrypted, err := decrypt(value, associatedData)
+		if err != nil {
+			return "", "", err
+		}
+
+		encrypted, err := encrypt.EncryptWithKeyset(keyset, decrypted, associatedData)
+		if err != nil {
+			return "", "", err
+		}
+
+		if !field.Indexed {
+			return encrypted, "", nil
+		}
+		return encrypted, encrypt.BlindIndexWithKeyset(keyset, decrypted), nil
+	}
+}
+
+// Decrypts values encrypted with the keyset, including ones written
+// before ciphertexts were bound to their row and column
+func decryptStored(
+	keyset *keyring.Keyset,
+) func(value string, associatedData []byte) (string, error) {
+	return func(value string, associatedData []byte) (string, error) {
+		if encrypt.IsBound(value) {
+			return encrypt.DecryptWithKeyset(keyset, value, associatedData)
+		}
+		return encrypt.DecryptUnboundWithKeyset(keyset, value)
+	}
+}
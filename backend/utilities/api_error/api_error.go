@@ -2,20 +2,16 @@ package api_error
 
 import (
 	"net/http"
-	"os"
 	"passenger-go/backend/errors"
 	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/config"
 	"passenger-go/backend/utilities/logger"
-
-	"github.com/joho/godotenv"
 )
 
 var isDev = false
 
-func init() {
-	godotenv.Load()
-
-	isDev = os.Getenv("MODE") == "development"
+func Configure(config *config.Config) {
+	isDev = config.Mode == "development"
 }
 
 var log = logger.GetLogger()
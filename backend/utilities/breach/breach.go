@@ -0,0 +1,143 @@
+/**
+ * Breached passphrase lookups.
+ * A passphrase is looked up by the uppercase hex SHA-1 of its bytes, the
+ * hash Have I Been Pwned publishes. Two sources answer the same question:
+ * the range API, which only receives the first 5 characters of the hash
+ * (k-anonymity) and works with any mirror of the protocol, and a local
+ * dataset of hash prefixes for servers without network access.
+ */
+
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Characters of the hash sent to the range API
+	RangePrefixLength = 5
+	// Characters of the hash kept by the local dataset, 64 bits make false matches negligible
+	DatasetPrefixLength = 16
+)
+
+var ErrInvalidDataset = errors.New("invalid breach dataset")
+
+// Answers how many times a hash appears in known breaches, 0 when it doesn't
+type Source interface {
+	Occurrences(hash string) (int, error)
+}
+
+// The uppercase hex SHA-1 of the passphrase
+func Hash(passphrase string) string {
+	sum := sha1.Sum([]byte(passphrase))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Speaks the Have I Been Pwned range API protocol
+type RangeSource struct {
+	baseUrl string
+	client  *http.Client
+}
+
+func NewRangeSource(baseUrl string) *RangeSource {
+	return &RangeSource{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Fetches every suffix of the hash prefix and looks for the rest of the hash.
+// Padding asks the server to hide the size of the response.
+func (source *RangeSource) Occurrences(hash string) (int, error) {
+	prefix, suffix := hash[:RangePrefixLength], hash[RangePrefixLength:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		source.baseUrl+"/range/"+prefix,
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Add-Padding", "true")
+	request.Header.Set("User-Agent", "passenger-go")
+
+	response, err := source.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach range API returned %s", response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+
+		// Padding entries have a count of 0
+		return strconv.Atoi(count)
+	}
+
+	return 0, scanner.Err()
+}
+
+// Reads a dataset with one hash per line, optionally followed by ":count"
+// as in the files of the Have I Been Pwned downloader. Hashes may be
+// truncated to DatasetPrefixLength characters, longer ones are truncated
+// before they are passed on.
+func ReadDataset(reader io.Reader, add func(prefix string, count int) error) error {
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, countText, hasCount := strings.Cut(text, ":")
+		count := 1
+		if hasCount {
+			parsed, err := strconv.Atoi(countText)
+			if err != nil || parsed < 0 {
+				return fmt.Errorf("%w: invalid count on line %d", ErrInvalidDataset, line)
+			}
+			count = parsed
+		}
+
+		if len(hash) < DatasetPrefixLength || len(hash) > sha1.Size*2 {
+			return fmt.Errorf("%w: invalid hash length on line %d", ErrInvalidDataset, line)
+		}
+		if _, err := hex.DecodeString(hash[:DatasetPrefixLength]); err != nil {
+			return fmt.Errorf("%w: invalid hash on line %d", ErrInvalidDataset, line)
+		}
+
+		if count == 0 {
+			continue
+		}
+		if err := add(strings.ToUpper(hash[:DatasetPrefixLength]), count); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
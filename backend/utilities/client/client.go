@@ -0,0 +1,34 @@
+/**
+ * Identifies the client of a request for rate limiting and sessions.
+ * Only the address of the connection is used: forwarded headers
+ * are set by the client itself and would let it pick a new
+ * identity for every request.
+ */
+
+package client
+
+import (
+	"net"
+	"net/http"
+	"passenger-go/backend/models"
+)
+
+func Address(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+
+	if host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+// Device describes the client for the session a login opens
+func Device(request *http.Request) *models.Device {
+	return &models.Device{
+		UserAgent: request.UserAgent(),
+		Address:   Address(request),
+	}
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	BreachSourceApi     = "api"
+	BreachSourceDataset = "dataset"
+	BreachSourceOff     = "off"
+)
+
+// Everything the server is configured with, read once at startup by Load
+type Config struct {
+	Port string
+	// "development" logs the details of API errors
+	Mode string
+	// Holds the database, its backups and the key file
+	DataDir     string
+	FrontendDir string
+
+	JWTSecret    string
+	AESGCMSecret string
+	// Previous values of AESGCMSecret, still accepted for decryption
+	AESGCMRetiredSecrets []string
+	// Only hashes of older versions use it
+	Salt                 string
+	WrapKeyWithEnvSecret bool
+
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+
+	SudoWindow time.Duration
+	SudoReveal bool
+
+	BreachSource        string
+	BreachApiUrl        string
+	BreachCheckInterval time.Duration
+
+	WordlistsDir string
+
+	PassphraseHistoryLimit  int
+	PassphraseHistoryMaxAge time.Duration
+
+	// Set when Load wrote new secrets to the key file
+	SecretsGenerated bool
+}
+
+func (config *Config) DatabasePath() string {
+	return filepath.Join(config.DataDir, "database", "passenger.db")
+}
+
+func (config *Config) KeyFilePath() string {
+	return filepath.Join(config.DataDir, "passenger.key")
+}
+
+// A setting is named by its environment variable. Secrets have no flag, so
+// they don't show up in the process list.
+type setting struct {
+	key          string
+	defaultValue string
+	usage        string
+	secret       bool
+}
+
+var settings = []setting{
+	{key: "CONFIG_FILE", usage: "file of KEY=VALUE settings, defaults to passenger.conf in the data directory"},
+	{key: "DATA_DIR", defaultValue: ".", usage: "directory of the database, its backups and the key file"},
+	{key: "FRONTEND_DIR", defaultValue: "frontend", usage: "directory of the templates and static files"},
+	{key: "PORT", defaultValue: "8080", usage: "port the server listens on"},
+	{key: "MODE", usage: "development logs the details of API errors"},
+	{key: "JWT_SECRET", secret: true},
+	{key: "AES_GCM_SECRET", secret: true},
+	{key: "AES_GCM_RETIRED_SECRETS", secret: true},
+	{key: "SALT", secret: true},
+	{key: "WRAP_KEY_WITH_ENV_SECRET", defaultValue: "false", usage: "also wrap the vault key with AES_GCM_SECRET"},
+	{key: "ARGON2_MEMORY", defaultValue: "65536", usage: "Argon2id memory in KiB"},
+	{key: "ARGON2_TIME", defaultValue: "3", usage: "Argon2id iterations"},
+	{key: "ARGON2_THREADS", defaultValue: "4", usage: "Argon2id threads"},
+	{key: "SUDO_WINDOW", defaultValue: "5m", usage: "how long re-entering the passphrase unlocks sensitive operations"},
+	{key: "SUDO_REVEAL", defaultValue: "false", usage: "ask for the passphrase before revealing any account"},
+	{key: "BREACH_SOURCE", defaultValue: BreachSourceOff, usage: "where passphrases are checked: api, dataset or off"},
+	{key: "BREACH_API_URL", defaultValue: "https://api.pwnedpasswords.com", usage: "base URL of the range API"},
+	{key: "BREACH_CHECK_INTERVAL", defaultValue: "24h", usage: "how often every account is checked, 0 disables it"},
+	{key: "WORDLISTS_DIR", usage: "directory of extra wordlists"},
+	{key: "PASSPHRASE_HISTORY_LIMIT", defaultValue: "10", usage: "previous passphrases kept per account, 0 disables it"},
+	{key: "PASSPHRASE_HISTORY_MAX_AGE", defaultValue: "0", usage: "how long previous passphrases are kept, 0 keeps them"},
+}
+
+// Flags are named after the variable, PORT is -port and DATA_DIR is -data-dir
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// Reads the settings from, in order of precedence: the flags, the environment,
+// a .env file in the working directory, the config file and the key file.
+// Missing secrets are generated into the key file.
+func Load(arguments []string) (*Config, error) {
+	flags := flag.NewFlagSet("passenger-go", flag.ContinueOnError)
+	flagValues := map[string]*string{}
+	for _, setting := range settings {
+		if !setting.secret {
+			flagValues[setting.key] = flags.String(flagName(setting.key), "", setting.usage)
+		}
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	dotenv, err := readOptionalFile(".env")
+	if err != nil {
+		return nil, err
+	}
+
+	// The layers that can't come from the config file are read first
+	layers := []map[string]string{{}, environment(), dotenv}
+	flags.Visit(func(set *flag.Flag) {
+		for key, value := range flagValues {
+			if flagName(key) == set.Name {
+				layers[0][key] = *value
+			}
+		}
+	})
+
+	dataDir := lookup(layers, "DATA_DIR")
+	if dataDir == "" {
+		dataDir = "."
+	}
+
+	configFile, required := lookup(layers, "CONFIG_FILE"), true
+	if configFile == "" {
+		configFile, required = filepath.Join(dataDir, "passenger.conf"), false
+	}
+	fileValues, err := readOptionalFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if required && fileValues == nil {
+		return nil, fmt.Errorf("config file %s doesn't exist", configFile)
+	}
+	for _, key := range []string{"DATA_DIR", "CONFIG_FILE"} {
+		if _, found := fileValues[key]; found {
+			return nil, fmt.Errorf("%s can't be set in the config file", key)
+		}
+	}
+
+	keyFile := filepath.Join(dataDir, "passenger.key")
+	keyValues, err := readKeyFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, fileValues, keyValues)
+
+	generated, err := generateMissingSecrets(keyFile, keyValues, func(key string) bool {
+		return lookup(layers, key) != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for _, setting := range settings {
+		values[setting.key] = setting.defaultValue
+		if value := lookup(layers, setting.key); value != "" {
+			values[setting.key] = value
+		}
+	}
+	values["DATA_DIR"] = dataDir
+
+	config, err := parse(values)
+	if err != nil {
+		return nil, err
+	}
+	config.SecretsGenerated = generated
+	return config, nil
+}
+
+// The first layer that has a value for the key wins
+func lookup(layers []map[string]string, key string) string {
+	for _, layer := range layers {
+		if value := layer[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func environment() map[string]string {
+	values := map[string]string{}
+	for _, setting := range settings {
+		if value, found := os.LookupEnv(setting.key); found {
+			values[setting.key] = value
+		}
+	}
+	return values
+}
+
+// Returns nil when the file doesn't exist
+func readOptionalFile(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s can't be read: %w", path, err)
+	}
+	return values, nil
+}
+
+// Checks every value and converts it, the first invalid one is reported
+func parse(values map[string]string) (*Config, error) {
+	config := &Config{
+		Port:         values["PORT"],
+		Mode:         values["MODE"],
+		DataDir:      values["DATA_DIR"],
+		FrontendDir:  values["FRONTEND_DIR"],
+		JWTSecret:    values["JWT_SECRET"],
+		AESGCMSecret: values["AES_GCM_SECRET"],
+		Salt:         values["SALT"],
+		BreachSource: values["BREACH_SOURCE"],
+		BreachApiUrl: values["BREACH_API_URL"],
+		WordlistsDir: values["WORDLISTS_DIR"],
+	}
+
+	invalid := func(key string, message string) error {
+		return fmt.Errorf("%s %s", key, message)
+	}
+
+	if port, err := strconv.Atoi(config.Port); err != nil || port <= 0 || port > 65535 {
+		return nil, invalid("PORT", "must be a port number")
+	}
+
+	if len(config.AESGCMSecret) != 32 {
+		return nil, invalid("AES_GCM_SECRET", "must be 32 bytes long")
+	}
+	for _, secret := range strings.Split(values["AES_GCM_RETIRED_SECRETS"], ",") {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		if len(secret) != 32 {
+			return nil, invalid("AES_GCM_RETIRED_SECRETS", "must contain 32 bytes long secrets")
+		}
+		config.AESGCMRetiredSecrets = append(config.AESGCMRetiredSecrets, secret)
+	}
+
+	var err error
+	if config.WrapKeyWithEnvSecret, err = strconv.ParseBool(values["WRAP_KEY_WITH_ENV_SECRET"]); err != nil {
+		return nil, invalid("WRAP_KEY_WITH_ENV_SECRET", "must be true or false")
+	}
+	if config.SudoReveal, err = strconv.ParseBool(values["SUDO_REVEAL"]); err != nil {
+		return nil, invalid("SUDO_REVEAL", "must be true or false")
+	}
+
+	memory, err := strconv.ParseUint(values["ARGON2_MEMORY"], 10, 32)
+	if err != nil || memory == 0 {
+		return nil, invalid("ARGON2_MEMORY", "must be a positive number of KiB")
+	}
+	iterations, err := strconv.ParseUint(values["ARGON2_TIME"], 10, 32)
+	if err != nil || iterations == 0 {
+		return nil, invalid("ARGON2_TIME", "must be a positive number")
+	}
+	threads, err := strconv.ParseUint(values["ARGON2_THREADS"], 10, 8)
+	if err != nil || threads == 0 {
+		return nil, invalid("ARGON2_THREADS", "must be a number from 1 to 255")
+	}
+	config.Argon2Memory, config.Argon2Time, config.Argon2Threads = uint32(memory), uint32(iterations), uint8(threads)
+
+	config.SudoWindow, err = time.ParseDuration(values["SUDO_WINDOW"])
+	if err != nil || config.SudoWindow <= 0 {
+		return nil, invalid("SUDO_WINDOW", "must be a positive duration such as 5m")
+	}
+
+	switch config.BreachSource {
+	case BreachSourceApi, BreachSourceDataset, BreachSourceOff:
+	default:
+		return nil, invalid("BREACH_SOURCE", "must be api, dataset or off")
+	}
+	if apiUrl, err := url.Parse(config.BreachApiUrl); err != nil || apiUrl.Scheme == "" || apiUrl.Host == "" {
+		return nil, invalid("BREACH_API_URL", "must be an absolute URL")
+	}
+	config.BreachCheckInterval, err = time.ParseDuration(values["BREACH_CHECK_INTERVAL"])
+	if err != nil || config.BreachCheckInterval < 0 {
+		return nil, invalid("BREACH_CHECK_INTERVAL", "must be a duration such as 24h, or 0 to disable")
+	}
+
+	config.PassphraseHistoryLimit, err = strconv.Atoi(values["PASSPHRASE_HISTORY_LIMIT"])
+	if err != nil || config.PassphraseHistoryLimit < 0 {
+		return nil, invalid("PASSPHRASE_HISTORY_LIMIT", "must be a number of passphrases, or 0 to disable")
+	}
+	config.PassphraseHistoryMaxAge, err = time.ParseDuration(values["PASSPHRASE_HISTORY_MAX_AGE"])
+	if err != nil || config.PassphraseHistoryMaxAge < 0 {
+		return nil, invalid("PASSPHRASE_HISTORY_MAX_AGE", "must be a duration such as 8760h, or 0 to keep them")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+)
+
+// Secrets generated on the first run, with the number of random bytes of each.
+// AES_GCM_SECRET must be 32 characters long, 24 bytes encode to 32.
+var generatedSecrets = []struct {
+	key   string
+	bytes int
+}{
+	{"JWT_SECRET", 32},
+	{"AES_GCM_SECRET", 24},
+	{"SALT", 16},
+}
+
+// The key file holds generated secrets, it must only be readable by its owner
+func readKeyFile(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s must only be readable by its owner, run chmod 600 on it", path)
+	}
+
+	values, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s can't be read: %w", path, err)
+	}
+	return values, nil
+}
+
+// Adds the secrets no other source sets to the key file and tells whether
+// it did. They are never replaced: data encrypted with them would be lost.
+func generateMissingSecrets(path string, keyValues map[string]string, isSet func(key string) bool) (bool, error) {
+	generated := false
+	for _, secret := range generatedSecrets {
+		if isSet(secret.key) {
+			continue
+		}
+
+		value := make([]byte, secret.bytes)
+		if _, err := rand.Read(value); err != nil {
+			return false, err
+		}
+		keyValues[secret.key] = base64.RawURLEncoding.EncodeToString(value)
+		generated = true
+	}
+	if !generated {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, err
+	}
+
+	content, err := godotenv.Marshal(keyValues)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content + "\n"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
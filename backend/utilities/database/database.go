@@ -5,32 +5,35 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 
-	"github.com/joho/godotenv"
 	_ "modernc.org/sqlite"
 )
 
 type database struct {
 	connection *sql.DB
+	path       string
 	mutex      sync.RWMutex
 }
 
-var (
-	instance *database
-	once     sync.Once
-)
+var instance = &database{}
+
+// Opens the database at the path and applies the pending migrations, it must
+// be called before GetDB
+func Open(path string) error {
+	instance.mutex.Lock()
+	instance.path = path
+	instance.mutex.Unlock()
 
-func init() {
-	godotenv.Load()
-	initializeTables()
+	if err := instance.connect(); err != nil {
+		return err
+	}
+	return migrate(instance.connection, filepath.Join(filepath.Dir(path), "backups"))
 }
 
 // A singleton instance of the database connection
 func GetDB() *sql.DB {
-	once.Do(func() {
-		instance = &database{}
-	})
 	connection, err := instance.getConnection()
 	if err != nil {
 		log.Fatal(err)
@@ -45,13 +48,16 @@ func (database *database) connect() error {
 	if database.connection != nil { // Already connected
 		return nil
 	}
+	if database.path == "" {
+		return fmt.Errorf("the database is used before it was opened")
+	}
 
-	// If database/ dir doesn't exist, create it
-	if _, err := os.Stat("database"); os.IsNotExist(err) {
-		os.Mkdir("database", 0755)
+	// If the directory of the database doesn't exist, create it
+	if err := os.MkdirAll(filepath.Dir(database.path), 0700); err != nil {
+		return fmt.Errorf("failed to create the database directory: %w", err)
 	}
 
-	connection, err := sql.Open("sqlite", "file:database/passenger.db")
+	connection, err := sql.Open("sqlite", "file:"+database.path)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -95,20 +101,3 @@ func (database *database) Close() error {
 	}
 	return nil
 }
-
-func initializeTables() {
-	database := GetDB()
-
-	queries := []string{
-		QueryCreateUserTable,
-		QueryCreateAccountsTable,
-		QuerySeedUser,
-	}
-
-	for _, query := range queries {
-		_, err := database.Exec(query)
-		if err != nil {
-			panic(err)
-		}
-	}
-}
@@ -1,29 +1,27 @@
 package database
 
 const (
-	QueryCreateUserTable string = /* A single user table */ `
-	CREATE TABLE IF NOT EXISTS user (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		passphrase TEXT NOT NULL UNIQUE,
-		recovery TEXT NOT NULL UNIQUE,
-		validated BOOLEAN DEFAULT FALSE
+	QueryCreateMigrationsTable string = /* One row per applied migration, the schema version is the highest */ `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
 	)
 	`
-	QueryCreateAccountsTable string = `
-	CREATE TABLE IF NOT EXISTS accounts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		platform TEXT NOT NULL,
-		identifier TEXT NOT NULL,
-		url TEXT DEFAULT NULL,
-		passphrase TEXT NOT NULL,
-		notes TEXT DEFAULT NULL,
-		strength TEXT DEFAULT NULL,
-		UNIQUE(platform, identifier)
-	)
+	QuerySchemaVersion = `
+	SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`
+	QueryMigrationInsert = `
+	INSERT INTO schema_migrations (version, name, applied_at)
+	VALUES (?, ?, ?)
+	`
+	QueryTablesCount = /* Empty for a new database, before the migrations table is created */ `
+	SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'
+	`
+	QueryBackupInto = `
+	VACUUM INTO ?
 	`
-	QuerySeedUser = `
-	INSERT INTO user (passphrase, recovery)
-	SELECT '', ''
-	WHERE NOT EXISTS (SELECT 1 FROM user)
+	QueryTableColumns = `
+	SELECT name FROM pragma_table_info(?)
 	`
 )
@@ -0,0 +1,238 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files are named <version>_<name>.sql and applied in the order of their version
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// A schema change, either SQL or Go code for changes SQL can't express.
+// Every migration runs in its own transaction.
+type migration struct {
+	version int
+	name    string
+	sql     string
+	run     func(transaction *sql.Tx) error
+}
+
+// Migrations written in Go, their versions are shared with the SQL files
+var goMigrations = []migration{
+	{version: 2, name: "added_columns", run: addLegacyColumns},
+}
+
+// Applies the pending migrations at startup. An existing database is backed
+// up first, and one migrated by a newer build is refused.
+func migrate(database *sql.DB, backupsDir string) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to load the database migrations: %w", err)
+	}
+	latest := migrations[len(migrations)-1].version
+
+	var tables int
+	if err := database.QueryRow(QueryTablesCount).Scan(&tables); err != nil {
+		return fmt.Errorf("failed to read the database schema: %w", err)
+	}
+
+	if _, err := database.Exec(QueryCreateMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create the migrations table: %w", err)
+	}
+
+	var current int
+	if err := database.QueryRow(QuerySchemaVersion).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	if current > latest {
+		return fmt.Errorf(
+			"the database schema is at version %d, this build only knows version %d. Run a newer build or restore a backup",
+			current,
+			latest,
+		)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// Databases created before the migrations table have tables but no version
+	if tables > 0 {
+		backup, err := backupDatabase(database, backupsDir, current)
+		if err != nil {
+			return fmt.Errorf("failed to back up the database before migrating: %w", err)
+		}
+		log.Printf("Backed up the database to %s before migrating", backup)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+
+		if err := applyMigration(database, migration); err != nil {
+			return fmt.Errorf("failed to apply migration %04d_%s: %w", migration.version, migration.name, err)
+		}
+		log.Printf("Applied migration %04d_%s", migration.version, migration.name)
+	}
+
+	return nil
+}
+
+// The embedded SQL files and the Go migrations, sorted by version
+func loadMigrations() ([]migration, error) {
+	migrations := append([]migration{}, goMigrations...)
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		prefix, name, found := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("two migrations have version %d", migrations[i].version)
+		}
+	}
+
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("there are no migrations")
+	}
+	return migrations, nil
+}
+
+func applyMigration(database *sql.DB, migration migration) error {
+	transaction, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	if migration.run != nil {
+		err = migration.run(transaction)
+	} else {
+		_, err = transaction.Exec(migration.sql)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(QueryMigrationInsert, migration.version, migration.name, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// Copies the database to the directory, named after the version it had
+func backupDatabase(database *sql.DB, directory string, version int) (string, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+
+	backup := filepath.Join(directory, fmt.Sprintf(
+		"passenger-v%d-%s.db",
+		version,
+		time.Now().UTC().Format("20060102T150405Z"),
+	))
+
+	_, err := database.Exec(QueryBackupInto, backup)
+	return backup, err
+}
+
+// Columns added before migrations were versioned. Databases of those builds
+// may miss any of them, new databases already have them all.
+type addedColumn struct {
+	table      string
+	name       string
+	definition string
+}
+
+var addedColumns = []addedColumn{
+	{"user", "wrapped_key", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "wrapped_key_recovery", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "wrapped_key_env", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "keyset", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "totp_recovery_codes", "TEXT NOT NULL DEFAULT ''"},
+	{"user", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "platform_index", "TEXT DEFAULT NULL"},
+	{"accounts", "identifier_index", "TEXT DEFAULT NULL"},
+	{"accounts", "totp", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "reprompt", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "breached", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "passphrase_changed_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "strength_version", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "policy", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "policy_profile", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "rotation_days", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "created_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"accounts", "updated_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"sessions", "reauthenticated_at", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func addLegacyColumns(transaction *sql.Tx) error {
+	for _, column := range addedColumns {
+		if err := addColumnIfMissing(transaction, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addColumnIfMissing(transaction *sql.Tx, column addedColumn) error {
+	rows, err := transaction.Query(QueryTableColumns, column.table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column.name {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = transaction.Exec(fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN %s %s",
+		column.table,
+		column.name,
+		column.definition,
+	))
+	return err
+}
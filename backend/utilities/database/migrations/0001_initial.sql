@@ -0,0 +1,127 @@
+-- The schema before versioned migrations, existing tables are kept as they are
+
+-- A single user table
+CREATE TABLE IF NOT EXISTS user (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  passphrase TEXT NOT NULL UNIQUE,
+  recovery TEXT NOT NULL UNIQUE,
+  validated BOOLEAN DEFAULT FALSE,
+  wrapped_key TEXT NOT NULL DEFAULT '',
+  wrapped_key_recovery TEXT NOT NULL DEFAULT '',
+  wrapped_key_env TEXT NOT NULL DEFAULT '',
+  keyset TEXT NOT NULL DEFAULT '',
+  totp_secret TEXT NOT NULL DEFAULT '',
+  totp_recovery_codes TEXT NOT NULL DEFAULT '',
+  totp_last_step INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  platform TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  url TEXT DEFAULT NULL,
+  passphrase TEXT NOT NULL,
+  notes TEXT DEFAULT NULL,
+  strength TEXT DEFAULT NULL,
+  platform_index TEXT DEFAULT NULL,
+  identifier_index TEXT DEFAULT NULL,
+  totp TEXT NOT NULL DEFAULT '',
+  reprompt INTEGER NOT NULL DEFAULT 0,
+  breached TEXT NOT NULL DEFAULT '',
+  passphrase_changed_at INTEGER NOT NULL DEFAULT 0,
+  strength_version INTEGER NOT NULL DEFAULT 0,
+  policy TEXT NOT NULL DEFAULT '',
+  policy_profile TEXT NOT NULL DEFAULT '',
+  rotation_days INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0,
+  updated_at INTEGER NOT NULL DEFAULT 0
+);
+
+-- Failed authentication attempts per client and endpoint
+CREATE TABLE IF NOT EXISTS attempts (
+  client TEXT NOT NULL,
+  endpoint TEXT NOT NULL,
+  failures INTEGER NOT NULL DEFAULT 0,
+  locked_until INTEGER NOT NULL DEFAULT 0,
+  last_attempt INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (client, endpoint)
+);
+
+-- Logged in devices, a token is only accepted while its session exists
+CREATE TABLE IF NOT EXISTS sessions (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  address TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL,
+  last_seen_at INTEGER NOT NULL,
+  expires_at INTEGER NOT NULL,
+  reauthenticated_at INTEGER NOT NULL DEFAULT 0
+);
+
+-- Personal access tokens, only a hash of each token is stored
+CREATE TABLE IF NOT EXISTS tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  label TEXT NOT NULL DEFAULT '',
+  prefix TEXT NOT NULL,
+  hash TEXT NOT NULL UNIQUE,
+  scopes TEXT NOT NULL DEFAULT '',
+  wrapped_key TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  last_used_at INTEGER NOT NULL DEFAULT 0
+);
+
+-- Append-only, every event is chained to the previous one with an HMAC
+CREATE TABLE IF NOT EXISTS audit_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at INTEGER NOT NULL,
+  event TEXT NOT NULL,
+  account_id TEXT NOT NULL DEFAULT '',
+  address TEXT NOT NULL DEFAULT '',
+  session_id TEXT NOT NULL DEFAULT '',
+  token_id INTEGER NOT NULL DEFAULT 0,
+  details TEXT NOT NULL DEFAULT '',
+  hash TEXT NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update
+BEFORE UPDATE ON audit_events
+BEGIN
+  SELECT RAISE(ABORT, 'audit events are append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete
+BEFORE DELETE ON audit_events
+BEGIN
+  SELECT RAISE(ABORT, 'audit events are append-only');
+END;
+
+-- Local breach dataset, hash prefixes with their number of occurrences
+CREATE TABLE IF NOT EXISTS breach_hashes (
+  prefix TEXT PRIMARY KEY,
+  count INTEGER NOT NULL
+) WITHOUT ROWID;
+
+-- Named passphrase policies shared by accounts, stored as JSON
+CREATE TABLE IF NOT EXISTS policies (
+  name TEXT PRIMARY KEY,
+  policy TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+
+-- Replaced passphrases of accounts, encrypted like the accounts
+CREATE TABLE IF NOT EXISTS account_passphrase_history (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  account_id INTEGER NOT NULL,
+  passphrase TEXT NOT NULL,
+  reprompt INTEGER NOT NULL DEFAULT 0,
+  replaced_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_passphrase_history_account
+ON account_passphrase_history (account_id, replaced_at);
+
+INSERT INTO user (passphrase, recovery)
+SELECT '', ''
+WHERE NOT EXISTS (SELECT 1 FROM user);
@@ -0,0 +1,3 @@
+-- Encrypted values are random, uniqueness uses the blind indexes, it needs the columns added by 0002
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_blind_index
+ON accounts (platform_index, identifier_index);
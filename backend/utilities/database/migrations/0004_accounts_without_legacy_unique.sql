@@ -0,0 +1,45 @@
+-- Databases created before the blind indexes still have UNIQUE(platform, identifier)
+-- on the encrypted columns, the table is rebuilt without it
+CREATE TABLE accounts_rebuilt (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  platform TEXT NOT NULL,
+  identifier TEXT NOT NULL,
+  url TEXT DEFAULT NULL,
+  passphrase TEXT NOT NULL,
+  notes TEXT DEFAULT NULL,
+  strength TEXT DEFAULT NULL,
+  platform_index TEXT DEFAULT NULL,
+  identifier_index TEXT DEFAULT NULL,
+  totp TEXT NOT NULL DEFAULT '',
+  reprompt INTEGER NOT NULL DEFAULT 0,
+  breached TEXT NOT NULL DEFAULT '',
+  passphrase_changed_at INTEGER NOT NULL DEFAULT 0,
+  strength_version INTEGER NOT NULL DEFAULT 0,
+  policy TEXT NOT NULL DEFAULT '',
+  policy_profile TEXT NOT NULL DEFAULT '',
+  rotation_days INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0,
+  updated_at INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO accounts_rebuilt (
+  id, platform, identifier, url, passphrase, notes, strength, platform_index,
+  identifier_index, totp, reprompt, breached, passphrase_changed_at,
+  strength_version, policy, policy_profile, rotation_days, created_at, updated_at
+)
+SELECT
+  id, platform, identifier, url, passphrase, notes, strength, platform_index,
+  identifier_index, totp, reprompt, breached, passphrase_changed_at,
+  strength_version, policy, policy_profile, rotation_days, created_at, updated_at
+FROM accounts;
+
+-- Ciphertexts are bound to their row id, ids of deleted accounts are never reused
+DELETE FROM sqlite_sequence WHERE name = 'accounts_rebuilt';
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'accounts_rebuilt', seq FROM sqlite_sequence WHERE name = 'accounts';
+
+DROP TABLE accounts;
+ALTER TABLE accounts_rebuilt RENAME TO accounts;
+
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_blind_index
+ON accounts (platform_index, identifier_index);
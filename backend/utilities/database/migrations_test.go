@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The schema of the first release, before any column was added
+const legacySchema = `
+CREATE TABLE user (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	passphrase TEXT NOT NULL UNIQUE,
+	recovery TEXT NOT NULL UNIQUE,
+	validated BOOLEAN DEFAULT FALSE
+);
+CREATE TABLE accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	platform TEXT NOT NULL,
+	identifier TEXT NOT NULL,
+	url TEXT DEFAULT NULL,
+	passphrase TEXT NOT NULL,
+	notes TEXT DEFAULT NULL,
+	strength TEXT DEFAULT NULL,
+	UNIQUE(platform, identifier)
+);
+INSERT INTO user (passphrase, recovery) VALUES ('hash', 'recovery');
+INSERT INTO accounts (platform, identifier, passphrase) VALUES
+	('github', 'me', 'one'),
+	('gitlab', 'me', 'two'),
+	('deleted', 'me', 'three');
+DELETE FROM accounts WHERE platform = 'deleted';
+`
+
+func openTestDatabase(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	directory := t.TempDir()
+	connection, err := sql.Open("sqlite", "file:"+filepath.Join(directory, "passenger.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connection.Close() })
+
+	return connection, directory
+}
+
+func latestVersion(t *testing.T) int {
+	t.Helper()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations[len(migrations)-1].version
+}
+
+func schemaVersion(t *testing.T, connection *sql.DB) int {
+	t.Helper()
+
+	var version int
+	if err := connection.QueryRow(QuerySchemaVersion).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestMigrateUpgradesALegacyDatabase(t *testing.T) {
+	connection, directory := openTestDatabase(t)
+	if _, err := connection.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := filepath.Join(directory, "backups")
+	if err := migrate(connection, backups); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := schemaVersion(t, connection); version != latestVersion(t) {
+		t.Errorf("schema at version %d, want %d", version, latestVersion(t))
+	}
+
+	entries, err := os.ReadDir(backups)
+	if err != nil || len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "passenger-v0-") {
+		t.Errorf("no backup of the legacy database was made (%v)", err)
+	}
+
+	// The rows and their ids are kept, deleted ids are not handed out again
+	rows, err := connection.Query("SELECT id, platform, passphrase, totp, reprompt FROM accounts ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	kept := []string{}
+	for rows.Next() {
+		var id, reprompt int
+		var platform, passphrase, totp string
+		if err := rows.Scan(&id, &platform, &passphrase, &totp, &reprompt); err != nil {
+			t.Fatal(err)
+		}
+		kept = append(kept, platform+":"+passphrase)
+	}
+	if strings.Join(kept, ",") != "github:one,gitlab:two" {
+		t.Errorf("accounts after the migration: %v", kept)
+	}
+
+	var id int64
+	err = connection.QueryRow(
+		"INSERT INTO accounts (platform, identifier, passphrase) VALUES ('new', 'me', 'four') RETURNING id",
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 {
+		t.Errorf("new account got id %d, want 4", id)
+	}
+}
+
+func TestMigrateDropsTheLegacyUniqueConstraint(t *testing.T) {
+	connection, directory := openTestDatabase(t)
+	if _, err := connection.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(connection, filepath.Join(directory, "backups")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ciphertexts are random, only the blind indexes tell accounts apart
+	_, err := connection.Exec(`
+	INSERT INTO accounts (platform, identifier, passphrase, platform_index, identifier_index) VALUES
+		('same', 'same', 'a', 'p1', 'i1'),
+		('same', 'same', 'b', 'p2', 'i2')
+	`)
+	if err != nil {
+		t.Fatalf("the legacy constraint is still there: %v", err)
+	}
+
+	_, err = connection.Exec(`
+	INSERT INTO accounts (platform, identifier, passphrase, platform_index, identifier_index)
+	VALUES ('other', 'other', 'c', 'p1', 'i1')
+	`)
+	if err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		t.Errorf("a duplicate blind index was accepted (%v)", err)
+	}
+}
+
+func TestMigrateCreatesANewDatabase(t *testing.T) {
+	connection, directory := openTestDatabase(t)
+	backups := filepath.Join(directory, "backups")
+
+	if err := migrate(connection, backups); err != nil {
+		t.Fatal(err)
+	}
+	if version := schemaVersion(t, connection); version != latestVersion(t) {
+		t.Errorf("schema at version %d, want %d", version, latestVersion(t))
+	}
+	if _, err := os.Stat(backups); !os.IsNotExist(err) {
+		t.Error("an empty database was backed up")
+	}
+
+	// Applying them again changes nothing
+	if err := migrate(connection, backups); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRefusesANewerSchema(t *testing.T) {
+	connection, directory := openTestDatabase(t)
+	backups := filepath.Join(directory, "backups")
+
+	if err := migrate(connection, backups); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connection.Exec(QueryMigrationInsert, latestVersion(t)+1, "from_the_future", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(connection, backups); err == nil {
+		t.Error("a database migrated by a newer build was accepted")
+	}
+}
@@ -0,0 +1,168 @@
+/**
+ * Argon2id hashing in the PHC string format:
+ * $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+ *
+ * The cost parameters are stored next to every hash, so they can be
+ * raised with ARGON2_MEMORY, ARGON2_TIME and ARGON2_THREADS without
+ * breaking existing hashes. Hashes with lower costs are reported as
+ * needing a rehash.
+ */
+
+package encrypt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2HashLength = 32
+)
+
+var (
+	ErrInvalidHash = errors.New("invalid argon2id hash")
+
+	defaultArgon2Params = argon2Params{
+		memory:  64 * 1024,
+		time:    3,
+		threads: 4,
+	}
+	configuredArgon2Params = defaultArgon2Params
+
+	// Hashes of older versions were all salted with SALT
+	legacySalt = []byte{}
+)
+
+// HashPassword creates a salted Argon2id hash of the password in PHC format
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	params := configuredArgon2Params
+	hash := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.time,
+		params.memory,
+		params.threads,
+		argon2HashLength,
+	)
+
+	return formatArgon2id(params, salt, hash), nil
+}
+
+// VerifyPassword checks the password against the hash in constant time.
+// needsRehash is true when the hash is weaker than the configured costs.
+func VerifyPassword(password, hashedPassword string) (matches bool, needsRehash bool, err error) {
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return verifyLegacyPassword(password, hashedPassword), true, nil
+	}
+
+	params, salt, hash, err := parseArgon2id(hashedPassword)
+	if err != nil {
+		return false, false, err
+	}
+
+	computed := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.time,
+		params.memory,
+		params.threads,
+		uint32(len(hash)),
+	)
+
+	if subtle.ConstantTimeCompare(computed, hash) != 1 {
+		return false, false, nil
+	}
+
+	configured := configuredArgon2Params
+	needsRehash = params.memory < configured.memory ||
+		params.time < configured.time ||
+		params.threads < configured.threads ||
+		len(salt) < argon2SaltLength
+
+	return true, needsRehash, nil
+}
+
+// Hashes from older versions used the global SALT and no parameters
+func verifyLegacyPassword(password, hashedPassword string) bool {
+	hash := argon2.IDKey(
+		[]byte(password),
+		legacySalt,
+		1,
+		64*1024,
+		4,
+		32,
+	)
+	encoded := base64.StdEncoding.EncodeToString(hash)
+
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(hashedPassword)) == 1
+}
+
+func formatArgon2id(params argon2Params, salt []byte, payload []byte) string {
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.memory,
+		params.time,
+		params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(payload),
+	)
+}
+
+func parseArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	params := argon2Params{}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	_, err := fmt.Sscanf(
+		parts[3],
+		"m=%d,t=%d,p=%d",
+		&params.memory,
+		&params.time,
+		&params.threads,
+	)
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	payload, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, payload, nil
+}
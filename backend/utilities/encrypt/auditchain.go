@@ -0,0 +1,47 @@
+/**
+ * Audit events are chained with an HMAC-SHA256 of the previous entry's
+ * MAC and the entry itself. The HMAC is keyed with a key derived from
+ * AES_GCM_SECRET, which is not stored in the database: whoever can only
+ * write the database cannot recompute the chain after editing it.
+ * Keys of retired secrets still verify the entries they sealed.
+ */
+
+package encrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const auditChainContext = "passenger-go audit chain v1"
+
+// ChainAuditEntry seals the entry to the MAC of the previous one with the current secret
+func ChainAuditEntry(previous string, entry []byte) string {
+	return auditMAC(deriveAuditKey(aesGCMSecret), previous, entry)
+}
+
+// VerifyAuditEntry checks the MAC of an entry against the current and retired secrets
+func VerifyAuditEntry(previous string, entry []byte, mac string) bool {
+	for _, secret := range environmentSecrets() {
+		expected := auditMAC(deriveAuditKey(secret), previous, entry)
+		if hmac.Equal([]byte(expected), []byte(mac)) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditMAC(key []byte, previous string, entry []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(previous))
+	mac.Write([]byte{0})
+	mac.Write(entry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deriveAuditKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(auditChainContext))
+	return mac.Sum(nil)
+}
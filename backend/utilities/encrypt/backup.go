@@ -0,0 +1,41 @@
+/**
+ * Backups are sealed with a key derived from a passphrase chosen for the
+ * backup, never with the keys of the vault or AES_GCM_SECRET, so they can
+ * be restored on any install. The sealed data uses the PHC layout of
+ * wrapped keys, which records the Argon2id costs it was derived with.
+ */
+
+package encrypt
+
+import "errors"
+
+// A backup comes from outside, its costs must not exhaust the server
+const (
+	maxBackupArgon2Memory  = 1024 * 1024
+	maxBackupArgon2Time    = 16
+	maxBackupArgon2Threads = 16
+)
+
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// SealBackup encrypts the payload, the associated data is authenticated with it
+func SealBackup(payload []byte, passphrase string, associatedData []byte) (string, error) {
+	return sealWithPassphrase(payload, passphrase, associatedData)
+}
+
+// OpenBackup decrypts the payload, failing if the passphrase is wrong or anything was modified
+func OpenBackup(sealed string, passphrase string, associatedData []byte) ([]byte, error) {
+	params, salt, data, err := parseArgon2id(sealed)
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+
+	if params.memory > maxBackupArgon2Memory ||
+		params.time > maxBackupArgon2Time ||
+		params.threads > maxBackupArgon2Threads ||
+		params.time == 0 || params.threads == 0 {
+		return nil, ErrInvalidBackup
+	}
+
+	return openWithPassphrase(params, salt, data, passphrase, associatedData)
+}
@@ -0,0 +1,42 @@
+/**
+ * Blind indexes let the database compare encrypted values without
+ * decrypting them. A blind index is an HMAC-SHA256 of the plaintext,
+ * keyed with a key derived from the root key. The root key never
+ * changes for a vault, so indexes stay valid across data key rotations.
+ */
+
+package encrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"passenger-go/backend/utilities/keyring"
+)
+
+const blindIndexContext = "passenger-go blind index v1"
+
+// BlindIndex computes the blind index of the value with the unlocked keyset
+func BlindIndex(value string) (index string, err error) {
+	err = keyring.With(func(keyset *keyring.Keyset) error {
+		index = BlindIndexWithKeyset(keyset, value)
+		return nil
+	})
+	return index, err
+}
+
+// BlindIndexWithKeyset computes the blind index of the value with the given keyset
+func BlindIndexWithKeyset(keyset *keyring.Keyset, value string) string {
+	indexKey := deriveBlindIndexKey(keyset.Root)
+	defer clear(indexKey)
+
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func deriveBlindIndexKey(root []byte) []byte {
+	mac := hmac.New(sha256.New, root)
+	mac.Write([]byte(blindIndexContext))
+	return mac.Sum(nil)
+}
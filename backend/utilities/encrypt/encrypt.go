@@ -7,144 +7,214 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
-	"os"
-	"passenger-go/backend/utilities/logger"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/config"
+	"passenger-go/backend/utilities/keyring"
+	"strconv"
+	"strings"
 
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
 
-var aesGCMSecret = []byte{}
+var (
+	aesGCMSecret           = []byte{}
+	retiredAESGCMSecrets   = [][]byte{}
+	environmentWrapEnabled = false
+)
+
+// Ciphertexts are prefixed with the format version and the data key id.
+// Version 2 ciphertexts are bound to their table, column and row with
+// AES-GCM associated data, version 1 ciphertexts are not.
+const (
+	ciphertextVersion        = "v2"
+	unboundCiphertextVersion = "v1"
+	BoundCiphertextPrefix    = ciphertextVersion + ":"
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+	ErrUnboundCiphertext = errors.New("ciphertext is not bound to its row and column")
+)
 
-func init() {
-	godotenv.Load()
-	log := logger.GetLogger()
-	aesGCMSecret = []byte(os.Getenv("AES_GCM_SECRET"))
-	if string(aesGCMSecret) == "" {
-		log.Fatal("AES_GCM_SECRET environment variable is not set")
+// The config checked the length of the secrets
+func Configure(config *config.Config) {
+	aesGCMSecret = []byte(config.AESGCMSecret)
+
+	// Previous secrets are still accepted for decryption after a rotation
+	retiredAESGCMSecrets = [][]byte{}
+	for _, secret := range config.AESGCMRetiredSecrets {
+		retiredAESGCMSecrets = append(retiredAESGCMSecrets, []byte(secret))
 	}
 
-	if len(aesGCMSecret) != 32 {
-		log.Fatal("AES_GCM_SECRET must be 32 bytes long")
+	environmentWrapEnabled = config.WrapKeyWithEnvSecret
+	legacySalt = []byte(config.Salt)
+	configuredArgon2Params = argon2Params{
+		memory:  config.Argon2Memory,
+		time:    config.Argon2Time,
+		threads: config.Argon2Threads,
 	}
 }
 
-// HashPassword creates a secure one-way hash of the password using Argon2
-func HashPassword(password string) (string, error) {
-	hash := argon2.IDKey(
-		[]byte(password),
-		[]byte(os.Getenv("SALT")),
-		1,
-		64*1024,
-		4,
-		32,
-	)
-	return base64.StdEncoding.EncodeToString(hash), nil
+// Encrypt encrypts data with the active data key and returns a versioned string.
+// The associated data binds the ciphertext to where it is stored, see AssociatedData.
+func Encrypt(data string, associatedData []byte) (encrypted string, err error) {
+	err = keyring.With(func(keyset *keyring.Keyset) error {
+		encrypted, err = EncryptWithKeyset(keyset, data, associatedData)
+		return err
+	})
+	return encrypted, err
 }
 
-// VerifyPassword checks if the provided password matches the hash
-func VerifyPassword(password, hashedPassword string) (bool, error) {
-	hash, err := HashPassword(password)
-	if err != nil {
-		return false, err
-	}
-	return hash == hashedPassword, nil
+// Decrypt decrypts a versioned string with the data key named in its header,
+// failing if the associated data differs from the one it was encrypted with
+func Decrypt(encryptedData string, associatedData []byte) (decrypted string, err error) {
+	err = keyring.With(func(keyset *keyring.Keyset) error {
+		decrypted, err = DecryptWithKeyset(keyset, encryptedData, associatedData)
+		return err
+	})
+	return decrypted, err
 }
 
-// Encrypt encrypts data using AES-GCM and returns a base64 encoded string
-func Encrypt(data string) (string, error) {
-	return aesGCMEncrypt([]byte(data))
+// AssociatedData names the table, column and row a ciphertext is stored in
+func AssociatedData(table string, column string, rowId string) []byte {
+	return []byte(fmt.Sprintf("passenger-go:%s:%s:%s", table, column, rowId))
 }
 
-// Decrypt decrypts a base64 encoded encrypted string
-func Decrypt(encryptedData string) (string, error) {
-	decrypted, err := aesGCMDecrypt(encryptedData)
+// EncryptWithKeyset encrypts data with the active key of the given keyset
+func EncryptWithKeyset(keyset *keyring.Keyset, data string, associatedData []byte) (string, error) {
+	key, err := keyset.ActiveKey()
 	if err != nil {
 		return "", err
 	}
-	return string(decrypted), nil
-}
-
-// EncryptDeterministic encrypts data deterministically for database uniqueness
-// WARNING: This is less secure than random encryption but needed for database constraints
-func EncryptDeterministic(data string) (string, error) {
-	return aesGCMEncryptDeterministic([]byte(data))
-}
 
-// DecryptDeterministic decrypts deterministically encrypted data
-func DecryptDeterministic(encryptedData string) (string, error) {
-	decrypted, err := aesGCMDecryptDeterministic(encryptedData)
+	encrypted, err := aesGCMEncrypt(key.Material, []byte(data), associatedData)
 	if err != nil {
 		return "", err
 	}
-	return string(decrypted), nil
+
+	return formatCiphertext(key.Id, encrypted), nil
 }
 
-func GenerateRecoveryKey(passphrase string) (string, error) {
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// DecryptWithKeyset decrypts data with the data key of the given keyset named in its header
+func DecryptWithKeyset(keyset *keyring.Keyset, encryptedData string, associatedData []byte) (string, error) {
+	version, keyId, payload, err := parseCiphertext(encryptedData)
+	if err != nil {
+		return "", decryptionFailed(err)
 	}
 
-	derivedKey := pbkdf2.Key([]byte(passphrase), salt, 100000, 32, sha256.New)
-
-	combined := append(salt, derivedKey...)
-	recoveryKey := base64.URLEncoding.EncodeToString(combined)
+	if version != ciphertextVersion {
+		return "", decryptionFailed(ErrUnboundCiphertext)
+	}
 
-	return recoveryKey, nil
+	return decryptPayload(keyset, keyId, payload, associatedData)
 }
 
-func aesGCMEncrypt(data []byte) (string, error) {
-	block, err := aes.NewCipher(aesGCMSecret)
+// DecryptUnboundWithKeyset decrypts data written before ciphertexts were bound
+// to their row and column, it is only meant for re-encrypting such data
+func DecryptUnboundWithKeyset(keyset *keyring.Keyset, encryptedData string) (string, error) {
+	version, keyId, payload, err := parseCiphertext(encryptedData)
 	if err != nil {
-		return "", err
+		return "", decryptionFailed(err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+	if version == ciphertextVersion {
+		return "", decryptionFailed(ErrInvalidCiphertext)
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+	return decryptPayload(keyset, keyId, payload, nil)
+}
+
+// IsBound reports if the ciphertext was encrypted with associated data
+func IsBound(encryptedData string) bool {
+	return strings.HasPrefix(encryptedData, BoundCiphertextPrefix)
+}
+
+// DecryptLegacy decrypts data that was encrypted directly with AES_GCM_SECRET
+func DecryptLegacy(encryptedData string) (string, error) {
+	var lastErr error
+	for _, secret := range environmentSecrets() {
+		decrypted, err := aesGCMDecrypt(secret, encryptedData, nil)
+		if err == nil {
+			return string(decrypted), nil
+		}
+		lastErr = err
 	}
+	return "", lastErr
+}
 
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+// The active secret comes first
+func environmentSecrets() [][]byte {
+	return append([][]byte{aesGCMSecret}, retiredAESGCMSecrets...)
 }
 
-func aesGCMDecrypt(data string) ([]byte, error) {
-	block, err := aes.NewCipher(aesGCMSecret)
+func decryptPayload(
+	keyset *keyring.Keyset,
+	keyId int,
+	payload string,
+	associatedData []byte,
+) (string, error) {
+	key, err := keyset.Key(keyId)
 	if err != nil {
-		return nil, err
+		return "", decryptionFailed(err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	decrypted, err := aesGCMDecrypt(key.Material, payload, associatedData)
 	if err != nil {
-		return nil, err
+		return "", decryptionFailed(err)
 	}
+	return string(decrypted), nil
+}
 
-	decodedData, err := base64.StdEncoding.DecodeString(data)
+func decryptionFailed(err error) error {
+	return schemas.NewAPIError(
+		schemas.ErrDecryptionFailed,
+		"Encrypted data is corrupted or was moved from another row or column",
+		err,
+	)
+}
+
+func formatCiphertext(keyId int, payload string) string {
+	return fmt.Sprintf("%s:%d:%s", ciphertextVersion, keyId, payload)
+}
+
+// Ciphertexts written before versioning have no header and use the first key
+func parseCiphertext(encryptedData string) (string, int, string, error) {
+	version, rest, found := strings.Cut(encryptedData, ":")
+	if !found || (version != ciphertextVersion && version != unboundCiphertextVersion) {
+		return "", keyring.LegacyKeyId, encryptedData, nil
+	}
+
+	keyIdPart, payload, found := strings.Cut(rest, ":")
+	if !found {
+		return "", 0, "", ErrInvalidCiphertext
+	}
+
+	keyId, err := strconv.Atoi(keyIdPart)
 	if err != nil {
-		return nil, err
+		return "", 0, "", ErrInvalidCiphertext
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(decodedData) < nonceSize {
-		return nil, errors.New("ciphertext too short")
+	return version, keyId, payload, nil
+}
+
+func GenerateRecoveryKey(passphrase string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
 	}
 
-	nonce, ciphertext := decodedData[:nonceSize], decodedData[nonceSize:]
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	derivedKey := pbkdf2.Key([]byte(passphrase), salt, 100000, 32, sha256.New)
+
+	combined := append(salt, derivedKey...)
+	recoveryKey := base64.URLEncoding.EncodeToString(combined)
+
+	return recoveryKey, nil
 }
 
-// AESGCMEncryptDeterministic encrypts data with a deterministic nonce derived from the data
-// This always produces the same ciphertext for the same input, suitable for database uniqueness
-func aesGCMEncryptDeterministic(data []byte) (string, error) {
-	block, err := aes.NewCipher(aesGCMSecret)
+func aesGCMEncrypt(key []byte, data []byte, associatedData []byte) (string, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -154,17 +224,18 @@ func aesGCMEncryptDeterministic(data []byte) (string, error) {
 		return "", err
 	}
 
-	// Create deterministic nonce by hashing the data + secret
-	hash := sha256.Sum256(append(data, aesGCMSecret...))
-	nonce := hash[:gcm.NonceSize()] // Use first 12 bytes of hash as nonce
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
 
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, associatedData)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// AESGCMDecryptDeterministic decrypts deterministically encrypted data
-func aesGCMDecryptDeterministic(data string) ([]byte, error) {
-	block, err := aes.NewCipher(aesGCMSecret)
+// Ciphertexts written with deterministic nonces share the same layout, so this also decrypts them
+func aesGCMDecrypt(key []byte, data string, associatedData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -185,5 +256,5 @@ func aesGCMDecryptDeterministic(data string) ([]byte, error) {
 	}
 
 	nonce, ciphertext := decodedData[:nonceSize], decodedData[nonceSize:]
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, associatedData)
 }
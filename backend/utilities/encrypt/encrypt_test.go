@@ -0,0 +1,168 @@
+package encrypt
+
+import (
+	"errors"
+	"passenger-go/backend/schemas"
+	"passenger-go/backend/utilities/keyring"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testField = AssociatedData("accounts", "passphrase", "1")
+
+func newTestKeyset(t *testing.T) *keyring.Keyset {
+	t.Helper()
+
+	root, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	material, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring.NewKeyset(root, material)
+}
+
+func TestEncryptWithKeysetRoundTrip(t *testing.T) {
+	keyset := newTestKeyset(t)
+
+	for _, plaintext := range []string{"", "correct horse battery", "ünïcödé 🔑"} {
+		encrypted, err := EncryptWithKeyset(keyset, plaintext, testField)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encrypted, ciphertextVersion+":1:") {
+			t.Errorf("ciphertext %q doesn't name the active key", encrypted)
+		}
+
+		decrypted, err := DecryptWithKeyset(keyset, encrypted, testField)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("decrypted %q, want %q", decrypted, plaintext)
+		}
+	}
+}
+
+func TestEncryptUsesRandomNonces(t *testing.T) {
+	keyset := newTestKeyset(t)
+
+	first, err := EncryptWithKeyset(keyset, "same", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncryptWithKeyset(keyset, "same", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptWithKeysetRejectsTampering(t *testing.T) {
+	keyset := newTestKeyset(t)
+
+	encrypted, err := EncryptWithKeyset(keyset, "secret", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes the first character of the payload, the header stays valid.
+	// The last characters may only hold padding bits, which decode the same.
+	tampered := []byte(encrypted)
+	index := strings.LastIndex(encrypted, ":") + 1
+	if tampered[index] == 'A' {
+		tampered[index] = 'B'
+	} else {
+		tampered[index] = 'A'
+	}
+
+	if _, err := DecryptWithKeyset(keyset, string(tampered), testField); err == nil {
+		t.Error("a tampered ciphertext was decrypted")
+	}
+
+	if _, err := DecryptWithKeyset(newTestKeyset(t), encrypted, testField); err == nil {
+		t.Error("a ciphertext was decrypted with another keyset")
+	}
+}
+
+func TestDecryptWithKeysetRejectsMovedCiphertexts(t *testing.T) {
+	keyset := newTestKeyset(t)
+
+	encrypted, err := EncryptWithKeyset(keyset, "secret", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := [][]byte{
+		AssociatedData("accounts", "passphrase", "2"),
+		AssociatedData("accounts", "notes", "1"),
+		AssociatedData("account_passphrase_history", "passphrase", "1"),
+		nil,
+	}
+	for _, associatedData := range moved {
+		if _, err := DecryptWithKeyset(keyset, encrypted, associatedData); err == nil {
+			t.Errorf("ciphertext was decrypted as %q", associatedData)
+		}
+	}
+}
+
+func TestRotateKeepsOldCiphertexts(t *testing.T) {
+	keyset := newTestKeyset(t)
+
+	old, err := EncryptWithKeyset(keyset, "before rotation", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	material, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := keyset.Rotate(material)
+
+	current, err := EncryptWithKeyset(rotated, "after rotation", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(current, ciphertextVersion+":2:") {
+		t.Errorf("ciphertext %q doesn't name the rotated key", current)
+	}
+
+	decrypted, err := DecryptWithKeyset(rotated, old, testField)
+	if err != nil || decrypted != "before rotation" {
+		t.Errorf("old ciphertext decrypted to %q after the rotation (%v)", decrypted, err)
+	}
+
+	// The keyset before the rotation doesn't know the new key
+	_, err = DecryptWithKeyset(keyset, current, testField)
+	var apiErr *schemas.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(apiErr.Stack, keyring.ErrUnknownKey) {
+		t.Errorf("got %v, want %v", err, keyring.ErrUnknownKey)
+	}
+}
+
+func TestEncryptNeedsAnUnlockedVault(t *testing.T) {
+	if _, err := Encrypt("secret", testField); err == nil {
+		t.Fatal("encrypted with a locked vault")
+	}
+
+	sessionId, err := keyring.OpenSession(newTestKeyset(t), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyring.CloseSession(sessionId)
+
+	encrypted, err := Encrypt("secret", testField)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := Decrypt(encrypted, testField)
+	if err != nil || decrypted != "secret" {
+		t.Errorf("decrypted %q (%v), want %q", decrypted, err, "secret")
+	}
+}
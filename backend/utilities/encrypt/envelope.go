@@ -0,0 +1,155 @@
+/**
+ * Envelope encryption helpers.
+ * A random data-encryption key encrypts the vault. That key is stored
+ * only in wrapped form: sealed with a key-encryption key derived from
+ * the master passphrase (or the recovery key) using Argon2id, and
+ * optionally sealed with AES_GCM_SECRET as well.
+ *
+ * Wrapped keys use the same PHC layout as password hashes, with the
+ * sealed key in place of the hash:
+ * $argon2id$v=19$m=65536,t=3,p=4$<salt>$<nonce+ciphertext>
+ */
+
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"passenger-go/backend/utilities/keyring"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const dataKeySize = 32
+
+var ErrInvalidWrappedKey = errors.New("invalid wrapped key")
+
+// GenerateDataKey creates a new random data-encryption key
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapKeyWithPassphrase seals the data key with a key derived from the passphrase
+func WrapKeyWithPassphrase(dataKey []byte, passphrase string) (string, error) {
+	return sealWithPassphrase(dataKey, passphrase, nil)
+}
+
+// UnwrapKeyWithPassphrase opens a wrapped key, failing if the passphrase is wrong
+func UnwrapKeyWithPassphrase(wrappedKey string, passphrase string) ([]byte, error) {
+	params, salt, sealed, err := parseArgon2id(wrappedKey)
+	if err != nil {
+		return nil, ErrInvalidWrappedKey
+	}
+
+	return openWithPassphrase(params, salt, sealed, passphrase, nil)
+}
+
+func sealWithPassphrase(data []byte, passphrase string, associatedData []byte) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	params := configuredArgon2Params
+	keyEncryptionKey := deriveKeyEncryptionKey(passphrase, salt, params)
+
+	sealed, err := aesGCMEncrypt(keyEncryptionKey, data, associatedData)
+	if err != nil {
+		return "", err
+	}
+
+	sealedBytes, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	return formatArgon2id(params, salt, sealedBytes), nil
+}
+
+func openWithPassphrase(
+	params argon2Params,
+	salt []byte,
+	sealed []byte,
+	passphrase string,
+	associatedData []byte,
+) ([]byte, error) {
+	keyEncryptionKey := deriveKeyEncryptionKey(passphrase, salt, params)
+
+	return aesGCMDecrypt(
+		keyEncryptionKey,
+		base64.StdEncoding.EncodeToString(sealed),
+		associatedData,
+	)
+}
+
+func deriveKeyEncryptionKey(passphrase string, salt []byte, params argon2Params) []byte {
+	return argon2.IDKey(
+		[]byte(passphrase),
+		salt,
+		params.time,
+		params.memory,
+		params.threads,
+		dataKeySize,
+	)
+}
+
+// EnvironmentWrapEnabled reports if the data key should also be sealed with AES_GCM_SECRET
+func EnvironmentWrapEnabled() bool {
+	return environmentWrapEnabled
+}
+
+// WrapKeyWithEnvironment seals the data key with AES_GCM_SECRET
+func WrapKeyWithEnvironment(dataKey []byte) (string, error) {
+	return aesGCMEncrypt(aesGCMSecret, dataKey, nil)
+}
+
+// UnwrapKeyWithEnvironment opens a data key sealed with AES_GCM_SECRET or a retired secret.
+// current is false when a retired secret was needed, so the key should be wrapped again.
+func UnwrapKeyWithEnvironment(wrappedKey string) (dataKey []byte, current bool, err error) {
+	for index, secret := range environmentSecrets() {
+		dataKey, err = aesGCMDecrypt(secret, wrappedKey, nil)
+		if err == nil {
+			return dataKey, index == 0, nil
+		}
+	}
+	return nil, false, err
+}
+
+// SealKeyset encrypts the data keys with the root key of the keyset
+func SealKeyset(keyset *keyring.Keyset) (string, error) {
+	serialized, err := json.Marshal(keyset)
+	if err != nil {
+		return "", err
+	}
+	defer clear(serialized)
+
+	return aesGCMEncrypt(keyset.Root, serialized, nil)
+}
+
+// OpenKeyset decrypts the data keys sealed with the root key.
+// Vaults without a sealed keyset used the root key as their only data key.
+func OpenKeyset(root []byte, sealedKeyset string) (*keyring.Keyset, error) {
+	if sealedKeyset == "" {
+		return keyring.LegacyKeyset(root), nil
+	}
+
+	serialized, err := aesGCMDecrypt(root, sealedKeyset, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(serialized)
+
+	keyset := &keyring.Keyset{}
+	if err := json.Unmarshal(serialized, keyset); err != nil {
+		return nil, err
+	}
+	keyset.Root = append([]byte{}, root...)
+
+	return keyset, nil
+}
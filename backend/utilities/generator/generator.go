@@ -1,5 +1,7 @@
 package generator
 
+import "strings"
+
 /**
  * Manipulate maps each character to similar-looking characters.
  * This means passphrase should be as powerful as possible while
@@ -49,8 +51,29 @@ var ManipulateMap = map[string][]string{
 
 const (
 	Specials = "!@#$%^&*()_+-=[]{}|;:,.<>?/"
-	Lowers   = "abcdefghijklmnopqrstuvyz"
-	Uppers   = "ABCDEFGHIJKLMNOPQRSTUVYZ"
+	Lowers   = "abcdefghijklmnopqrstuvwxyz"
+	Uppers   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	Numbers  = "0123456789"
 	Chars    = Lowers + Uppers + Numbers + Specials
 )
+
+// Replaces every character with a random similar-looking one
+func Alternate(passphrase string) (string, error) {
+	var output strings.Builder
+
+	for _, character := range passphrase {
+		lowerChar := strings.ToLower(string(character))
+
+		if alternatives, exists := ManipulateMap[lowerChar]; exists {
+			index, err := randomIndex(len(alternatives))
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(alternatives[index])
+		} else {
+			output.WriteString(lowerChar)
+		}
+	}
+
+	return output.String(), nil
+}
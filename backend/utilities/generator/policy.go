@@ -0,0 +1,342 @@
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+/**
+ * Character passphrases following the rules of a site.
+ * The passphrase is drawn uniformly among all strings of the allowed
+ * characters that have the minimum count of every set: the number of
+ * characters of each set is drawn first, weighted by how many strings have
+ * it, then the positions and characters. The entropy is log2 of the number
+ * of such strings, so minimums cost a little entropy instead of hiding it.
+ */
+
+const (
+	SetLowers  = "lowers"
+	SetUppers  = "uppers"
+	SetNumbers = "numbers"
+	SetSymbols = "symbols"
+
+	// Characters easily mistaken for one another
+	Ambiguous = "0O1lI|"
+)
+
+// Sets in the order they are drawn
+var CharacterSets = []string{SetLowers, SetUppers, SetNumbers, SetSymbols}
+
+// Placeholders of a pattern, any other character is kept as it is
+var patternPlaceholders = map[rune]string{
+	'a': SetLowers,
+	'A': SetUppers,
+	'9': SetNumbers,
+	'#': SetSymbols,
+}
+
+// Stands for any allowed character in a pattern
+const patternAny = '?'
+
+// Terms this many bits below the largest are left out of sums
+const negligibleLog2 = 64
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+type Policy struct {
+	// Length of the passphrase, including the prefix
+	Length int
+	// Allowed sets, every set when empty
+	Sets     []string
+	Minimums map[string]int
+	// Leaves out 0, O, 1, l, I and |
+	ExcludeAmbiguous bool
+	// Replaces the default symbols when set
+	Symbols string
+	// Left out of every set
+	Forbidden string
+	// Kept at the start of the passphrase as it is
+	Prefix string
+	// Generates the rest from placeholders instead of the length and minimums:
+	// a, A, 9 and # for a character of a set, ? for any allowed character.
+	// A backslash keeps the next character as it is.
+	Pattern string
+}
+
+// Returns the passphrase and its entropy in bits, the prefix and literals add none
+func (policy *Policy) Generate() (string, float64, error) {
+	alphabets, allowed, err := policy.alphabets()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var body []rune
+	var entropy float64
+	if policy.Pattern != "" {
+		body, entropy, err = generatePattern(policy.Pattern, alphabets, allowed)
+	} else {
+		length := policy.Length - len([]rune(policy.Prefix))
+		body, entropy, err = generateWithMinimums(length, alphabets, allowed, policy.Minimums)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return policy.Prefix + string(body), entropy, nil
+}
+
+// Returns the sets the passphrase is drawn from
+func (policy *Policy) AllowedSets() ([]string, error) {
+	_, allowed, err := policy.alphabets()
+	return allowed, err
+}
+
+// Returns the characters of every set and the sets drawn from. When every set
+// is allowed, those the exclusions leave empty are left out; a set named in
+// the policy must keep at least one character.
+func (policy *Policy) alphabets() (map[string][]rune, []string, error) {
+	symbols := Specials
+	if policy.Symbols != "" {
+		for _, character := range policy.Symbols {
+			if unicode.IsLetter(character) || unicode.IsDigit(character) || !unicode.IsGraphic(character) || unicode.IsSpace(character) {
+				return nil, nil, fmt.Errorf("%w: symbols can't contain letters, digits or spaces", ErrInvalidPolicy)
+			}
+		}
+		symbols = policy.Symbols
+	}
+
+	sources := map[string]string{
+		SetLowers:  Lowers,
+		SetUppers:  Uppers,
+		SetNumbers: Numbers,
+		SetSymbols: symbols,
+	}
+
+	alphabets := map[string][]rune{}
+	for name, source := range sources {
+		seen := map[rune]bool{}
+		for _, character := range source {
+			if seen[character] || strings.ContainsRune(policy.Forbidden, character) ||
+				(policy.ExcludeAmbiguous && strings.ContainsRune(Ambiguous, character)) {
+				continue
+			}
+			seen[character] = true
+			alphabets[name] = append(alphabets[name], character)
+		}
+	}
+
+	for _, name := range policy.Sets {
+		if _, found := alphabets[name]; !found && sources[name] == "" {
+			return nil, nil, fmt.Errorf("%w: unknown set %s", ErrInvalidPolicy, name)
+		}
+		if len(alphabets[name]) == 0 {
+			return nil, nil, fmt.Errorf("%w: no %s are left to choose from", ErrInvalidPolicy, name)
+		}
+	}
+
+	allowed := policy.Sets
+	if len(allowed) == 0 {
+		for _, name := range CharacterSets {
+			if len(alphabets[name]) > 0 {
+				allowed = append(allowed, name)
+			}
+		}
+		if len(allowed) == 0 {
+			return nil, nil, fmt.Errorf("%w: no characters are left to choose from", ErrInvalidPolicy)
+		}
+	}
+
+	return alphabets, allowed, nil
+}
+
+func generatePattern(pattern string, alphabets map[string][]rune, allowed []string) ([]rune, float64, error) {
+	anyCharacter := []rune{}
+	for _, name := range allowed {
+		anyCharacter = append(anyCharacter, alphabets[name]...)
+	}
+
+	body := []rune{}
+	entropy := 0.0
+	escaped := false
+	for _, placeholder := range pattern {
+		if escaped || placeholder == '\\' {
+			if escaped {
+				body = append(body, placeholder)
+			}
+			escaped = !escaped
+			continue
+		}
+
+		var alphabet []rune
+		if placeholder == patternAny {
+			alphabet = anyCharacter
+		} else if name, found := patternPlaceholders[placeholder]; found {
+			alphabet = alphabets[name]
+		} else {
+			body = append(body, placeholder)
+			continue
+		}
+
+		if len(alphabet) == 0 {
+			return nil, 0, fmt.Errorf("%w: no characters are left for %c", ErrInvalidPolicy, placeholder)
+		}
+
+		index, err := randomIndex(len(alphabet))
+		if err != nil {
+			return nil, 0, err
+		}
+		body = append(body, alphabet[index])
+		entropy += math.Log2(float64(len(alphabet)))
+	}
+
+	return body, entropy, nil
+}
+
+func generateWithMinimums(
+	length int,
+	alphabets map[string][]rune,
+	allowed []string,
+	minimums map[string]int,
+) ([]rune, float64, error) {
+	required := 0
+	for name, minimum := range minimums {
+		if minimum < 0 {
+			return nil, 0, fmt.Errorf("%w: minimums can't be negative", ErrInvalidPolicy)
+		}
+		if minimum > 0 && len(alphabets[name]) == 0 {
+			return nil, 0, fmt.Errorf("%w: %s have a minimum but none are left to choose from", ErrInvalidPolicy, name)
+		}
+		if minimum > 0 && !slices.Contains(allowed, name) {
+			return nil, 0, fmt.Errorf("%w: %s have a minimum but are not allowed", ErrInvalidPolicy, name)
+		}
+		required += minimum
+	}
+	if length < required || length <= 0 {
+		return nil, 0, fmt.Errorf("%w: the length is too short for the prefix and minimums", ErrInvalidPolicy)
+	}
+
+	sizes := make([]float64, len(allowed))
+	lows := make([]int, len(allowed))
+	for index, name := range allowed {
+		sizes[index] = float64(len(alphabets[name]))
+		lows[index] = minimums[name]
+	}
+
+	// ways[i][t] is log2 of the strings of t characters from sets i and on
+	// that have their minimums, positions included
+	logFactorials := make([]float64, length+1)
+	for n := 1; n <= length; n++ {
+		logFactorials[n] = logFactorials[n-1] + math.Log2(float64(n))
+	}
+	logBinomial := func(n int, k int) float64 {
+		return logFactorials[n] - logFactorials[k] - logFactorials[n-k]
+	}
+
+	ways := make([][]float64, len(allowed)+1)
+	ways[len(allowed)] = make([]float64, length+1)
+	for t := 1; t <= length; t++ {
+		ways[len(allowed)][t] = math.Inf(-1)
+	}
+	for i := len(allowed) - 1; i >= 0; i-- {
+		ways[i] = make([]float64, length+1)
+		logSize := math.Log2(sizes[i])
+		terms := make([]float64, length+1)
+		for t := range ways[i] {
+			// Only the whole length is drawn from the first set
+			if i == 0 && t != length {
+				continue
+			}
+
+			// Summed relative to the largest term, smaller ones by far don't change the sum
+			largest := math.Inf(-1)
+			for k := lows[i]; k <= t; k++ {
+				terms[k] = logBinomial(t, k) + float64(k)*logSize + ways[i+1][t-k]
+				largest = math.Max(largest, terms[k])
+			}
+			if math.IsInf(largest, -1) {
+				ways[i][t] = largest
+				continue
+			}
+
+			sum := 0.0
+			for k := lows[i]; k <= t; k++ {
+				if terms[k] > largest-negligibleLog2 {
+					sum += math.Exp2(terms[k] - largest)
+				}
+			}
+			ways[i][t] = largest + math.Log2(sum)
+		}
+	}
+
+	// Characters of each set, drawn with the weight of the strings having them
+	labels := make([]int, 0, length)
+	remaining := length
+	for i := range allowed {
+		target, err := randomFloat()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Rounding can leave the target above the last weight, which then takes it
+		count := lows[i]
+		cumulative := 0.0
+		for k := lows[i]; k <= remaining; k++ {
+			weight := logBinomial(remaining, k) + float64(k)*math.Log2(sizes[i]) + ways[i+1][remaining-k] - ways[i][remaining]
+			if math.IsInf(weight, -1) {
+				continue
+			}
+
+			count = k
+			cumulative += math.Exp2(weight)
+			if target < cumulative {
+				break
+			}
+		}
+
+		for range count {
+			labels = append(labels, i)
+		}
+		remaining -= count
+	}
+
+	// Only rounding far beyond the float precision could get here
+	if len(labels) != length {
+		return nil, 0, fmt.Errorf("%w: the minimums can't be met", ErrInvalidPolicy)
+	}
+
+	// Every arrangement of the sets is as likely
+	for index := len(labels) - 1; index > 0; index-- {
+		swap, err := randomIndex(index + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		labels[index], labels[swap] = labels[swap], labels[index]
+	}
+
+	body := make([]rune, length)
+	for position, label := range labels {
+		alphabet := alphabets[allowed[label]]
+		index, err := randomIndex(len(alphabet))
+		if err != nil {
+			return nil, 0, err
+		}
+		body[position] = alphabet[index]
+	}
+
+	return body, ways[0][length], nil
+}
+
+// A uniformly random float in [0, 1)
+func randomFloat() (float64, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(1<<53))
+	if err != nil {
+		return 0, err
+	}
+	return float64(value.Int64()) / (1 << 53), nil
+}
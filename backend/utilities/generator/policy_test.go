@@ -0,0 +1,152 @@
+package generator
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func countIn(passphrase string, characters string) int {
+	count := 0
+	for _, character := range passphrase {
+		if strings.ContainsRune(characters, character) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestPolicyMeetsMinimums(t *testing.T) {
+	policy := &Policy{
+		Length:   12,
+		Sets:     []string{SetLowers, SetNumbers, SetSymbols},
+		Minimums: map[string]int{SetNumbers: 5, SetSymbols: 7},
+	}
+
+	for range 50 {
+		passphrase, entropy, err := policy.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(passphrase) != 12 {
+			t.Fatalf("got %d characters, want 12", len(passphrase))
+		}
+		if countIn(passphrase, Numbers) != 5 || countIn(passphrase, Specials) != 7 {
+			t.Fatalf("%q doesn't have the minimums", passphrase)
+		}
+		// Only the positions and the characters are left to chance
+		want := math.Log2(792) + 5*math.Log2(10) + 7*math.Log2(float64(len(Specials)))
+		if math.Abs(entropy-want) > 1e-6 {
+			t.Fatalf("entropy %f, want %f", entropy, want)
+		}
+	}
+}
+
+func TestPolicyKeepsPrefixAndPattern(t *testing.T) {
+	policy := &Policy{Length: 10, Prefix: "ab-", Minimums: map[string]int{}}
+	passphrase, _, err := policy.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(passphrase, "ab-") || len(passphrase) != 10 {
+		t.Errorf("got %q, want 10 characters starting with ab-", passphrase)
+	}
+
+	policy = &Policy{Pattern: `aA9#-\a?`}
+	passphrase, _, err = policy.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runes := []rune(passphrase)
+	if len(runes) != 7 || runes[4] != '-' || runes[5] != 'a' ||
+		!strings.ContainsRune(Lowers, runes[0]) || !strings.ContainsRune(Uppers, runes[1]) ||
+		!strings.ContainsRune(Numbers, runes[2]) || !strings.ContainsRune(Specials, runes[3]) {
+		t.Errorf("%q doesn't follow the pattern", passphrase)
+	}
+}
+
+func TestPolicyRejectsForbiddenSetsWithMinimums(t *testing.T) {
+	policies := map[string]*Policy{
+		"minimum of a forbidden set": {
+			Length:   16,
+			Sets:     []string{SetLowers, SetUppers},
+			Minimums: map[string]int{SetNumbers: 1},
+		},
+		"negative minimum": {
+			Length:   16,
+			Minimums: map[string]int{SetLowers: -1},
+		},
+		"minimums longer than the length": {
+			Length:   4,
+			Minimums: map[string]int{SetLowers: 3, SetNumbers: 3},
+		},
+		"prefix as long as the length": {
+			Length: 3,
+			Prefix: "abc",
+		},
+		"unknown set": {
+			Length: 16,
+			Sets:   []string{"emojis"},
+		},
+		"letters as symbols": {
+			Length:  16,
+			Symbols: "!a",
+		},
+	}
+
+	for name, policy := range policies {
+		if _, _, err := policy.Generate(); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidPolicy)
+		}
+	}
+}
+
+func TestPolicySkipsSetsLeftEmpty(t *testing.T) {
+	// Only ambiguous symbols, which are then excluded
+	policy := &Policy{Length: 64, Symbols: "|", ExcludeAmbiguous: true}
+
+	allowed, err := policy.AllowedSets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(allowed, ",") != "lowers,uppers,numbers" {
+		t.Errorf("allowed sets %v still have symbols", allowed)
+	}
+
+	passphrase, _, err := policy.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countIn(passphrase, Ambiguous) != 0 {
+		t.Errorf("%q has ambiguous characters", passphrase)
+	}
+}
+
+func TestPolicyRejectsNamedSetsLeftEmpty(t *testing.T) {
+	policies := map[string]*Policy{
+		"allowed set": {
+			Length:           16,
+			Sets:             []string{SetLowers, SetSymbols},
+			Symbols:          "|",
+			ExcludeAmbiguous: true,
+		},
+		"minimum": {
+			Length:           16,
+			Symbols:          "|",
+			ExcludeAmbiguous: true,
+			Minimums:         map[string]int{SetSymbols: 1},
+		},
+		"pattern": {
+			Pattern:          "aa##",
+			Symbols:          "|",
+			ExcludeAmbiguous: true,
+		},
+	}
+
+	for name, policy := range policies {
+		if _, _, err := policy.Generate(); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidPolicy)
+		}
+	}
+}
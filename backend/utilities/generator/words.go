@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/**
+ * Word based passphrases, as with diceware.
+ * Every word is drawn uniformly with crypto/rand, so the entropy is exact:
+ * each word adds log2 of the list size. The embedded list is the EFF large
+ * wordlist (CC BY 3.0), 7776 words that are easy to type and tell apart.
+ */
+//go:embed wordlists/eff_large.txt
+var effLargeWordlist string
+
+const (
+	WordlistEff = "eff"
+
+	// Smaller lists would make every word worth only a few bits
+	MinWordlistWords = 100
+)
+
+const (
+	CapitalizeNone   = "none"
+	CapitalizeFirst  = "first"
+	CapitalizeAll    = "all"
+	CapitalizeRandom = "random"
+)
+
+var ErrInvalidWordlist = errors.New("a wordlist needs at least 100 distinct words, one per line")
+
+type Wordlist struct {
+	words []string
+}
+
+type WordOptions struct {
+	Words      int
+	Separator  string
+	Capitalize string
+	// Random digits and symbols appended to random words
+	Digits  int
+	Symbols int
+}
+
+// Reads one word per line. Blank lines and lines starting with # are
+// skipped, and diceware lists with a roll before each word are accepted.
+func ParseWordlist(reader io.Reader) (*Wordlist, error) {
+	words := []string{}
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		word := strings.ToLower(fields[len(fields)-1])
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(words) < MinWordlistWords {
+		return nil, ErrInvalidWordlist
+	}
+
+	return &Wordlist{words: words}, nil
+}
+
+func EffWordlist() *Wordlist {
+	wordlist, err := ParseWordlist(strings.NewReader(effLargeWordlist))
+	if err != nil {
+		panic(err)
+	}
+	return wordlist
+}
+
+func (wordlist *Wordlist) Size() int {
+	return len(wordlist.words)
+}
+
+// Returns the passphrase and its entropy in bits
+func (wordlist *Wordlist) Generate(options WordOptions) (string, float64, error) {
+	words := make([]string, options.Words)
+	entropy := float64(options.Words) * math.Log2(float64(len(wordlist.words)))
+
+	for index := range words {
+		position, err := randomIndex(len(wordlist.words))
+		if err != nil {
+			return "", 0, err
+		}
+		word := wordlist.words[position]
+
+		switch options.Capitalize {
+		case CapitalizeFirst:
+			word = capitalizeFirst(word)
+		case CapitalizeAll:
+			word = strings.ToUpper(word)
+		case CapitalizeRandom:
+			// Half of the words, chosen at random, add a bit each
+			coin, err := randomIndex(2)
+			if err != nil {
+				return "", 0, err
+			}
+			if coin == 1 {
+				word = capitalizeFirst(word)
+			}
+			entropy++
+		}
+
+		words[index] = word
+	}
+
+	injections := []string{}
+	for range options.Digits {
+		injections = append(injections, Numbers)
+	}
+	for range options.Symbols {
+		injections = append(injections, Specials)
+	}
+
+	for _, set := range injections {
+		position, err := randomIndex(len(words))
+		if err != nil {
+			return "", 0, err
+		}
+
+		character, err := randomIndex(len(set))
+		if err != nil {
+			return "", 0, err
+		}
+
+		words[position] += string(set[character])
+		entropy += math.Log2(float64(len(set) * len(words)))
+	}
+
+	// The same characters injected in another order can give the same passphrase
+	for count := 2; count <= len(injections); count++ {
+		entropy -= math.Log2(float64(count))
+	}
+
+	return strings.Join(words, options.Separator), entropy, nil
+}
+
+func capitalizeFirst(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(first)) + word[size:]
+}
+
+// A uniformly random index below n
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(index.Int64()), nil
+}
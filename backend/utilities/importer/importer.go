@@ -20,14 +20,16 @@ type Platform struct {
 type PlatformType string
 
 const (
-	PlatformFirefox  PlatformType = "Firefox"
-	PlatformChromium PlatformType = "Chromium"
+	PlatformFirefox   PlatformType = "Firefox"
+	PlatformChromium  PlatformType = "Chromium"
+	PlatformBitwarden PlatformType = "Bitwarden"
+	PlatformPassenger PlatformType = "Passenger"
 )
 
 var (
 	PassengerFieldNames = []string{"platform", "identifier", "passphrase", "note", "favorite"}
 
-	PlatformTypes = []PlatformType{PlatformFirefox, PlatformChromium}
+	PlatformTypes = []PlatformType{PlatformFirefox, PlatformChromium, PlatformBitwarden, PlatformPassenger}
 
 	platforms = map[PlatformType]Platform{
 		PlatformFirefox: {
@@ -57,6 +59,34 @@ var (
 			},
 			TransformFields: map[string]fieldTransformer{},
 		},
+		PlatformBitwarden: {
+			Fields:          []string{"folder", "favorite", "type", "name", "notes", "fields", "reprompt", "login_uri", "login_username", "login_password", "login_totp"},
+			DelimiterType:   "LF",
+			DelimiterQuotes: "\"",
+			MatchFields: map[string]string{
+				"platform":   "name",
+				"identifier": "login_username",
+				"passphrase": "login_password",
+				"url":        "login_uri",
+				"notes":      "notes",
+				"totp":       "login_totp",
+			},
+			TransformFields: map[string]fieldTransformer{},
+		},
+		PlatformPassenger: {
+			Fields:          []string{"platform", "identifier", "passphrase", "url", "notes", "totp"},
+			DelimiterType:   "LF",
+			DelimiterQuotes: "\"",
+			MatchFields: map[string]string{
+				"platform":   "platform",
+				"identifier": "identifier",
+				"passphrase": "passphrase",
+				"url":        "url",
+				"notes":      "notes",
+				"totp":       "totp",
+			},
+			TransformFields: map[string]fieldTransformer{},
+		},
 	}
 )
 
@@ -138,6 +168,7 @@ func (p Platform) Parse(
 	passwordIndex := findFieldIndex(p.Fields, p.MatchFields["passphrase"])
 	urlIndex := findFieldIndex(p.Fields, p.MatchFields["url"])
 	notesIndex := findFieldIndex(p.Fields, p.MatchFields["notes"])
+	totpIndex := findFieldIndex(p.Fields, p.MatchFields["totp"])
 
 	if platformIndex == -1 || usernameIndex == -1 || passwordIndex == -1 || urlIndex == -1 {
 		return nil, schemas.NewAPIError(
@@ -176,6 +207,11 @@ func (p Platform) Parse(
 			account.Notes = calculateFields(p.TransformFields["notes"], record[notesIndex])
 		}
 
+		// Handle optional TOTP secret or otpauth URI
+		if totpIndex != -1 {
+			account.Totp = calculateFields(p.TransformFields["totp"], record[totpIndex])
+		}
+
 		results = append(results, account)
 	}
 
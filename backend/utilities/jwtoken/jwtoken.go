@@ -1,42 +1,68 @@
 package jwtoken
 
 import (
-	"log"
-	"os"
+	"errors"
+	"passenger-go/backend/utilities/config"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/joho/godotenv"
 )
 
 var (
 	jwtSecret []byte
 )
 
-func init() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+// The longest a session can last, idle sessions are ended earlier by the server
+const TokenLifetime = time.Hour * 24
 
-	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+var ErrInvalidToken = errors.New("invalid token")
 
-	if jwtSecret == nil {
-		log.Fatal("JWT_SECRET is not set")
-	}
+// The secret is generated on the first run when none is configured
+func Configure(config *config.Config) {
+	jwtSecret = []byte(config.JWTSecret)
 }
 
 func GetJWTSecret() []byte {
 	return jwtSecret
 }
 
-func GenerateJWT(userId int) (string, error) {
+func GenerateJWT(userId int, sessionId string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"iss": "passenger-go",
 		"sub": userId,
+		"sid": sessionId,
 		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(time.Minute * 5).Unix(), // 5 minutes expiration
+		"exp": time.Now().Add(TokenLifetime).Unix(),
 	})
 
 	return token.SignedString(jwtSecret)
 }
+
+// ParseJWT validates the token and returns the session id it belongs to
+func ParseJWT(tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !token.Valid {
+		return "", ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	sessionId, ok := claims["sid"].(string)
+	if !ok || sessionId == "" {
+		return "", ErrInvalidToken
+	}
+
+	return sessionId, nil
+}
@@ -0,0 +1,175 @@
+/**
+ * The keyring holds the unwrapped keyset in memory.
+ * The keyset is only available while at least one login session is alive,
+ * unless it was pinned by unwrapping it with the environment secret.
+ * When the last session closes, the keys are wiped from memory.
+ */
+
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"passenger-go/backend/schemas"
+	"sync"
+	"time"
+)
+
+var (
+	mutex    sync.RWMutex
+	current  *Keyset
+	pinned   bool
+	sessions = map[string]time.Time{}
+)
+
+// OpenSession stores the keyset and returns a new session id
+func OpenSession(keyset *Keyset, lifetime time.Duration) (string, error) {
+	identifier := make([]byte, 16)
+	if _, err := rand.Read(identifier); err != nil {
+		return "", err
+	}
+	sessionId := hex.EncodeToString(identifier)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	setKeyset(keyset)
+	sessions[sessionId] = time.Now().Add(lifetime)
+
+	return sessionId, nil
+}
+
+// UnlockSession stores the keyset for a session whose id the caller chose
+func UnlockSession(sessionId string, keyset *Keyset, until time.Time) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	setKeyset(keyset)
+	sessions[sessionId] = until
+}
+
+// CloseSession forgets the session and locks the vault if it was the last one
+func CloseSession(sessionId string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(sessions, sessionId)
+	pruneSessions()
+}
+
+// CloseOtherSessions forgets every session but the given one, an empty id closes them all
+func CloseOtherSessions(sessionId string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for other := range sessions {
+		if other != sessionId {
+			delete(sessions, other)
+		}
+	}
+	pruneSessions()
+}
+
+// TouchSession keeps the session alive until the given time.
+// A session that is unknown, for example after a restart, is resumed
+// if the vault is still unlocked; it fails if the vault is locked.
+func TouchSession(sessionId string, until time.Time) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	pruneSessions()
+	if current == nil {
+		return false
+	}
+
+	sessions[sessionId] = until
+	return true
+}
+
+// Pin keeps the keyset unlocked regardless of the sessions
+func Pin(keyset *Keyset) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	setKeyset(keyset)
+	pinned = true
+}
+
+// Replace swaps the keyset after a rotation, only if the vault is still unlocked
+func Replace(keyset *Keyset) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if current != nil {
+		setKeyset(keyset)
+	}
+}
+
+// Current returns a copy of the unlocked keyset or a vault locked error.
+// The caller must wipe the copy, With avoids making one.
+func Current() (*Keyset, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	pruneSessions()
+	if current == nil {
+		return nil, errVaultLocked()
+	}
+
+	return current.Clone(), nil
+}
+
+// With runs the function with the unlocked keyset, without copying it. The
+// keyset must not be kept or changed, and the function must not call the keyring.
+func With(use func(keyset *Keyset) error) error {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	// Expired sessions are pruned by the next writer, they only count as gone here
+	if current == nil || (!pinned && !sessionsAlive(time.Now())) {
+		return errVaultLocked()
+	}
+
+	return use(current)
+}
+
+func errVaultLocked() error {
+	return schemas.NewAPIError(
+		schemas.ErrVaultLocked,
+		"The vault is locked, please login again",
+		nil,
+	)
+}
+
+// Must be called with the mutex locked, for reading at least
+func sessionsAlive(now time.Time) bool {
+	for _, expiresAt := range sessions {
+		if !now.After(expiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Must be called with the mutex locked
+func setKeyset(keyset *Keyset) {
+	if current != nil {
+		current.Wipe()
+	}
+	current = keyset.Clone()
+}
+
+// Must be called with the mutex locked
+func pruneSessions() {
+	now := time.Now()
+	for sessionId, expiresAt := range sessions {
+		if now.After(expiresAt) {
+			delete(sessions, sessionId)
+		}
+	}
+
+	if len(sessions) == 0 && !pinned && current != nil {
+		current.Wipe()
+		current = nil
+	}
+}
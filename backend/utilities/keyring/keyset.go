@@ -0,0 +1,109 @@
+package keyring
+
+import (
+	"errors"
+	"time"
+)
+
+// Ciphertexts without a key id header were written with the first key
+const LegacyKeyId = 1
+
+var ErrUnknownKey = errors.New("unknown data key")
+
+type DataKey struct {
+	Id        int       `json:"id"`
+	Material  []byte    `json:"material"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+/**
+ * A keyset has one active key for encryption and any number of
+ * retired keys kept for decryption. The root key is the one wrapped
+ * by the passphrase, recovery key and environment secret; it seals
+ * the keyset and, except in older vaults, never encrypts account data.
+ */
+type Keyset struct {
+	Root   []byte     `json:"-"`
+	Active int        `json:"active"`
+	Keys   []*DataKey `json:"keys"`
+}
+
+func NewKeyset(root []byte, material []byte) *Keyset {
+	return &Keyset{
+		Root:   append([]byte{}, root...),
+		Active: LegacyKeyId,
+		Keys: []*DataKey{{
+			Id:        LegacyKeyId,
+			Material:  append([]byte{}, material...),
+			CreatedAt: time.Now(),
+		}},
+	}
+}
+
+// LegacyKeyset treats the root key as the only data key, as older vaults did
+func LegacyKeyset(root []byte) *Keyset {
+	return &Keyset{
+		Root:   append([]byte{}, root...),
+		Active: LegacyKeyId,
+		Keys: []*DataKey{{
+			Id:       LegacyKeyId,
+			Material: append([]byte{}, root...),
+		}},
+	}
+}
+
+func (keyset *Keyset) ActiveKey() (*DataKey, error) {
+	return keyset.Key(keyset.Active)
+}
+
+func (keyset *Keyset) Key(id int) (*DataKey, error) {
+	for _, key := range keyset.Keys {
+		if key.Id == id {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate adds a new active key, the previous ones are kept as retired
+func (keyset *Keyset) Rotate(material []byte) *Keyset {
+	rotated := keyset.Clone()
+
+	nextId := 0
+	for _, key := range rotated.Keys {
+		nextId = max(nextId, key.Id)
+	}
+	nextId++
+
+	rotated.Keys = append(rotated.Keys, &DataKey{
+		Id:        nextId,
+		Material:  append([]byte{}, material...),
+		CreatedAt: time.Now(),
+	})
+	rotated.Active = nextId
+
+	return rotated
+}
+
+func (keyset *Keyset) Clone() *Keyset {
+	clone := &Keyset{
+		Root:   append([]byte{}, keyset.Root...),
+		Active: keyset.Active,
+		Keys:   make([]*DataKey, len(keyset.Keys)),
+	}
+	for index, key := range keyset.Keys {
+		clone.Keys[index] = &DataKey{
+			Id:        key.Id,
+			Material:  append([]byte{}, key.Material...),
+			CreatedAt: key.CreatedAt,
+		}
+	}
+	return clone
+}
+
+func (keyset *Keyset) Wipe() {
+	clear(keyset.Root)
+	for _, key := range keyset.Keys {
+		clear(key.Material)
+	}
+}
@@ -0,0 +1,284 @@
+/**
+ * One-time passwords as described in RFC 4226 (HOTP) and RFC 6238 (TOTP).
+ * Secrets are exchanged as base32 strings, usually inside otpauth:// URIs.
+ */
+
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+
+	AlgorithmSHA1   = "SHA1"
+	AlgorithmSHA256 = "SHA256"
+	AlgorithmSHA512 = "SHA512"
+
+	DefaultDigits = 6
+	DefaultPeriod = 30
+
+	minDigits = 4
+	maxDigits = 10
+
+	secretSize = 20
+)
+
+var (
+	ErrInvalidSecret    = errors.New("invalid otp secret")
+	ErrInvalidAlgorithm = errors.New("unsupported otp algorithm")
+	ErrInvalidURI       = errors.New("invalid otpauth uri")
+)
+
+// Base32 without padding, as authenticator apps expect it
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type Key struct {
+	Type      string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+	Issuer    string
+	Account   string
+}
+
+// NewKey creates a TOTP key with a random secret and the default parameters
+func NewKey(issuer string, account string) (*Key, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:      TypeTOTP,
+		Secret:    secret,
+		Algorithm: AlgorithmSHA1,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+		Issuer:    issuer,
+		Account:   account,
+	}, nil
+}
+
+// NewKeyFromSecret creates a TOTP key with the default parameters from a base32 secret
+func NewKeyFromSecret(secret string) (*Key, error) {
+	decoded, err := DecodeSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:      TypeTOTP,
+		Secret:    decoded,
+		Algorithm: AlgorithmSHA1,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}, nil
+}
+
+// Parse accepts an otpauth:// URI or a bare base32 TOTP secret
+func Parse(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(value), "otpauth://") {
+		return ParseURI(value)
+	}
+	return NewKeyFromSecret(value)
+}
+
+// ParseURI reads an otpauth:// URI, missing parameters take their defaults
+func ParseURI(uri string) (*Key, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(parsed.Scheme, "otpauth") {
+		return nil, ErrInvalidURI
+	}
+
+	key := &Key{
+		Type:      strings.ToLower(parsed.Host),
+		Algorithm: AlgorithmSHA1,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if key.Type != TypeTOTP && key.Type != TypeHOTP {
+		return nil, ErrInvalidURI
+	}
+
+	label := strings.TrimPrefix(parsed.Path, "/")
+	if issuer, account, found := strings.Cut(label, ":"); found {
+		key.Issuer = strings.TrimSpace(issuer)
+		key.Account = strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+
+	query := parsed.Query()
+
+	key.Secret, err = DecodeSecret(query.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The issuer parameter wins over the label prefix
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		key.Algorithm = strings.ToUpper(algorithm)
+		if _, err := hashFunction(key.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	if digits := query.Get("digits"); digits != "" {
+		key.Digits, err = strconv.Atoi(digits)
+		if err != nil || key.Digits < minDigits || key.Digits > maxDigits {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	if period := query.Get("period"); period != "" {
+		key.Period, err = strconv.Atoi(period)
+		if err != nil || key.Period <= 0 {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	if key.Type == TypeHOTP {
+		key.Counter, err = strconv.ParseUint(query.Get("counter"), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	return key, nil
+}
+
+// DecodeSecret accepts base32 secrets in any case, with or without spaces and padding
+func DecodeSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+
+	decoded, err := encoding.DecodeString(normalized)
+	if err != nil || len(decoded) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return decoded, nil
+}
+
+func (key *Key) EncodedSecret() string {
+	return encoding.EncodeToString(key.Secret)
+}
+
+// URI returns the otpauth:// URI that authenticator apps scan
+func (key *Key) URI() string {
+	label := url.PathEscape(key.Account)
+	if key.Issuer != "" {
+		label = url.PathEscape(key.Issuer) + ":" + label
+	}
+
+	query := url.Values{}
+	query.Set("secret", key.EncodedSecret())
+	if key.Issuer != "" {
+		query.Set("issuer", key.Issuer)
+	}
+	query.Set("algorithm", key.Algorithm)
+	query.Set("digits", fmt.Sprint(key.Digits))
+	if key.Type == TypeHOTP {
+		query.Set("counter", fmt.Sprint(key.Counter))
+	} else {
+		query.Set("period", fmt.Sprint(key.Period))
+	}
+
+	return fmt.Sprintf("otpauth://%s/%s?%s", key.Type, label, query.Encode())
+}
+
+// Step returns the TOTP time step at the given time
+func (key *Key) Step(at time.Time) int64 {
+	return at.Unix() / int64(key.Period)
+}
+
+// Remaining returns the seconds until the TOTP code changes
+func (key *Key) Remaining(at time.Time) int {
+	return key.Period - int(at.Unix()%int64(key.Period))
+}
+
+// Code returns the TOTP code at the given time
+func (key *Key) Code(at time.Time) (string, error) {
+	return key.CodeAt(uint64(key.Step(at)))
+}
+
+// CodeAt returns the code for the given counter or time step
+func (key *Key) CodeAt(counter uint64) (string, error) {
+	newHash, err := hashFunction(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(newHash, key.Secret)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	modulo := uint64(1)
+	for range key.Digits {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", key.Digits, value%modulo), nil
+}
+
+// Validate checks a TOTP code against the steps around the given time.
+// It returns the matching step, so callers can refuse to accept it twice.
+func (key *Key) Validate(code string, at time.Time, skew int) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	current := key.Step(at)
+
+	for offset := -int64(skew); offset <= int64(skew); offset++ {
+		step := current + offset
+		expected, err := key.CodeAt(uint64(step))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func hashFunction(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case AlgorithmSHA1, "":
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	}
+	return nil, ErrInvalidAlgorithm
+}
@@ -18,10 +18,12 @@ import (
 
 type Router struct {
 	mux *chi.Mux
+	// Where routes are added, the mux itself or a group with extra middlewares
+	routes chi.Router
 }
 
 func NewRouter(mux *chi.Mux) *Router {
-	return &Router{mux: mux}
+	return &Router{mux: mux, routes: mux}
 }
 
 // Mux returns the underlying chi.Mux instance
@@ -42,7 +44,12 @@ func (r *Router) Handle(method string, pattern string, handler HandlerWithError)
 		}
 	}
 
-	r.mux.Method(method, pattern, http.HandlerFunc(wrappedHandler))
+	r.routes.Method(method, pattern, http.HandlerFunc(wrappedHandler))
+}
+
+// With returns a router whose routes also go through the given middlewares
+func (r *Router) With(middlewares ...func(http.Handler) http.Handler) *Router {
+	return &Router{mux: r.mux, routes: r.routes.With(middlewares...)}
 }
 
 // Convenience methods for common HTTP methods
@@ -0,0 +1,82 @@
+package strength
+
+import (
+	"bufio"
+	"embed"
+	"strings"
+	"sync"
+)
+
+/**
+ * Ranked dictionaries, the most common entry of each has rank 1.
+ * The lists come from the frequency lists of zxcvbn (MIT license):
+ * leaked passwords, English words from subtitles and Wikipedia, and
+ * the most common first names and surnames.
+ */
+//go:embed wordlists/*.txt
+var wordlists embed.FS
+
+const (
+	DictionaryPasswords  = "passwords"
+	DictionaryEnglish    = "english"
+	DictionaryNames      = "names"
+	DictionaryUserInputs = "user_inputs"
+)
+
+type rankedDictionary map[string]int
+
+var (
+	dictionaries     map[string]rankedDictionary
+	dictionariesOnce sync.Once
+)
+
+// The embedded dictionaries are only read when the first passphrase is estimated
+func embeddedDictionaries() map[string]rankedDictionary {
+	dictionariesOnce.Do(func() {
+		dictionaries = map[string]rankedDictionary{}
+		for _, name := range []string{DictionaryPasswords, DictionaryEnglish, DictionaryNames} {
+			file, err := wordlists.Open("wordlists/" + name + ".txt")
+			if err != nil {
+				panic(err)
+			}
+
+			dictionary := rankedDictionary{}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				word := strings.TrimSpace(scanner.Text())
+				if _, found := dictionary[word]; word != "" && !found {
+					dictionary[word] = len(dictionary) + 1
+				}
+			}
+			file.Close()
+
+			dictionaries[name] = dictionary
+		}
+	})
+
+	return dictionaries
+}
+
+// Words the passphrase should not be built from, such as the platform it is for
+func userInputsDictionary(userInputs []string) rankedDictionary {
+	dictionary := rankedDictionary{}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		words := append([]string{input}, strings.FieldsFunc(input, isInputSeparator)...)
+		for _, word := range words {
+			if word == "" {
+				continue
+			}
+			if _, found := dictionary[word]; !found {
+				dictionary[word] = len(dictionary) + 1
+			}
+		}
+	}
+
+	return dictionary
+}
+
+// Identifiers such as user@example.com are split into their parts too
+func isInputSeparator(character rune) bool {
+	return strings.ContainsRune(" @.-_/:", character)
+}
@@ -0,0 +1,362 @@
+package strength
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"time"
+	"unicode"
+)
+
+/**
+ * Guesses an attacker needs for each pattern and for the whole passphrase.
+ * The passphrase is split into the sequence of matches and bruteforced
+ * gaps that is the easiest to guess, as zxcvbn does. Guesses are summed
+ * in log10 so long passphrases don't overflow.
+ */
+
+const (
+	bruteforceCardinality             = 10
+	minSubmatchGuessesSingleCharacter = 10
+	minSubmatchGuessesMultiCharacter  = 50
+	// Attackers try short sequences of patterns first
+	minGuessesBeforeGrowingSequence = 10000
+	minYearSpace                    = 20
+)
+
+func referenceYear() int {
+	return time.Now().Year()
+}
+
+func estimateGuesses(match *Match, passwordLength int) float64 {
+	if match.Guesses != 0 {
+		return match.Guesses
+	}
+
+	minGuesses := 1.0
+	length := len([]rune(match.Token))
+	if length < passwordLength {
+		minGuesses = minSubmatchGuessesMultiCharacter
+		if length == 1 {
+			minGuesses = minSubmatchGuessesSingleCharacter
+		}
+	}
+
+	guesses := 0.0
+	switch match.Pattern {
+	case PatternBruteforce:
+		guesses = bruteforceGuesses(match)
+	case PatternDictionary:
+		guesses = dictionaryGuesses(match)
+	case PatternSpatial:
+		guesses = spatialGuesses(match)
+	case PatternRepeat:
+		guesses = match.baseGuesses * float64(match.repeatCount)
+	case PatternSequence:
+		guesses = sequenceGuesses(match)
+	case PatternYear:
+		guesses = yearSpace(match.year)
+	case PatternDate:
+		guesses = dateGuesses(match)
+	}
+
+	match.Guesses = math.Max(math.Round(guesses), minGuesses)
+	return match.Guesses
+}
+
+func bruteforceGuesses(match *Match) float64 {
+	length := len([]rune(match.Token))
+	guesses := math.Min(math.Pow(bruteforceCardinality, float64(length)), math.MaxFloat64)
+
+	// A bruteforced gap is never cheaper than a match covering it
+	minGuesses := float64(minSubmatchGuessesMultiCharacter + 1)
+	if length == 1 {
+		minGuesses = minSubmatchGuessesSingleCharacter + 1
+	}
+	return math.Max(guesses, minGuesses)
+}
+
+var (
+	startUpper = regexp.MustCompile(`^[A-Z][^A-Z]+$`)
+	endUpper   = regexp.MustCompile(`^[^A-Z]+[A-Z]$`)
+	allUpper   = regexp.MustCompile(`^[^a-z]+$`)
+	allLower   = regexp.MustCompile(`^[^A-Z]+$`)
+)
+
+func dictionaryGuesses(match *Match) float64 {
+	guesses := float64(match.rank) * uppercaseVariations(match.Token) * l33tVariations(match)
+	if match.Reversed {
+		guesses *= 2
+	}
+	return guesses
+}
+
+func uppercaseVariations(token string) float64 {
+	if allLower.MatchString(token) {
+		return 1
+	}
+
+	// The most common capitalizations cost one bit each
+	for _, pattern := range []*regexp.Regexp{startUpper, endUpper, allUpper} {
+		if pattern.MatchString(token) {
+			return 2
+		}
+	}
+
+	uppers, lowers := 0, 0
+	for _, character := range token {
+		if unicode.IsUpper(character) {
+			uppers++
+		} else if unicode.IsLower(character) {
+			lowers++
+		}
+	}
+
+	return variations(uppers, lowers)
+}
+
+func l33tVariations(match *Match) float64 {
+	if !match.L33t {
+		return 1
+	}
+
+	result := 1.0
+	for substitute, letter := range match.substitutions {
+		substituted, unsubstituted := 0, 0
+		for _, character := range []rune(match.Token) {
+			if character == substitute {
+				substituted++
+			} else if unicode.ToLower(character) == letter {
+				unsubstituted++
+			}
+		}
+
+		// Everything substituted counts as one extra bit
+		if substituted == 0 || unsubstituted == 0 {
+			result *= 2
+		} else {
+			result *= variations(substituted, unsubstituted)
+		}
+	}
+
+	return result
+}
+
+// Ways to pick up to min(a, b) characters of a + b to differ from the rest
+func variations(a int, b int) float64 {
+	if a == 0 || b == 0 {
+		return 2
+	}
+
+	result := 0.0
+	for i := 1; i <= min(a, b); i++ {
+		result += binomial(a+b, i)
+	}
+	return result
+}
+
+func binomial(n int, k int) float64 {
+	if k > n {
+		return 0
+	}
+
+	result := 1.0
+	for d := 1; d <= k; d++ {
+		result *= float64(n)
+		result /= float64(d)
+		n--
+	}
+	return result
+}
+
+func spatialGuesses(match *Match) float64 {
+	graph := keyboardGraphs[match.Graph]
+	startingPositions := float64(graph.keys)
+	length := len([]rune(match.Token))
+
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		possibleTurns := min(match.turns, i-1)
+		for j := 1; j <= possibleTurns; j++ {
+			guesses += binomial(i-1, j-1) * startingPositions * math.Pow(graph.averageDegree, float64(j))
+		}
+	}
+
+	if match.shiftedCount > 0 {
+		shifted := match.shiftedCount
+		unshifted := length - shifted
+		guesses *= variations(shifted, unshifted)
+	}
+
+	return guesses
+}
+
+func sequenceGuesses(match *Match) float64 {
+	base := float64(match.sequenceSpace)
+	switch []rune(match.Token)[0] {
+	case 'a', 'A', 'z', 'Z', '0', '1', '9':
+		// Obvious starting points
+		base = 4
+	}
+
+	if !match.ascending {
+		base *= 2
+	}
+
+	return base * float64(len([]rune(match.Token)))
+}
+
+func yearSpace(year int) float64 {
+	return float64(max(absolute(year-referenceYear()), minYearSpace))
+}
+
+func dateGuesses(match *Match) float64 {
+	guesses := yearSpace(match.year) * 365
+	if match.separator {
+		guesses *= 4
+	}
+	return guesses
+}
+
+// Best match ending at a position for a sequence length, in log10
+type candidate struct {
+	match           *Match
+	productLog10    float64
+	totalGuessLog10 float64
+}
+
+// Sequence lengths in order, so ties are always broken the same way
+func sortedLengths(candidates map[int]candidate) []int {
+	lengths := make([]int, 0, len(candidates))
+	for sequenceLength := range candidates {
+		lengths = append(lengths, sequenceLength)
+	}
+	sort.Ints(lengths)
+	return lengths
+}
+
+type matchSequence struct {
+	Guesses      float64
+	GuessesLog10 float64
+	Sequence     []*Match
+}
+
+// The sequence of non-overlapping matches covering the passphrase that is
+// the easiest to guess. Gaps between matches are bruteforced.
+func mostGuessableSequence(password []rune, matches []*Match, excludeAdditive bool) *matchSequence {
+	length := len(password)
+	if length == 0 {
+		return &matchSequence{Guesses: 1, Sequence: []*Match{}}
+	}
+
+	matchesByEnd := make([][]*Match, length)
+	for _, match := range matches {
+		matchesByEnd[match.j] = append(matchesByEnd[match.j], match)
+	}
+
+	optimal := make([]map[int]candidate, length)
+	for k := range optimal {
+		optimal[k] = map[int]candidate{}
+	}
+
+	update := func(match *Match, sequenceLength int) {
+		k := match.j
+		productLog10 := math.Log10(estimateGuesses(match, length))
+		if sequenceLength > 1 {
+			productLog10 += optimal[match.i-1][sequenceLength-1].productLog10
+		}
+
+		totalLog10 := factorialLog10(sequenceLength) + productLog10
+		if !excludeAdditive {
+			totalLog10 = addLog10(
+				totalLog10,
+				float64(sequenceLength-1)*math.Log10(minGuessesBeforeGrowingSequence),
+			)
+		}
+
+		// Longer sequences must be strictly easier to guess than shorter ones
+		for competingLength, competing := range optimal[k] {
+			if competingLength <= sequenceLength && competing.totalGuessLog10 <= totalLog10 {
+				return
+			}
+		}
+
+		optimal[k][sequenceLength] = candidate{
+			match:           match,
+			productLog10:    productLog10,
+			totalGuessLog10: totalLog10,
+		}
+	}
+
+	bruteforceUpdate := func(k int) {
+		update(bruteforceMatch(password, 0, k), 1)
+		for i := 1; i <= k; i++ {
+			match := bruteforceMatch(password, i, k)
+			for _, sequenceLength := range sortedLengths(optimal[i-1]) {
+				// Adjacent bruteforce gaps are one gap
+				if optimal[i-1][sequenceLength].match.Pattern == PatternBruteforce {
+					continue
+				}
+				update(match, sequenceLength+1)
+			}
+		}
+	}
+
+	for k := range length {
+		for _, match := range matchesByEnd[k] {
+			if match.i > 0 {
+				for _, sequenceLength := range sortedLengths(optimal[match.i-1]) {
+					update(match, sequenceLength+1)
+				}
+			} else {
+				update(match, 1)
+			}
+		}
+		bruteforceUpdate(k)
+	}
+
+	// Walk back from the end through the best sequence
+	bestLength, bestLog10 := 0, math.Inf(1)
+	for sequenceLength, candidate := range optimal[length-1] {
+		if candidate.totalGuessLog10 < bestLog10 ||
+			(candidate.totalGuessLog10 == bestLog10 && sequenceLength < bestLength) {
+			bestLength, bestLog10 = sequenceLength, candidate.totalGuessLog10
+		}
+	}
+
+	sequence := []*Match{}
+	for k, sequenceLength := length-1, bestLength; k >= 0; sequenceLength-- {
+		match := optimal[k][sequenceLength].match
+		sequence = append([]*Match{match}, sequence...)
+		k = match.i - 1
+	}
+
+	return &matchSequence{
+		Guesses:      math.Min(math.Round(math.Pow(10, bestLog10)), math.MaxFloat64),
+		GuessesLog10: bestLog10,
+		Sequence:     sequence,
+	}
+}
+
+func bruteforceMatch(password []rune, i int, j int) *Match {
+	return &Match{
+		Pattern: PatternBruteforce,
+		Token:   string(password[i : j+1]),
+		i:       i,
+		j:       j,
+	}
+}
+
+func factorialLog10(n int) float64 {
+	result := 0.0
+	for i := 2; i <= n; i++ {
+		result += math.Log10(float64(i))
+	}
+	return result
+}
+
+// log10(10^a + 10^b) without leaving log space
+func addLog10(a float64, b float64) float64 {
+	high, low := math.Max(a, b), math.Min(a, b)
+	return high + math.Log10(1+math.Pow(10, low-high))
+}
@@ -0,0 +1,113 @@
+package strength
+
+import "strings"
+
+/**
+ * Keyboard adjacency graphs for keyboard walks such as "qwerty" or "zaq1".
+ * Every key lists its neighbours in a fixed order of directions, so a
+ * change of direction is a turn. Keys of the slanted layouts hold the
+ * unshifted and shifted character.
+ */
+
+const (
+	GraphQwerty = "qwerty"
+	GraphDvorak = "dvorak"
+	GraphKeypad = "keypad"
+)
+
+const qwertyLayout = `
+` + "`~" + ` 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+
+    qQ wW eE rR tT yY uU iI oO pP [{ ]} \|
+     aA sS dD fF gG hH jJ kK lL ;: '"
+      zZ xX cC vV bB nN mM ,< .> /?
+`
+
+const dvorakLayout = `
+` + "`~" + ` 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) [{ ]}
+    '" ,< .> pP yY fF gG cC rR lL /? =+ \|
+     aA oO eE uU iI dD hH tT nN sS -_
+      ;: qQ jJ kK xX bB mM wW vV zZ
+`
+
+const keypadLayout = `
+  / * -
+7 8 9 +
+4 5 6
+1 2 3
+  0 .
+`
+
+type adjacencyGraph struct {
+	// Neighbour keys of every character, empty where there is no key
+	neighbours map[rune][]string
+	// Number of keys and average number of neighbours, for the guesses
+	keys          int
+	averageDegree float64
+}
+
+var keyboardGraphs = map[string]*adjacencyGraph{
+	GraphQwerty: buildGraph(qwertyLayout, true),
+	GraphDvorak: buildGraph(dvorakLayout, true),
+	GraphKeypad: buildGraph(keypadLayout, false),
+}
+
+type position struct{ x, y int }
+
+func buildGraph(layout string, slanted bool) *adjacencyGraph {
+	positions := map[position]string{}
+
+	for y, line := range strings.Split(layout, "\n") {
+		slant := 0
+		if slanted {
+			slant = y - 1
+		}
+
+		offset := 0
+		for _, token := range strings.Fields(line) {
+			index := strings.Index(line[offset:], token) + offset
+			offset = index + len(token)
+			positions[position{(index - slant) / (len(token) + 1), y}] = token
+		}
+	}
+
+	graph := &adjacencyGraph{neighbours: map[rune][]string{}}
+	for at, token := range positions {
+		neighbours := []string{}
+		for _, coordinate := range adjacentCoordinates(at, slanted) {
+			neighbours = append(neighbours, positions[coordinate])
+		}
+
+		for _, character := range token {
+			graph.neighbours[character] = neighbours
+		}
+	}
+
+	// Every character is a starting position, as zxcvbn counts them
+	degrees := 0
+	for _, neighbours := range graph.neighbours {
+		for _, neighbour := range neighbours {
+			if neighbour != "" {
+				degrees++
+			}
+		}
+	}
+	graph.keys = len(graph.neighbours)
+	graph.averageDegree = float64(degrees) / float64(graph.keys)
+
+	return graph
+}
+
+func adjacentCoordinates(at position, slanted bool) []position {
+	x, y := at.x, at.y
+	if slanted {
+		return []position{
+			{x - 1, y}, {x, y - 1}, {x + 1, y - 1},
+			{x + 1, y}, {x, y + 1}, {x - 1, y + 1},
+		}
+	}
+
+	return []position{
+		{x - 1, y}, {x - 1, y - 1}, {x, y - 1}, {x + 1, y - 1},
+		{x + 1, y}, {x + 1, y + 1}, {x, y + 1}, {x - 1, y + 1},
+	}
+}
@@ -0,0 +1,628 @@
+package strength
+
+import (
+	"passenger-go/backend/utilities/generator"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	PatternDictionary = "dictionary"
+	PatternSpatial    = "spatial"
+	PatternRepeat     = "repeat"
+	PatternSequence   = "sequence"
+	PatternYear       = "year"
+	PatternDate       = "date"
+	PatternBruteforce = "bruteforce"
+)
+
+// A part of the passphrase that follows a guessable pattern
+type Match struct {
+	Pattern string
+	Token   string
+	Guesses float64
+	// Dictionary matches
+	Dictionary string
+	Reversed   bool
+	L33t       bool
+	// Spatial matches
+	Graph string
+
+	// First and last rune of the token in the passphrase
+	i, j int
+
+	matchedWord   string
+	rank          int
+	substitutions map[rune]rune
+
+	turns        int
+	shiftedCount int
+
+	baseToken   string
+	baseGuesses float64
+	repeatCount int
+
+	sequenceSpace int
+	ascending     bool
+
+	year      int
+	separator bool
+}
+
+// Every match of every pattern, sorted by position
+func omnimatch(password []rune, dictionaries map[string]rankedDictionary) []*Match {
+	matches := []*Match{}
+	matches = append(matches, dictionaryMatch(password, dictionaries)...)
+	matches = append(matches, reverseDictionaryMatch(password, dictionaries)...)
+	matches = append(matches, l33tMatch(password, dictionaries)...)
+	matches = append(matches, spatialMatch(password)...)
+	matches = append(matches, repeatMatch(password, dictionaries)...)
+	matches = append(matches, sequenceMatch(password)...)
+	matches = append(matches, yearMatch(password)...)
+	matches = append(matches, dateMatch(password)...)
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].i != matches[b].i {
+			return matches[a].i < matches[b].i
+		}
+		return matches[a].j < matches[b].j
+	})
+
+	return matches
+}
+
+func dictionaryMatch(password []rune, dictionaries map[string]rankedDictionary) []*Match {
+	matches := []*Match{}
+	lower := []rune(strings.ToLower(string(password)))
+	if len(lower) != len(password) {
+		// Lowercasing changed the length, positions would not line up
+		lower = password
+	}
+
+	for _, name := range sortedKeys(dictionaries) {
+		dictionary := dictionaries[name]
+		for i := range lower {
+			for j := i; j < len(lower); j++ {
+				word := string(lower[i : j+1])
+				rank, found := dictionary[word]
+				if !found {
+					continue
+				}
+
+				matches = append(matches, &Match{
+					Pattern:     PatternDictionary,
+					Token:       string(password[i : j+1]),
+					Dictionary:  name,
+					i:           i,
+					j:           j,
+					matchedWord: word,
+					rank:        rank,
+				})
+			}
+		}
+	}
+
+	return matches
+}
+
+func reverseDictionaryMatch(password []rune, dictionaries map[string]rankedDictionary) []*Match {
+	reversed := reverseRunes(password)
+	matches := dictionaryMatch(reversed, dictionaries)
+	for _, match := range matches {
+		match.Token = string(reverseRunes([]rune(match.Token)))
+		match.Reversed = true
+		match.i, match.j = len(password)-1-match.j, len(password)-1-match.i
+	}
+
+	return matches
+}
+
+// Map keys in order, so matches come out in the same order every time
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func reverseRunes(runes []rune) []rune {
+	reversed := make([]rune, len(runes))
+	for index, character := range runes {
+		reversed[len(runes)-1-index] = character
+	}
+	return reversed
+}
+
+// Characters that stand in for letters, from the substitutions the
+// alternator makes and the common ones of zxcvbn
+var l33tTable = buildL33tTable()
+
+func buildL33tTable() map[rune][]rune {
+	table := map[rune][]rune{}
+	add := func(substitute rune, letter rune) {
+		for _, existing := range table[substitute] {
+			if existing == letter {
+				return
+			}
+		}
+		table[substitute] = append(table[substitute], letter)
+	}
+
+	for key, alternatives := range generator.ManipulateMap {
+		for _, alternative := range alternatives {
+			from, to := []rune(alternative)[0], []rune(key)[0]
+			// Symbols and digits standing for a letter, in both directions of the map
+			if unicode.IsLetter(to) && !unicode.IsLetter(from) {
+				add(from, to)
+			}
+			if !unicode.IsLetter(to) && unicode.IsLetter(from) {
+				add(to, unicode.ToLower(from))
+			}
+		}
+	}
+
+	for letter, substitutes := range map[rune]string{
+		'a': "4@", 'b': "8", 'c': "({[<", 'e': "3", 'g': "69", 'i': "1!|",
+		'l': "1|7", 'o': "0", 's': "$5", 't': "+7", 'x': "%", 'z': "2",
+	} {
+		for _, substitute := range substitutes {
+			add(substitute, letter)
+		}
+	}
+
+	for substitute := range table {
+		sort.Slice(table[substitute], func(a, b int) bool {
+			return table[substitute][a] < table[substitute][b]
+		})
+	}
+
+	return table
+}
+
+// Substitution maps are combined, a long passphrase stops at this many
+const maxL33tSubstitutions = 64
+
+func l33tMatch(password []rune, dictionaries map[string]rankedDictionary) []*Match {
+	substitutes := []rune{}
+	seen := map[rune]bool{}
+	for _, character := range password {
+		if _, found := l33tTable[character]; found && !seen[character] {
+			seen[character] = true
+			substitutes = append(substitutes, character)
+		}
+	}
+	sort.Slice(substitutes, func(a, b int) bool { return substitutes[a] < substitutes[b] })
+
+	// Every substitute stands for one of its letters at a time
+	substitutions := []map[rune]rune{{}}
+	for _, substitute := range substitutes {
+		next := []map[rune]rune{}
+		for _, substitution := range substitutions {
+			for _, letter := range l33tTable[substitute] {
+				extended := map[rune]rune{substitute: letter}
+				for key, value := range substitution {
+					extended[key] = value
+				}
+				next = append(next, extended)
+				if len(next) >= maxL33tSubstitutions {
+					break
+				}
+			}
+			if len(next) >= maxL33tSubstitutions {
+				break
+			}
+		}
+		substitutions = next
+	}
+
+	matches := []*Match{}
+	// The same word can be found through several substitution maps
+	found := map[string]bool{}
+	for _, substitution := range substitutions {
+		if len(substitution) == 0 {
+			continue
+		}
+
+		translated := make([]rune, len(password))
+		for index, character := range password {
+			if letter, ok := substitution[character]; ok {
+				translated[index] = letter
+			} else {
+				translated[index] = character
+			}
+		}
+
+		for _, match := range dictionaryMatch(translated, dictionaries) {
+			token := password[match.i : match.j+1]
+			if len(token) <= 1 || strings.ToLower(string(token)) == match.matchedWord {
+				continue
+			}
+
+			// The substitutions used by this token only
+			used := map[rune]rune{}
+			for _, character := range token {
+				if letter, ok := substitution[character]; ok {
+					used[character] = letter
+				}
+			}
+
+			key := strconv.Itoa(match.i) + ":" + strconv.Itoa(match.j) + ":" + match.Dictionary + ":" + match.matchedWord
+			if found[key] {
+				continue
+			}
+			found[key] = true
+
+			match.Token = string(token)
+			match.L33t = true
+			match.substitutions = used
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+func spatialMatch(password []rune) []*Match {
+	matches := []*Match{}
+	for _, name := range sortedKeys(keyboardGraphs) {
+		matches = append(matches, spatialMatchGraph(password, name, keyboardGraphs[name])...)
+	}
+	return matches
+}
+
+const shiftedCharacters = "~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:\"ZXCVBNM<>?"
+
+func spatialMatchGraph(password []rune, name string, graph *adjacencyGraph) []*Match {
+	matches := []*Match{}
+	slanted := name != GraphKeypad
+
+	i := 0
+	for i < len(password)-1 {
+		j := i + 1
+		lastDirection := -1
+		turns := 0
+		shiftedCount := 0
+		if slanted && strings.ContainsRune(shiftedCharacters, password[i]) {
+			shiftedCount = 1
+		}
+
+		for {
+			found := false
+			if j < len(password) {
+				for direction, neighbour := range graph.neighbours[password[j-1]] {
+					index := strings.IndexRune(neighbour, password[j])
+					if neighbour == "" || index < 0 {
+						continue
+					}
+
+					found = true
+					// The second character of a key is typed with shift
+					if index > 0 {
+						shiftedCount++
+					}
+					if lastDirection != direction {
+						turns++
+						lastDirection = direction
+					}
+					break
+				}
+			}
+
+			if found {
+				j++
+				continue
+			}
+
+			// Walks of at least 3 keys are a pattern
+			if j-i > 2 {
+				matches = append(matches, &Match{
+					Pattern:      PatternSpatial,
+					Token:        string(password[i:j]),
+					Graph:        name,
+					i:            i,
+					j:            j - 1,
+					turns:        turns,
+					shiftedCount: shiftedCount,
+				})
+			}
+			i = j
+			break
+		}
+	}
+
+	return matches
+}
+
+// The longest run of a repeated block starting at each position, with the shortest block
+func repeatMatch(password []rune, dictionaries map[string]rankedDictionary) []*Match {
+	matches := []*Match{}
+
+	i := 0
+	for i < len(password) {
+		bestLength, bestBlock := 0, 0
+		for block := 1; i+2*block <= len(password); block++ {
+			count := 1
+			for i+(count+1)*block <= len(password) &&
+				string(password[i+count*block:i+(count+1)*block]) == string(password[i:i+block]) {
+				count++
+			}
+
+			if count >= 2 && count*block > bestLength {
+				bestLength, bestBlock = count*block, block
+			}
+		}
+
+		if bestLength == 0 {
+			i++
+			continue
+		}
+
+		base := password[i : i+bestBlock]
+		baseGuesses := mostGuessableSequence(base, omnimatch(base, dictionaries), false).Guesses
+		matches = append(matches, &Match{
+			Pattern:     PatternRepeat,
+			Token:       string(password[i : i+bestLength]),
+			i:           i,
+			j:           i + bestLength - 1,
+			baseToken:   string(base),
+			baseGuesses: baseGuesses,
+			repeatCount: bestLength / bestBlock,
+		})
+		i += bestLength
+	}
+
+	return matches
+}
+
+// Steps larger than this are not a sequence
+const maxSequenceDelta = 5
+
+func sequenceMatch(password []rune) []*Match {
+	matches := []*Match{}
+	if len(password) <= 1 {
+		return matches
+	}
+
+	add := func(i int, j int, delta int) {
+		// Two characters only make a sequence when they are neighbours
+		delta = absolute(delta)
+		if delta == 0 || delta > maxSequenceDelta || (j-i <= 1 && delta != 1) {
+			return
+		}
+
+		token := password[i : j+1]
+		space := 26
+		if isAll(token, unicode.IsDigit) {
+			space = 10
+		} else if !isAll(token, unicode.IsLetter) {
+			// Other characters, such as symbols
+			space = 95
+		}
+
+		matches = append(matches, &Match{
+			Pattern:       PatternSequence,
+			Token:         string(token),
+			i:             i,
+			j:             j,
+			sequenceSpace: space,
+			ascending:     token[1] > token[0],
+		})
+	}
+
+	i := 0
+	lastDelta := int(password[1]) - int(password[0])
+	for k := 2; k < len(password); k++ {
+		delta := int(password[k]) - int(password[k-1])
+		if delta == lastDelta {
+			continue
+		}
+
+		add(i, k-1, lastDelta)
+		i = k - 1
+		lastDelta = delta
+	}
+	add(i, len(password)-1, lastDelta)
+
+	return matches
+}
+
+func isAll(runes []rune, test func(rune) bool) bool {
+	for _, character := range runes {
+		if !test(character) {
+			return false
+		}
+	}
+	return true
+}
+
+var recentYear = regexp.MustCompile(`19\d\d|20\d\d`)
+
+func yearMatch(password []rune) []*Match {
+	matches := []*Match{}
+	text := string(password)
+	for _, location := range recentYear.FindAllStringIndex(text, -1) {
+		// Byte offsets of the match, converted to rune positions
+		i := len([]rune(text[:location[0]]))
+		token := text[location[0]:location[1]]
+		year, _ := strconv.Atoi(token)
+
+		matches = append(matches, &Match{
+			Pattern: PatternYear,
+			Token:   token,
+			i:       i,
+			j:       i + len(token) - 1,
+			year:    year,
+		})
+	}
+
+	return matches
+}
+
+const (
+	dateMinYear = 1000
+	dateMaxYear = 2050
+)
+
+// Where a date without separators splits into its three numbers
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+var dateWithSeparators = regexp.MustCompile(`^(\d{1,4})([\s/\\_.-])(\d{1,2})([\s/\\_.-])(\d{1,4})$`)
+
+func dateMatch(password []rune) []*Match {
+	matches := []*Match{}
+
+	for i := range password {
+		for j := i + 3; j <= i+7 && j < len(password); j++ {
+			token := password[i : j+1]
+			if !isAll(token, unicode.IsDigit) {
+				continue
+			}
+
+			// The candidate closest to the reference year is the most likely
+			best := 0
+			for _, split := range dateSplits[len(token)] {
+				numbers := [3]int{}
+				numbers[0], _ = strconv.Atoi(string(token[:split[0]]))
+				numbers[1], _ = strconv.Atoi(string(token[split[0]:split[1]]))
+				numbers[2], _ = strconv.Atoi(string(token[split[1]:]))
+
+				year, ok := dateYear(numbers)
+				if ok && (best == 0 || absolute(year-referenceYear()) < absolute(best-referenceYear())) {
+					best = year
+				}
+			}
+
+			if best != 0 {
+				matches = append(matches, &Match{
+					Pattern: PatternDate,
+					Token:   string(token),
+					i:       i,
+					j:       j,
+					year:    best,
+				})
+			}
+		}
+
+		for j := i + 5; j <= i+9 && j < len(password); j++ {
+			token := string(password[i : j+1])
+			groups := dateWithSeparators.FindStringSubmatch(token)
+			if groups == nil || groups[2] != groups[4] {
+				continue
+			}
+
+			numbers := [3]int{}
+			numbers[0], _ = strconv.Atoi(groups[1])
+			numbers[1], _ = strconv.Atoi(groups[3])
+			numbers[2], _ = strconv.Atoi(groups[5])
+
+			if year, ok := dateYear(numbers); ok {
+				matches = append(matches, &Match{
+					Pattern:   PatternDate,
+					Token:     token,
+					i:         i,
+					j:         j,
+					year:      year,
+					separator: true,
+				})
+			}
+		}
+	}
+
+	// Dates inside longer dates are dropped
+	filtered := []*Match{}
+	for _, match := range matches {
+		inside := false
+		for _, other := range matches {
+			if other != match && other.i <= match.i && other.j >= match.j &&
+				(other.i != match.i || other.j != match.j) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			filtered = append(filtered, match)
+		}
+	}
+
+	return filtered
+}
+
+// The year of three numbers that form a day, month and year in any order
+func dateYear(numbers [3]int) (int, bool) {
+	if numbers[1] > 31 || numbers[1] <= 0 {
+		return 0, false
+	}
+
+	over12, over31, under1 := 0, 0, 0
+	for _, number := range numbers {
+		if (number > 99 && number < dateMinYear) || number > dateMaxYear {
+			return 0, false
+		}
+		if number > 31 {
+			over31++
+		}
+		if number > 12 {
+			over12++
+		}
+		if number <= 0 {
+			under1++
+		}
+	}
+	if over31 >= 2 || over12 == 3 || under1 >= 2 {
+		return 0, false
+	}
+
+	splits := []struct {
+		year int
+		rest [2]int
+	}{
+		{numbers[2], [2]int{numbers[0], numbers[1]}},
+		{numbers[0], [2]int{numbers[1], numbers[2]}},
+	}
+
+	for _, split := range splits {
+		if split.year >= dateMinYear && split.year <= dateMaxYear {
+			return split.year, isDayMonth(split.rest)
+		}
+	}
+
+	for _, split := range splits {
+		if isDayMonth(split.rest) {
+			// Two digit years are expanded to the closest century
+			if split.year > 50 {
+				return 1900 + split.year, true
+			}
+			return 2000 + split.year, true
+		}
+	}
+
+	return 0, false
+}
+
+func isDayMonth(numbers [2]int) bool {
+	for _, pair := range [][2]int{numbers, {numbers[1], numbers[0]}} {
+		day, month := pair[0], pair[1]
+		if day >= 1 && day <= 31 && month >= 1 && month <= 12 {
+			return true
+		}
+	}
+	return false
+}
+
+func absolute(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
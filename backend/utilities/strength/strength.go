@@ -1,55 +1,200 @@
 package strength
 
-import "strings"
+import (
+	"math"
+	"strings"
+)
 
-func CalculateStrength(passphrase string) (int, error) {
-	lengthScore := getLengthScore(passphrase)
-	characterSetScore := getCharacterSetScore(passphrase)
-	return lengthScore + characterSetScore, nil
+/**
+ * Passphrase strength estimation in the manner of zxcvbn.
+ * Instead of counting character classes, the passphrase is matched
+ * against dictionaries, keyboard walks, repeats, sequences and dates, and
+ * scored by the guesses an attacker who knows these patterns would need.
+ * Version is increased whenever scores change, so stored ones are
+ * recomputed.
+ */
+
+const Version = 2
+
+// Longer passphrases are only estimated on their start, the rest can only add guesses
+const maxEstimatedLength = 100
+
+// Guesses a passphrase needs for each score above 0
+var scoreThresholds = []float64{1e3 + 5, 1e6 + 5, 1e8 + 5, 1e10 + 5}
+
+const MaxScore = 4
+
+type Feedback struct {
+	Warning     string
+	Suggestions []string
+}
+
+type Result struct {
+	// 0 is too guessable, 4 is very unguessable
+	Score        int
+	Guesses      float64
+	GuessesLog10 float64
+	Entropy      float64
+	Feedback     Feedback
+	Matches      []*Match
 }
 
-type lengthRange struct {
-	min int
-	max int
+// The user inputs, such as the platform and identifier of the account, count as dictionary words
+func Estimate(passphrase string, userInputs ...string) *Result {
+	password := []rune(passphrase)
+	if len(password) > maxEstimatedLength {
+		password = password[:maxEstimatedLength]
+	}
+
+	dictionaries := map[string]rankedDictionary{}
+	for name, dictionary := range embeddedDictionaries() {
+		dictionaries[name] = dictionary
+	}
+	if len(userInputs) > 0 {
+		dictionaries[DictionaryUserInputs] = userInputsDictionary(userInputs)
+	}
+
+	sequence := mostGuessableSequence(password, omnimatch(password, dictionaries), false)
+	score := 0
+	for _, threshold := range scoreThresholds {
+		if sequence.Guesses >= threshold {
+			score++
+		}
+	}
+
+	return &Result{
+		Score:        score,
+		Guesses:      sequence.Guesses,
+		GuessesLog10: sequence.GuessesLog10,
+		Entropy:      sequence.GuessesLog10 * math.Log2(10),
+		Feedback:     feedback(score, sequence.Sequence),
+		Matches:      sequence.Sequence,
+	}
 }
 
-var lengthScores = map[lengthRange]int{
-	{0, 5}:   -2,
-	{6, 7}:   0,
-	{8, 12}:  1,
-	{13, 16}: 2,
-	{17, 20}: 3,
+func CalculateStrength(passphrase string, userInputs ...string) (int, error) {
+	return Estimate(passphrase, userInputs...).Score, nil
 }
 
-func getLengthScore(passphrase string) int {
-	length := len(passphrase)
+const suggestionAnotherWord = "Add another word or two. Uncommon words are better."
+
+func feedback(score int, sequence []*Match) Feedback {
+	if len(sequence) == 0 {
+		return Feedback{
+			Suggestions: []string{
+				"Use a few words, avoid common phrases.",
+				"No need for symbols, digits, or uppercase letters.",
+			},
+		}
+	}
+
+	if score > 2 {
+		return Feedback{Suggestions: []string{}}
+	}
 
-	// Find the range that the length falls into
-	for rangeIn, score := range lengthScores {
-		if length >= rangeIn.min && length <= rangeIn.max {
-			return score
+	longest := sequence[0]
+	for _, match := range sequence[1:] {
+		if len([]rune(match.Token)) > len([]rune(longest.Token)) {
+			longest = match
 		}
 	}
-	return 4
+
+	result := matchFeedback(longest, len(sequence) == 1)
+	result.Suggestions = append([]string{suggestionAnotherWord}, result.Suggestions...)
+	return result
 }
 
-var characterSetScores = map[string]int{
-	"abcdefghijklmnopqrstuvwxyz":         1,
-	"ABCDEFGHIJKLMNOPQRSTUVWXYZ":         1,
-	"0123456789":                         1,
-	"!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~": 1,
+func matchFeedback(match *Match, soleMatch bool) Feedback {
+	switch match.Pattern {
+	case PatternDictionary:
+		return dictionaryFeedback(match, soleMatch)
+
+	case PatternSpatial:
+		warning := "Short keyboard patterns are easy to guess."
+		if match.turns == 1 {
+			warning = "Straight rows of keys are easy to guess."
+		}
+		return Feedback{
+			Warning:     warning,
+			Suggestions: []string{"Use a longer keyboard pattern with more turns."},
+		}
+
+	case PatternRepeat:
+		warning := `Repeats like "abcabcabc" are only slightly harder to guess than "abc".`
+		if len([]rune(match.baseToken)) == 1 {
+			warning = `Repeats like "aaa" are easy to guess.`
+		}
+		return Feedback{
+			Warning:     warning,
+			Suggestions: []string{"Avoid repeated words and characters."},
+		}
+
+	case PatternSequence:
+		return Feedback{
+			Warning:     "Sequences like abc or 6543 are easy to guess.",
+			Suggestions: []string{"Avoid sequences."},
+		}
+
+	case PatternYear:
+		return Feedback{
+			Warning:     "Recent years are easy to guess.",
+			Suggestions: []string{"Avoid recent years.", "Avoid years that are associated with you."},
+		}
+
+	case PatternDate:
+		return Feedback{
+			Warning:     "Dates are often easy to guess.",
+			Suggestions: []string{"Avoid dates and years that are associated with you."},
+		}
+	}
+
+	return Feedback{Suggestions: []string{}}
 }
 
-func getCharacterSetScore(passphrase string) int {
-	score := 0
-	for characterSet, characterSetScore := range characterSetScores {
-		// Check if any character from the character set is present in the passphrase
-		for _, char := range characterSet {
-			if strings.ContainsRune(passphrase, char) {
-				score += characterSetScore
-				break // Found at least one character from this set, move to next set
+func dictionaryFeedback(match *Match, soleMatch bool) Feedback {
+	warning := ""
+	switch match.Dictionary {
+	case DictionaryPasswords:
+		if soleMatch && !match.L33t && !match.Reversed {
+			switch {
+			case match.rank <= 10:
+				warning = "This is a top-10 common password."
+			case match.rank <= 100:
+				warning = "This is a top-100 common password."
+			default:
+				warning = "This is a very common password."
 			}
+		} else if math.Log10(match.Guesses) <= 4 {
+			warning = "This is similar to a commonly used password."
+		}
+
+	case DictionaryEnglish:
+		if soleMatch {
+			warning = "A word by itself is easy to guess."
+		}
+
+	case DictionaryNames:
+		warning = "Common names and surnames are easy to guess."
+		if soleMatch {
+			warning = "Names and surnames by themselves are easy to guess."
 		}
+
+	case DictionaryUserInputs:
+		warning = "Passphrases based on the platform or identifier are easy to guess."
+	}
+
+	suggestions := []string{}
+	if startUpper.MatchString(match.Token) {
+		suggestions = append(suggestions, "Capitalization doesn't help very much.")
+	} else if allUpper.MatchString(match.Token) && strings.ToLower(match.Token) != match.Token {
+		suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase.")
 	}
-	return score
+	if match.Reversed && len([]rune(match.Token)) >= 4 {
+		suggestions = append(suggestions, "Reversed words aren't much harder to guess.")
+	}
+	if match.L33t {
+		suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+	}
+
+	return Feedback{Warning: warning, Suggestions: suggestions}
 }
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"net/http"
 	"os"
 
 	"passenger-go/backend"
 	"passenger-go/backend/middlewares"
+	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/api_error"
+	"passenger-go/backend/utilities/config"
+	"passenger-go/backend/utilities/database"
+	"passenger-go/backend/utilities/encrypt"
+	"passenger-go/backend/utilities/jwtoken"
 	"passenger-go/backend/utilities/logger"
 	"passenger-go/frontend"
 
@@ -15,10 +23,45 @@ import (
 func main() {
 	log := logger.GetLogger()
 
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.SecretsGenerated {
+		log.Printf("Generated missing secrets into %s, back it up with the database", cfg.KeyFilePath())
+	}
+
+	// Every package gets its settings before anything uses them
+	api_error.Configure(cfg)
+	jwtoken.Configure(cfg)
+	encrypt.Configure(cfg)
+
+	if err := database.Open(cfg.DatabasePath()); err != nil {
+		log.Fatalf("Failed to open the database: %v", err)
+	}
+
+	if err := services.Configure(cfg); err != nil {
+		log.Fatalf("Failed to configure the services: %v", err)
+	}
+
+	// Keep the vault unlocked across restarts if AES_GCM_SECRET wraps the data key
+	if err := services.NewAuthService().UnlockWithEnvironmentKey(); err != nil {
+		log.Fatalf("Failed to unlock the vault: %v", err)
+	}
+
+	// Rescore passphrases scored by an older strength estimator
+	services.NewStrengthService().RecomputeLater()
+
+	// Check the stored passphrases against known breaches periodically
+	services.StartBreachChecks()
+
 	router := chi.NewRouter()
 
 	// Initialize frontend controller
-	frontendController, err := frontend.NewFrontendController()
+	frontendController, err := frontend.NewFrontendController(cfg.FrontendDir)
 	if err != nil {
 		log.Fatalf("Failed to initialize frontend controller: %v", err)
 	}
@@ -33,10 +76,7 @@ func main() {
 	router.Mount("/", apiRouter)
 
 	// Create server
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatalf("PORT environment variable is not set")
-	}
+	port := cfg.Port
 	server := &http.Server{
 		Addr:    ":" + port,
 		Handler: router,
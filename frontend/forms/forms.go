@@ -1,12 +1,22 @@
 package forms
 
 import (
+	htmltemplate "html/template"
+	"io"
 	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
+	"passenger-go/backend/utilities/client"
 	"passenger-go/backend/utilities/importer"
+	"passenger-go/backend/utilities/jwtoken"
+	"passenger-go/frontend/utilities/auth"
 	"passenger-go/frontend/utilities/form"
 	"passenger-go/frontend/utilities/template"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 )
@@ -14,16 +24,26 @@ import (
 type FormsController struct {
 	template        *template.TemplateManager
 	authService     *services.AuthService
+	sessionsService *services.SessionsService
+	tokensService   *services.TokensService
+	throttleService *services.ThrottleService
 	accountsService *services.AccountsService
 	transferService *services.TransferService
+	backupService   *services.BackupService
+	policiesService *services.PoliciesService
 }
 
-func NewFormsController() *FormsController {
+func NewFormsController(templates *template.TemplateManager) *FormsController {
 	return &FormsController{
-		template:        template.NewTemplateManager(),
+		template:        templates,
 		authService:     services.NewAuthService(),
+		sessionsService: services.NewSessionsService(),
+		tokensService:   services.NewTokensService(),
+		throttleService: services.NewThrottleService(),
 		accountsService: services.NewAccountsService(),
 		transferService: services.NewTransferService(),
+		backupService:   services.NewBackupService(),
+		policiesService: services.NewPoliciesService(),
 	}
 }
 
@@ -67,8 +87,14 @@ func (controller *FormsController) FormComplete(
 ) {
 	recovery := request.FormValue("recovery")
 
-	err := controller.authService.CompleteRegistration(recovery)
+	address := client.Address(request)
+	err := controller.throttleService.Attempt(address, services.ThrottleValidate)
+	if err == nil {
+		err = controller.authService.CompleteRegistration(recovery)
+		controller.throttleService.Record(address, services.ThrottleValidate, err)
+	}
 	if err != nil {
+		writeRetryAfter(writer, err)
 		apiError, ok := err.(*schemas.APIError)
 		if ok {
 			if apiError.Code == string(schemas.ErrAlreadyInitialized) {
@@ -97,7 +123,17 @@ func (controller *FormsController) FormLogin(
 ) {
 	passphrase := request.FormValue("passphrase")
 
-	token, err := controller.authService.LoginUser(passphrase)
+	address := client.Address(request)
+	if err := controller.throttleService.Attempt(address, services.ThrottleLogin); err != nil {
+		writeRetryAfter(writer, err)
+		controller.template.Render(writer, "auth", "login", map[string]string{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	login, err := controller.authService.LoginUser(passphrase, client.Device(request))
+	controller.throttleService.Record(address, services.ThrottleLogin, err)
 	if err != nil {
 		controller.template.Render(writer, "auth", "login", map[string]string{
 			"Error": err.Error(),
@@ -105,16 +141,84 @@ func (controller *FormsController) FormLogin(
 		return
 	}
 
-	http.SetCookie(writer, &http.Cookie{
-		Name:   "token",
-		Value:  token,
-		Path:   "/",
-		MaxAge: 360,
-	})
+	if login.TwoFactorRequired {
+		controller.template.Render(writer, "auth", "login-totp", map[string]string{
+			"Challenge": login.Challenge,
+		})
+		return
+	}
+
+	setTokenCookie(writer, request, login.Token)
+	http.Redirect(writer, request, "/", http.StatusFound)
+}
+
+func (controller *FormsController) FormLoginTwoFactor(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	challenge := request.FormValue("challenge")
+	code := request.FormValue("code")
 
+	address := client.Address(request)
+	err := controller.throttleService.Attempt(address, services.ThrottleLoginTwoFactor)
+	if err != nil {
+		writeRetryAfter(writer, err)
+		controller.template.Render(writer, "auth", "login-totp", map[string]string{
+			"Challenge": challenge,
+			"Error":     err.Error(),
+		})
+		return
+	}
+
+	token, err := controller.authService.CompleteLogin(challenge, code, client.Device(request))
+	controller.throttleService.Record(address, services.ThrottleLoginTwoFactor, err)
+	if err != nil {
+		controller.template.Render(writer, "auth", "login-totp", map[string]string{
+			"Challenge": challenge,
+			"Error":     err.Error(),
+		})
+		return
+	}
+
+	setTokenCookie(writer, request, token)
 	http.Redirect(writer, request, "/", http.StatusFound)
 }
 
+// Sends the status and Retry-After header of a refused attempt before the page is rendered
+func writeRetryAfter(writer http.ResponseWriter, err error) {
+	apiError, ok := err.(*schemas.APIError)
+	if !ok || apiError.Code != string(schemas.ErrTooManyAttempts) {
+		return
+	}
+
+	writer.Header().Set("Retry-After", strconv.Itoa(apiError.RetryAfter))
+	writer.WriteHeader(http.StatusTooManyRequests)
+}
+
+// The cookie lasts as long as the token, the server ends idle sessions before that
+func setTokenCookie(writer http.ResponseWriter, request *http.Request, token string) {
+	http.SetCookie(writer, tokenCookie(request, token, int(jwtoken.TokenLifetime.Seconds())))
+}
+
+// Clear the token cookie by setting it with MaxAge of -1
+func clearTokenCookie(writer http.ResponseWriter, request *http.Request) {
+	http.SetCookie(writer, tokenCookie(request, "", -1))
+}
+
+// Scripts cannot read the cookie and other sites cannot post with it.
+// It is only marked Secure behind HTTPS, so plain HTTP in a LAN keeps working.
+func tokenCookie(request *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "token",
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https"),
+	}
+}
+
 func (controller *FormsController) FormAccountDetails(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -125,25 +229,57 @@ func (controller *FormsController) FormAccountDetails(
 	passphrase := request.FormValue("passphrase")
 	url := request.FormValue("url")
 	notes := request.FormValue("notes")
+	totp := request.FormValue("totp")
+	reprompt := request.FormValue("reprompt") == "on"
 
-	err := controller.accountsService.UpdateAccount(id, &schemas.RequestAccountsUpsert{
+	// Shown again when the form is rendered with an error or warnings
+	account := &schemas.ResponseAccountDetails{
+		Id:         id,
 		Platform:   platform,
 		Identifier: identifier,
 		Passphrase: passphrase,
 		Url:        url,
 		Notes:      notes,
-	})
+		Totp:       totp,
+		Reprompt:   reprompt,
+	}
+
+	policy, policyProfile, err := form.ParsePolicyForm(request.FormValue("policyProfile"), request.FormValue("policy"))
+	if err == nil {
+		account.RotationDays, err = form.ParseRotationDays(request.FormValue("rotationDays"))
+	}
+	if err == nil {
+		account.Policy, account.PolicyProfile = policy, policyProfile
+		account.Warnings, err = controller.accountsService.UpdateAccount(id, &schemas.RequestAccountsUpsert{
+			Platform:      platform,
+			Identifier:    identifier,
+			Passphrase:    passphrase,
+			Url:           url,
+			Notes:         notes,
+			Totp:          totp,
+			Reprompt:      reprompt,
+			Policy:        policy,
+			PolicyProfile: policyProfile,
+			RotationDays:  account.RotationDays,
+		}, guards.Actor(request))
+	}
 	if err != nil {
 		controller.template.Render(writer, "app", "details", map[string]any{
-			"Error": err.Error(),
-			"Account": &schemas.ResponseAccountDetails{
-				Id:         id,
-				Platform:   platform,
-				Identifier: identifier,
-				Passphrase: passphrase,
-				Url:        url,
-				Notes:      notes,
-			},
+			"Error":    err.Error(),
+			"Account":  account,
+			"Profiles": controller.policyProfiles(),
+			"History":  controller.passphraseHistory(id),
+		})
+		return
+	}
+
+	// The passphrase was saved, but it may be refused by the site
+	if len(account.Warnings) > 0 {
+		controller.template.Render(writer, "app", "details", map[string]any{
+			"Message":  "Account saved",
+			"Account":  account,
+			"Profiles": controller.policyProfiles(),
+			"History":  controller.passphraseHistory(id),
 		})
 		return
 	}
@@ -160,28 +296,57 @@ func (controller *FormsController) FormAccountCreate(
 	passphrase := request.FormValue("passphrase")
 	url := request.FormValue("url")
 	notes := request.FormValue("notes")
-
-	account, err := controller.accountsService.CreateAccount(&schemas.RequestAccountsUpsert{
-		Platform:   platform,
-		Identifier: identifier,
-		Passphrase: passphrase,
-		Url:        url,
-		Notes:      notes,
-	})
+	totp := request.FormValue("totp")
+
+	rotationDays, err := form.ParseRotationDays(request.FormValue("rotationDays"))
+	var account *schemas.ResponseAccountDetails
+	if err == nil {
+		account, err = controller.accountsService.CreateAccount(&schemas.RequestAccountsUpsert{
+			Platform:      platform,
+			Identifier:    identifier,
+			Passphrase:    passphrase,
+			Url:           url,
+			Notes:         notes,
+			Totp:          totp,
+			Reprompt:      request.FormValue("reprompt") == "on",
+			PolicyProfile: request.FormValue("policyProfile"),
+			RotationDays:  rotationDays,
+		}, guards.Actor(request))
+	}
 
 	if err != nil {
-		controller.template.Render(writer, "app", "create", map[string]string{
-			"Error": err.Error(),
+		controller.template.Render(writer, "app", "create", map[string]any{
+			"Error":    err.Error(),
+			"Profiles": controller.policyProfiles(),
 		})
 		return
 	}
 
 	controller.template.Render(writer, "app", "details", map[string]any{
-		"Account": account,
-		"Message": "Account created successfully",
+		"Account":  account,
+		"Message":  "Account created successfully",
+		"Profiles": controller.policyProfiles(),
 	})
 }
 
+// The profiles offered by the policy select, none when they can't be read
+func (controller *FormsController) policyProfiles() []*schemas.ResponsePolicyProfile {
+	profiles, err := controller.policiesService.GetProfiles()
+	if err != nil {
+		return []*schemas.ResponsePolicyProfile{}
+	}
+	return profiles
+}
+
+// The previous passphrases listed on the details page, none when they can't be read
+func (controller *FormsController) passphraseHistory(id string) []*schemas.ResponsePassphraseHistory {
+	history, err := controller.accountsService.GetHistory(id)
+	if err != nil {
+		return []*schemas.ResponsePassphraseHistory{}
+	}
+	return history
+}
+
 func (controller *FormsController) FormImport(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -209,7 +374,7 @@ func (controller *FormsController) FormImport(
 	platform := importer.GetPlatform(csvFile)
 	if platform.Fields == nil {
 		controller.template.Render(writer, "app", "import", map[string]string{
-			"Error": "The uploaded file format is not supported. Please use Firefox or Chromium export format.",
+			"Error": "The uploaded file format is not supported. Please use a Firefox, Chromium, Bitwarden or Passenger export.",
 		})
 		return
 	}
@@ -237,7 +402,7 @@ func (controller *FormsController) FormImport(
 		return
 	}
 
-	importResult, err := controller.transferService.Import(accounts)
+	importResult, err := controller.transferService.Import(accounts, guards.Actor(request))
 	if err != nil {
 		controller.template.Render(writer, "app", "import", map[string]string{
 			"Error": err.Error(),
@@ -258,6 +423,108 @@ func (controller *FormsController) FormImport(
 	})
 }
 
+// Responds with the .passenger file, the page is only rendered again on errors
+func (controller *FormsController) FormCreateBackup(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	passphrase := request.FormValue("passphrase")
+	confirmPassphrase := request.FormValue("confirmPassphrase")
+
+	formError := form.ValidateBackupForm(passphrase, confirmPassphrase)
+	if formError != "" {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": formError,
+		})
+		return
+	}
+
+	backup, err := controller.backupService.Create(passphrase, guards.Actor(request))
+	if err != nil {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Disposition", "attachment; filename="+services.BackupFilename(time.Now()))
+	writer.Write(backup)
+}
+
+func (controller *FormsController) FormRestoreBackup(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	request.Body = http.MaxBytesReader(writer, request.Body, services.BackupMaxSize)
+
+	passphrase := request.FormValue("passphrase")
+	mode := request.FormValue("mode")
+
+	formError := form.ValidateRestoreForm(passphrase, mode)
+	if formError != "" {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": formError,
+		})
+		return
+	}
+
+	file, _, err := request.FormFile("file")
+	if err != nil {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": "A backup file is required",
+		})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	result, err := controller.backupService.Restore(content, passphrase, mode, guards.Actor(request))
+	if err != nil {
+		controller.template.Render(writer, "app", "backup", map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.template.Render(writer, "app", "backup", map[string]any{
+		"Restored": result,
+	})
+}
+
+func (controller *FormsController) FormReauthenticate(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	next := auth.SafeNext(request.FormValue("next"))
+	address := client.Address(request)
+
+	err := controller.throttleService.Attempt(address, services.ThrottleReauthenticate)
+	if err == nil {
+		_, err = controller.authService.Reauthenticate(
+			guards.SessionId(request),
+			request.FormValue("passphrase"),
+		)
+		controller.throttleService.Record(address, services.ThrottleReauthenticate, err)
+	}
+	if err != nil {
+		controller.template.Render(writer, "app", "reauthenticate", map[string]any{
+			"Error": err.Error(),
+			"Next":  next,
+		})
+		return
+	}
+
+	http.Redirect(writer, request, next, http.StatusSeeOther)
+}
+
 func (controller *FormsController) FormChangePassword(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -274,7 +541,7 @@ func (controller *FormsController) FormChangePassword(
 		return
 	}
 
-	err := controller.authService.UpdatePassphrase(passphrase)
+	err := controller.authService.UpdatePassphrase(passphrase, guards.Actor(request))
 	if err != nil {
 		controller.template.Render(writer, "app", "change-password", map[string]string{
 			"Error": err.Error(),
@@ -287,6 +554,251 @@ func (controller *FormsController) FormChangePassword(
 	})
 }
 
+func (controller *FormsController) FormTwoFactorEnroll(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	enrollment, err := controller.authService.EnrollTwoFactor()
+	if err != nil {
+		controller.renderTwoFactor(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTwoFactor(writer, map[string]any{
+		"Enrollment": enrollment,
+		// Trusted data URI generated by the server
+		"QRCode": htmltemplate.URL(enrollment.QRCode),
+	})
+}
+
+func (controller *FormsController) FormTwoFactorConfirm(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	code := request.FormValue("code")
+
+	recoveryCodes, err := controller.authService.ConfirmTwoFactor(code)
+	if err != nil {
+		controller.renderTwoFactor(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTwoFactor(writer, map[string]any{
+		"Message":       "Two-factor authentication enabled",
+		"RecoveryCodes": recoveryCodes.RecoveryCodes,
+	})
+}
+
+func (controller *FormsController) FormTwoFactorDisable(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	address := client.Address(request)
+
+	err := controller.throttleService.Attempt(address, services.ThrottleTwoFactorOff)
+	if err == nil {
+		err = controller.authService.DisableTwoFactor(request.FormValue("passphrase"))
+		controller.throttleService.Record(address, services.ThrottleTwoFactorOff, err)
+	}
+	if err != nil {
+		controller.renderTwoFactor(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTwoFactor(writer, map[string]any{
+		"Message": "Two-factor authentication disabled",
+	})
+}
+
+func (controller *FormsController) FormRecoveryKey(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	address := client.Address(request)
+
+	var recovery string
+	err := controller.throttleService.Attempt(address, services.ThrottleRecoveryKey)
+	if err == nil {
+		recovery, err = controller.authService.RegenerateRecoveryKey(request.FormValue("passphrase"))
+		controller.throttleService.Record(address, services.ThrottleRecoveryKey, err)
+	}
+	if err != nil {
+		controller.template.Render(writer, "app", "recovery-key", map[string]string{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.template.Render(writer, "app", "recovery-key", map[string]string{
+		"Message":  "A new recovery key was generated, the previous one no longer works",
+		"Recovery": recovery,
+	})
+}
+
+func (controller *FormsController) FormRevokeSession(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	id := chi.URLParam(request, "id")
+
+	if err := controller.sessionsService.Revoke(id); err != nil {
+		controller.renderSessions(writer, request, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	// Revoking this device is a logout
+	if id == guards.SessionId(request) {
+		clearTokenCookie(writer, request)
+		http.Redirect(writer, request, "/login", http.StatusFound)
+		return
+	}
+
+	controller.renderSessions(writer, request, map[string]any{
+		"Message": "Session revoked",
+	})
+}
+
+func (controller *FormsController) FormRevokeOtherSessions(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	if err := controller.sessionsService.RevokeOthers(guards.SessionId(request)); err != nil {
+		controller.renderSessions(writer, request, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderSessions(writer, request, map[string]any{
+		"Message": "All other sessions were revoked",
+	})
+}
+
+// Renders the sessions page with the current list
+func (controller *FormsController) renderSessions(
+	writer http.ResponseWriter,
+	request *http.Request,
+	data map[string]any,
+) {
+	sessions, err := controller.sessionsService.List(guards.SessionId(request))
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	data["Sessions"] = sessions
+
+	controller.template.Render(writer, "app", "sessions", data)
+}
+
+func (controller *FormsController) FormCreateToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	request.ParseForm()
+	label := request.PostForm.Get("label")
+	scopes := request.PostForm["scopes"]
+
+	if formError := form.ValidateTokenForm(label, scopes); formError != "" {
+		controller.renderTokens(writer, map[string]any{
+			"Error": formError,
+		})
+		return
+	}
+
+	token, err := controller.tokensService.Create(label, scopes)
+	if err != nil {
+		controller.renderTokens(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTokens(writer, map[string]any{
+		"Message": "Token created",
+		"Token":   token.Token,
+	})
+}
+
+func (controller *FormsController) FormRenameToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	id, _ := strconv.Atoi(chi.URLParam(request, "id"))
+	label := request.FormValue("label")
+
+	if formError := form.ValidateTokenLabel(label); formError != "" {
+		controller.renderTokens(writer, map[string]any{
+			"Error": formError,
+		})
+		return
+	}
+
+	if err := controller.tokensService.Rename(id, label); err != nil {
+		controller.renderTokens(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTokens(writer, map[string]any{
+		"Message": "Token renamed",
+	})
+}
+
+func (controller *FormsController) FormRevokeToken(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	id, _ := strconv.Atoi(chi.URLParam(request, "id"))
+
+	if err := controller.tokensService.Revoke(id); err != nil {
+		controller.renderTokens(writer, map[string]any{
+			"Error": err.Error(),
+		})
+		return
+	}
+
+	controller.renderTokens(writer, map[string]any{
+		"Message": "Token revoked",
+	})
+}
+
+// Renders the tokens page with the current list
+func (controller *FormsController) renderTokens(
+	writer http.ResponseWriter,
+	data map[string]any,
+) {
+	tokens, err := controller.tokensService.List()
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	data["Tokens"] = tokens
+	data["Scopes"] = models.Scopes
+
+	controller.template.Render(writer, "app", "tokens", data)
+}
+
+// Renders the two-factor page with the current status
+func (controller *FormsController) renderTwoFactor(
+	writer http.ResponseWriter,
+	data map[string]any,
+) {
+	status, err := controller.authService.TwoFactorStatus()
+	if err != nil {
+		status = &schemas.ResponseTwoFactorStatus{}
+	}
+	data["Status"] = status
+
+	controller.template.Render(writer, "app", "two-factor", data)
+}
+
 func (controller *FormsController) FormRecover(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -304,16 +816,25 @@ func (controller *FormsController) FormRecover(
 		return
 	}
 
-	err := controller.authService.RecoverUser(recoveryKey, newPassphrase)
+	address := client.Address(request)
+	newRecoveryKey := ""
+	err := controller.throttleService.Attempt(address, services.ThrottleRecover)
+	if err == nil {
+		newRecoveryKey, err = controller.authService.RecoverUser(recoveryKey, newPassphrase, &models.Actor{Address: client.Address(request)})
+		controller.throttleService.Record(address, services.ThrottleRecover, err)
+	}
 	if err != nil {
+		writeRetryAfter(writer, err)
 		controller.template.Render(writer, "auth", "recover", map[string]string{
 			"Error": err.Error(),
 		})
 		return
 	}
 
+	// The used recovery key is no longer valid
 	controller.template.Render(writer, "auth", "recover", map[string]string{
-		"Message": "Passphrase recovered successfully",
+		"Message":  "Passphrase recovered successfully. Your recovery key was replaced, copy the new one to a safe place",
+		"Recovery": newRecoveryKey,
 	})
 }
 
@@ -321,13 +842,12 @@ func (controller *FormsController) FormLogout(
 	writer http.ResponseWriter,
 	request *http.Request,
 ) {
-	// Clear the token cookie by setting it with MaxAge of -1
-	http.SetCookie(writer, &http.Cookie{
-		Name:   "token",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
+	// Revoke the session so the token and the data key do not outlive the cookie
+	if token, err := request.Cookie("token"); err == nil {
+		controller.authService.LogoutUser(token.Value)
+	}
+
+	clearTokenCookie(writer, request)
 
 	// Redirect to login page
 	http.Redirect(writer, request, "/login", http.StatusFound)
@@ -6,22 +6,29 @@ import (
 	"passenger-go/frontend/pages"
 	"passenger-go/frontend/utilities/auth"
 	"passenger-go/frontend/utilities/cache"
+	"passenger-go/frontend/utilities/csrf"
 	"passenger-go/frontend/utilities/template"
+	"path/filepath"
 
 	"github.com/go-chi/chi"
 )
 
 type FrontendController struct {
+	staticDir       string
 	template        *template.TemplateManager
 	pagesController *pages.PagesController
 	formsController *forms.FormsController
 }
 
-func NewFrontendController() (*FrontendController, error) {
+// The directory holds the templates and the static files
+func NewFrontendController(directory string) (*FrontendController, error) {
+	templates := template.NewTemplateManager(filepath.Join(directory, "templates"))
+
 	return &FrontendController{
-		template:        template.NewTemplateManager(),
-		pagesController: pages.NewPagesController(),
-		formsController: forms.NewFormsController(),
+		staticDir:       filepath.Join(directory, "static"),
+		template:        templates,
+		pagesController: pages.NewPagesController(templates),
+		formsController: forms.NewFormsController(templates),
 	}, nil
 }
 
@@ -30,10 +37,10 @@ func (controller *FrontendController) MountFrontendRouter(router *chi.Mux) {
 	router.Use(auth.InitializationMiddleware)
 
 	// Apply ETag middleware to static routes
-	router.Use(cache.StaticETagMiddleware("frontend/static"))
+	router.Use(cache.StaticETagMiddleware(controller.staticDir))
 
 	// Serve static files
-	fileServer := http.FileServer(http.Dir("frontend/static"))
+	fileServer := http.FileServer(http.Dir(controller.staticDir))
 	router.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
 	// Public routes
@@ -48,24 +55,56 @@ func (controller *FrontendController) MountFrontendRouter(router *chi.Mux) {
 		router.Post("/check", controller.formsController.FormCheck)
 		router.Post("/complete", controller.formsController.FormComplete)
 		router.Post("/login", controller.formsController.FormLogin)
+		router.Post("/login/totp", controller.formsController.FormLoginTwoFactor)
 		router.Post("/recover", controller.formsController.FormRecover)
 	})
 
 	// Protected routes
 	router.Group(func(router chi.Router) {
 		router.Use(auth.PrivateMiddleware)
+		router.Use(csrf.Middleware)
+
 		router.Get("/", controller.pagesController.RouteApp)
 		router.Get("/accounts/{id}", controller.pagesController.RouteAccountDetails)
 		router.Get("/create", controller.pagesController.RouteAccountCreate)
 		router.Get("/import", controller.pagesController.RouteImport)
-		router.Get("/export", controller.pagesController.RouteExport)
-		router.Get("/change-password", controller.pagesController.RouteChangePassword)
+		router.Get("/reauthenticate", controller.pagesController.RouteReauthenticate)
+		router.Get("/two-factor", controller.pagesController.RouteTwoFactor)
+		router.Get("/recovery-key", controller.pagesController.RouteRecoveryKey)
+		router.Get("/sessions", controller.pagesController.RouteSessions)
+		router.Get("/tokens", controller.pagesController.RouteTokens)
+		router.Get("/audit", controller.pagesController.RouteAudit)
+		router.Get("/security", controller.pagesController.RouteSecurity)
 		router.Get("/api-docs", controller.pagesController.RouteApiDocs)
 
 		router.Post("/accounts/{id}", controller.formsController.FormAccountDetails)
 		router.Post("/create", controller.formsController.FormAccountCreate)
 		router.Post("/import", controller.formsController.FormImport)
-		router.Post("/change-password", controller.formsController.FormChangePassword)
+		router.Post("/reauthenticate", controller.formsController.FormReauthenticate)
+		router.Post("/two-factor/enroll", controller.formsController.FormTwoFactorEnroll)
+		router.Post("/two-factor/confirm", controller.formsController.FormTwoFactorConfirm)
+		router.Post("/two-factor/disable", controller.formsController.FormTwoFactorDisable)
+		router.Post("/recovery-key", controller.formsController.FormRecoveryKey)
+		router.Post("/sessions/revoke-others", controller.formsController.FormRevokeOtherSessions)
+		router.Post("/sessions/{id}/revoke", controller.formsController.FormRevokeSession)
+		router.Post("/tokens/{id}/rename", controller.formsController.FormRenameToken)
+		router.Post("/tokens/{id}/revoke", controller.formsController.FormRevokeToken)
 		router.Post("/logout", controller.formsController.FormLogout)
 	})
+
+	// Protected routes that also need the passphrase to have been re-entered recently
+	router.Group(func(router chi.Router) {
+		router.Use(auth.PrivateMiddleware)
+		router.Use(csrf.Middleware)
+		router.Use(auth.SudoMiddleware)
+
+		router.Get("/export", controller.pagesController.RouteExport)
+		router.Get("/backup", controller.pagesController.RouteBackup)
+		router.Get("/change-password", controller.pagesController.RouteChangePassword)
+
+		router.Post("/backup", controller.formsController.FormCreateBackup)
+		router.Post("/backup/restore", controller.formsController.FormRestoreBackup)
+		router.Post("/change-password", controller.formsController.FormChangePassword)
+		router.Post("/tokens", controller.formsController.FormCreateToken)
+	})
 }
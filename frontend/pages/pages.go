@@ -2,9 +2,14 @@ package pages
 
 import (
 	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/models"
 	"passenger-go/backend/schemas"
 	"passenger-go/backend/services"
+	"passenger-go/frontend/utilities/auth"
 	"passenger-go/frontend/utilities/template"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 )
@@ -13,13 +18,23 @@ type PagesController struct {
 	template        *template.TemplateManager
 	authService     *services.AuthService
 	accountsService *services.AccountsService
+	sessionsService *services.SessionsService
+	tokensService   *services.TokensService
+	auditService    *services.AuditService
+	reportsService  *services.ReportsService
+	policiesService *services.PoliciesService
 }
 
-func NewPagesController() *PagesController {
+func NewPagesController(templates *template.TemplateManager) *PagesController {
 	return &PagesController{
-		template:        template.NewTemplateManager(),
+		template:        templates,
 		authService:     services.NewAuthService(),
 		accountsService: services.NewAccountsService(),
+		sessionsService: services.NewSessionsService(),
+		tokensService:   services.NewTokensService(),
+		auditService:    services.NewAuditService(),
+		reportsService:  services.NewReportsService(),
+		policiesService: services.NewPoliciesService(),
 	}
 }
 
@@ -44,7 +59,11 @@ func (controller *PagesController) RouteAccountDetails(
 	request *http.Request,
 ) {
 	id := chi.URLParam(request, "id")
-	account, err := controller.accountsService.GetAccount(id)
+	account, err := controller.accountsService.GetAccount(id, guards.Actor(request))
+	if apiError, ok := err.(*schemas.APIError); ok && apiError.Code == string(schemas.ErrReauthenticationRequired) {
+		auth.RedirectToReauthenticate(writer, request, request.URL.Path)
+		return
+	}
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
@@ -55,9 +74,21 @@ func (controller *PagesController) RouteAccountDetails(
 		identifiers = []string{}
 	}
 
+	profiles, err := controller.policiesService.GetProfiles()
+	if err != nil {
+		profiles = []*schemas.ResponsePolicyProfile{}
+	}
+
+	history, err := controller.accountsService.GetHistory(id)
+	if err != nil {
+		history = []*schemas.ResponsePassphraseHistory{}
+	}
+
 	controller.template.Render(writer, "app", "details", map[string]any{
 		"Account":     account,
 		"Identifiers": identifiers,
+		"Profiles":    profiles,
+		"History":     history,
 	})
 }
 
@@ -70,8 +101,14 @@ func (controller *PagesController) RouteAccountCreate(
 		identifiers = []string{}
 	}
 
+	profiles, err := controller.policiesService.GetProfiles()
+	if err != nil {
+		profiles = []*schemas.ResponsePolicyProfile{}
+	}
+
 	controller.template.Render(writer, "app", "create", map[string]any{
 		"Identifiers": identifiers,
+		"Profiles":    profiles,
 	})
 }
 
@@ -89,6 +126,13 @@ func (controller *PagesController) RouteExport(
 	controller.template.Render(writer, "app", "export", nil)
 }
 
+func (controller *PagesController) RouteBackup(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	controller.template.Render(writer, "app", "backup", nil)
+}
+
 func (controller *PagesController) RouteChangePassword(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -96,6 +140,147 @@ func (controller *PagesController) RouteChangePassword(
 	controller.template.Render(writer, "app", "change-password", nil)
 }
 
+func (controller *PagesController) RouteRecoveryKey(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	controller.template.Render(writer, "app", "recovery-key", nil)
+}
+
+func (controller *PagesController) RouteReauthenticate(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	controller.template.Render(writer, "app", "reauthenticate", map[string]any{
+		"Next": auth.SafeNext(request.URL.Query().Get("next")),
+	})
+}
+
+func (controller *PagesController) RouteSessions(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	sessions, err := controller.sessionsService.List(guards.SessionId(request))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller.template.Render(writer, "app", "sessions", map[string]any{
+		"Sessions": sessions,
+	})
+}
+
+func (controller *PagesController) RouteTokens(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	tokens, err := controller.tokensService.List()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller.template.Render(writer, "app", "tokens", map[string]any{
+		"Tokens": tokens,
+		"Scopes": models.Scopes,
+	})
+}
+
+// The filter dates are whole days, until includes its day
+func (controller *PagesController) RouteAudit(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	query := request.URL.Query()
+	filter := &models.AuditFilter{
+		Event:     query.Get("event"),
+		AccountId: query.Get("account"),
+	}
+
+	data := map[string]any{
+		"Events": models.AuditEvents,
+		"Filter": map[string]string{
+			"Event":   filter.Event,
+			"Account": filter.AccountId,
+			"Since":   query.Get("since"),
+			"Until":   query.Get("until"),
+		},
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = time.ParseInLocation(time.DateOnly, since, time.Local)
+	}
+	if until := query.Get("until"); until != "" && err == nil {
+		filter.Until, err = time.ParseInLocation(time.DateOnly, until, time.Local)
+		filter.Until = filter.Until.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	if err != nil {
+		data["Error"] = "Invalid date"
+		controller.template.Render(writer, "app", "audit", data)
+		return
+	}
+
+	events, err := controller.auditService.List(filter)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	verification, err := controller.auditService.Verify()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data["AuditEvents"] = events
+	data["Verification"] = verification
+	controller.template.Render(writer, "app", "audit", data)
+}
+
+func (controller *PagesController) RouteSecurity(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	maxAgeDays := services.DefaultReportMaxAgeDays
+	if value := request.URL.Query().Get("maxAgeDays"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			controller.template.Render(writer, "app", "security", map[string]any{
+				"Error": "The number of days must be positive",
+			})
+			return
+		}
+		maxAgeDays = days
+	}
+
+	report, err := controller.reportsService.Security(maxAgeDays)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller.template.Render(writer, "app", "security", map[string]any{
+		"Report": report,
+	})
+}
+
+func (controller *PagesController) RouteTwoFactor(
+	writer http.ResponseWriter,
+	request *http.Request,
+) {
+	status, err := controller.authService.TwoFactorStatus()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller.template.Render(writer, "app", "two-factor", map[string]any{
+		"Status": status,
+	})
+}
+
 func (controller *PagesController) RouteApiDocs(
 	writer http.ResponseWriter,
 	request *http.Request,
@@ -161,6 +161,28 @@ class AccountCard extends HTMLElement {
           word-wrap: break-word;
         }
 
+        .breached {
+          display: inline-block;
+          margin-top: 0.25rem;
+          padding: 0.125rem 0.375rem;
+          border-radius: 0.25rem;
+          background-color: #f38ba8;
+          color: #1e1e2e;
+          font-size: 0.75rem;
+          font-weight: 600;
+        }
+
+        .due {
+          display: inline-block;
+          margin-top: 0.25rem;
+          padding: 0.125rem 0.375rem;
+          border-radius: 0.25rem;
+          background-color: #f9e2af;
+          color: #1e1e2e;
+          font-size: 0.75rem;
+          font-weight: 600;
+        }
+
         .card-actions {
           display: flex;
           gap: 0.5rem;
@@ -236,6 +258,16 @@ class AccountCard extends HTMLElement {
               account.identifier,
               query
             )}</div>
+            ${
+              account.breached
+                ? `<div class="breached" title="This passphrase appears in a known data breach">Breached</div>`
+                : ""
+            }
+            ${
+              account.rotationDue
+                ? `<div class="due" title="The rotation interval of this passphrase has passed">Due for rotation</div>`
+                : ""
+            }
           </div>
         </div>
         <div class="card-actions">
@@ -0,0 +1,89 @@
+class StrengthMeter {
+  constructor(inputElement, outputElement) {
+    this.input = inputElement;
+    this.output = outputElement;
+    this.form = inputElement.form;
+    this.labels = ["Very weak", "Weak", "Fair", "Strong", "Very strong"];
+    this.timeout = null;
+    this.init();
+  }
+
+  init() {
+    this.input.addEventListener("input", this.handleInput.bind(this));
+    if (this.input.value) {
+      this.estimate();
+    }
+  }
+
+  handleInput() {
+    // Wait until typing pauses before asking the server
+    clearTimeout(this.timeout);
+    this.timeout = setTimeout(this.estimate.bind(this), 300);
+  }
+
+  // The platform and identifier make passphrases containing them weaker
+  userInputs() {
+    return ["platform", "identifier"]
+      .map((name) => this.form?.querySelector(`input[name="${name}"]`)?.value)
+      .filter((value) => value);
+  }
+
+  async estimate() {
+    const passphrase = this.input.value;
+    if (!passphrase) {
+      this.render(null);
+      return;
+    }
+
+    try {
+      const response = await fetch("/api/generate/strength", {
+        method: "POST",
+        credentials: "include",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ passphrase, userInputs: this.userInputs() }),
+      });
+
+      // A newer estimate was started while this one was running
+      if (this.input.value !== passphrase) return;
+
+      if (response.ok) {
+        this.render(await response.json());
+      } else {
+        console.error("Failed to estimate passphrase strength");
+      }
+    } catch (error) {
+      console.error("Error estimating passphrase strength:", error);
+    }
+  }
+
+  render(result) {
+    if (!result) {
+      this.output.hidden = true;
+      this.output.textContent = "";
+      return;
+    }
+
+    const messages = [
+      `${this.labels[result.score]} (${result.score}/${result.maxScore}, about ${Math.round(result.entropy)} bits).`,
+    ];
+    if (result.warning) messages.push(result.warning);
+    messages.push(...result.suggestions);
+
+    this.output.className = result.score >= 3 ? "success" : result.score >= 2 ? "info" : "error";
+    this.output.textContent = messages.join(" ");
+    this.output.hidden = false;
+  }
+}
+
+// Auto-initialize for any input naming its strength output
+document.addEventListener("DOMContentLoaded", function () {
+  const passphraseInputs = document.querySelectorAll("input[data-strength-output]");
+  passphraseInputs.forEach((input) => {
+    const output = document.getElementById(input.dataset.strengthOutput);
+    if (output) {
+      new StrengthMeter(input, output);
+    }
+  });
+});
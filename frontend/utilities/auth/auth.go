@@ -2,33 +2,29 @@ package auth
 
 import (
 	"net/http"
+	"sync"
 
-	"passenger-go/backend/utilities/jwtoken"
-
-	"github.com/golang-jwt/jwt/v5"
+	"passenger-go/backend/services"
 )
 
+// Created on first use, once the database is open
+var sessionsService = sync.OnceValue(services.NewSessionsService)
+
+// Returns the session of the token cookie, if it is still alive
 func CheckAuth(
 	writer http.ResponseWriter,
 	request *http.Request,
-) bool {
-	secret := jwtoken.GetJWTSecret()
-
+) (string, bool) {
 	token, err := request.Cookie("token")
 
 	if err != nil {
-		return false
+		return "", false
 	}
 
-	parsedToken, err := jwt.Parse(token.Value, func(
-		token *jwt.Token,
-	) (any, error) {
-		return secret, nil
-	})
-
+	sessionId, err := sessionsService().Authenticate(token.Value)
 	if err != nil {
-		return false
+		return "", false
 	}
 
-	return parsedToken.Valid
+	return sessionId, true
 }
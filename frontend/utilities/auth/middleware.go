@@ -2,23 +2,50 @@ package auth
 
 import (
 	"net/http"
+	"net/url"
+	"passenger-go/backend/guards"
 	"passenger-go/backend/services"
 	"strings"
 )
 
 func PrivateMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		if !CheckAuth(writer, request) {
+		sessionId, ok := CheckAuth(writer, request)
+		if !ok {
 			http.Redirect(writer, request, "/login", http.StatusSeeOther)
 			return
 		}
+		next.ServeHTTP(writer, guards.WithSession(request, sessionId))
+	})
+}
+
+// Sends sessions that are not in sudo mode to re-enter the passphrase,
+// they come back to the page of the request afterwards
+func SudoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if err := sessionsService().RequireReauthentication(guards.SessionId(request)); err != nil {
+			RedirectToReauthenticate(writer, request, request.URL.Path)
+			return
+		}
 		next.ServeHTTP(writer, request)
 	})
 }
 
+func RedirectToReauthenticate(writer http.ResponseWriter, request *http.Request, next string) {
+	http.Redirect(writer, request, "/reauthenticate?next="+url.QueryEscape(next), http.StatusSeeOther)
+}
+
+// Only local paths are followed after reauthenticating
+func SafeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
 func PublicMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		if CheckAuth(writer, request) {
+		if _, ok := CheckAuth(writer, request); ok {
 			http.Redirect(writer, request, "/", http.StatusSeeOther)
 			return
 		}
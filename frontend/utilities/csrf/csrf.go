@@ -0,0 +1,86 @@
+/**
+ * Cross-site request forgery protection for the frontend forms.
+ * Every session has a synchronizer token: an HMAC of the session id,
+ * keyed with a key derived from JWT_SECRET. Pages render it into their
+ * forms, and state-changing requests are refused without it. A forged
+ * request can carry the cookie, but never the token of its session.
+ */
+
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"passenger-go/backend/guards"
+	"passenger-go/backend/utilities/jwtoken"
+)
+
+const (
+	FieldName  = "csrf"
+	HeaderName = "X-CSRF-Token"
+)
+
+// Token returns the synchronizer token of a session
+func Token(sessionId string) string {
+	mac := hmac.New(sha256.New, jwtoken.GetJWTSecret())
+	mac.Write([]byte("passenger-go csrf\x00" + sessionId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Valid checks the token of a session in constant time
+func Valid(sessionId string, token string) bool {
+	if sessionId == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Token(sessionId)), []byte(token))
+}
+
+// Middleware refuses unsafe requests without the token of their session.
+// It must run after the session is known, and hands the token to the
+// templates through the response writer.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		sessionId := guards.SessionId(request)
+
+		if !isSafeMethod(request.Method) {
+			token := request.Header.Get(HeaderName)
+			if token == "" {
+				token = request.FormValue(FieldName)
+			}
+
+			if !Valid(sessionId, token) {
+				http.Error(
+					writer,
+					"Invalid or missing CSRF token, please reload the page and try again",
+					http.StatusForbidden,
+				)
+				return
+			}
+		}
+
+		next.ServeHTTP(&tokenWriter{writer, Token(sessionId)}, request)
+	})
+}
+
+// TokenFrom returns the token the middleware attached to the writer, if any
+func TokenFrom(writer http.ResponseWriter) string {
+	if carrier, ok := writer.(*tokenWriter); ok {
+		return carrier.token
+	}
+	return ""
+}
+
+type tokenWriter struct {
+	http.ResponseWriter
+	token string
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
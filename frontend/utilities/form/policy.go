@@ -0,0 +1,27 @@
+package form
+
+import (
+	"encoding/json"
+	"passenger-go/backend/schemas"
+)
+
+// Value of the policy select that keeps the own policy of the account,
+// profile names can't contain the star
+const OwnPolicy = "*own"
+
+// The select names a profile or keeps the own policy, posted as JSON in a hidden field
+func ParsePolicyForm(selected string, ownPolicy string) (*schemas.PassphrasePolicy, string, error) {
+	if selected != OwnPolicy {
+		return nil, selected, nil
+	}
+
+	if ownPolicy == "" || ownPolicy == "null" {
+		return nil, "", nil
+	}
+
+	policy := &schemas.PassphrasePolicy{}
+	if err := json.Unmarshal([]byte(ownPolicy), policy); err != nil {
+		return nil, "", err
+	}
+	return policy, "", nil
+}
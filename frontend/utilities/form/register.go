@@ -88,3 +88,72 @@ func ValidateRecoverForm(
 
 	return ""
 }
+
+var tokenErrors = map[string]string{
+	"label":  "Label is required",
+	"length": "Label must be at most 64 characters long",
+	"scopes": "Select at least one scope",
+}
+
+func ValidateTokenForm(label string, scopes []string) string {
+	if formError := ValidateTokenLabel(label); formError != "" {
+		return formError
+	}
+
+	if len(scopes) == 0 {
+		return tokenErrors["scopes"]
+	}
+
+	return ""
+}
+
+func ValidateTokenLabel(label string) string {
+	if label == "" {
+		return tokenErrors["label"]
+	}
+
+	if len(label) > 64 {
+		return tokenErrors["length"]
+	}
+
+	return ""
+}
+
+var backupErrors = map[string]string{
+	"passphrase": "Backup passphrase is required",
+	"confirm":    "Confirm backup passphrase is required",
+	"match":      "Passphrases do not match",
+	"length":     "Backup passphrase must be at least 12 characters long",
+	"mode":       "Choose to merge or replace",
+}
+
+func ValidateBackupForm(passphrase string, confirmPassphrase string) string {
+	if passphrase == "" {
+		return backupErrors["passphrase"]
+	}
+	if confirmPassphrase == "" {
+		return backupErrors["confirm"]
+	}
+
+	if len(passphrase) < 12 {
+		return backupErrors["length"]
+	}
+
+	if passphrase != confirmPassphrase {
+		return backupErrors["match"]
+	}
+
+	return ""
+}
+
+func ValidateRestoreForm(passphrase string, mode string) string {
+	if passphrase == "" {
+		return backupErrors["passphrase"]
+	}
+
+	if mode != "merge" && mode != "replace" {
+		return backupErrors["mode"]
+	}
+
+	return ""
+}
@@ -0,0 +1,19 @@
+package form
+
+import (
+	"errors"
+	"strconv"
+)
+
+// An empty field turns the rotation reminder off
+func ParseRotationDays(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, errors.New("The rotation interval must be a number of days")
+	}
+	return days, nil
+}
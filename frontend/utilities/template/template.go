@@ -1,9 +1,11 @@
 package template
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/http"
 	"os"
+	"passenger-go/frontend/utilities/csrf"
 	"path/filepath"
 	"strings"
 )
@@ -12,12 +14,13 @@ type TemplateManager struct {
 	cache map[string]*template.Template
 }
 
-func NewTemplateManager() *TemplateManager {
+// Parses every page under the root once, pages render from the cache
+func NewTemplateManager(root string) *TemplateManager {
 	templateManager := &TemplateManager{
 		cache: make(map[string]*template.Template),
 	}
 
-	err := templateManager.init("frontend/templates")
+	err := templateManager.init(root)
 	if err != nil {
 		panic(err)
 	}
@@ -49,7 +52,12 @@ func (templateManager *TemplateManager) init(root string) error {
 		base := filepath.Join(root, "base/index.go.tmpl")
 		layoutFile := filepath.Join(root, "layouts", layout+".go.tmpl")
 
-		tmpl := template.Must(template.ParseFiles(base, layoutFile, path))
+		tmpl := template.Must(
+			template.New(filepath.Base(base)).
+				Funcs(csrfFuncs("")).
+				Funcs(valueFuncs).
+				ParseFiles(base, layoutFile, path),
+		)
 		templateManager.cache[cacheKey] = tmpl
 
 		return nil
@@ -65,14 +73,47 @@ func (templateManager *TemplateManager) Render(
 	data any,
 ) {
 	key := layout + "/" + page
-	tmpl, ok := templateManager.cache[key]
+	cached, ok := templateManager.cache[key]
 	if !ok {
 		http.Error(writer, "template not found: "+key, http.StatusInternalServerError)
 		return
 	}
 
-	err := tmpl.ExecuteTemplate(writer, "base", data)
+	// The cached template is never executed, so every render can clone it
+	// with the CSRF token of its own session
+	tmpl, err := cached.Clone()
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.Funcs(csrfFuncs(csrf.TokenFrom(writer)))
+
+	err = tmpl.ExecuteTemplate(writer, "base", data)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Helpers that don't depend on the request
+var valueFuncs = template.FuncMap{
+	// Values posted back by a form as JSON, such as the policy of an account
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// The hidden input with the CSRF token, every state-changing form needs it
+func csrfFuncs(token string) template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			if token == "" {
+				return ""
+			}
+			return template.HTML(
+				`<input type="hidden" name="` + csrf.FieldName + `" value="` +
+					template.HTMLEscapeString(token) + `" />`,
+			)
+		},
 	}
 }
@@ -63,19 +63,15 @@ fi
 
 if [ -n "$port" ]; then
     sudo sed -i "s/{PORT}/$port/g" /etc/systemd/system/passenger-go.service
-    echo "PORT=$port" >> /opt/passenger-go/.env
+    echo "PORT=$port" >> /opt/passenger-go/passenger.conf
     successPrint "PORT set to $port"
 else
     infoPrint "Default PORT will be used"
 fi
 
-infoPrint "Now we need this ENV variables:"
-read -p "JWT_SECRET: " jwt_secret
-echo "JWT_SECRET=$jwt_secret" >> /opt/passenger-go/.env
-read -p "AES_GCM_SECRET: " aes_gcm_secret
-echo "AES_GCM_SECRET=$aes_gcm_secret" >> /opt/passenger-go/.env
-read -p "SALT: " salt
-echo "SALT=$salt" >> /opt/passenger-go/.env
+infoPrint "Secrets are generated on the first start into /opt/passenger-go/passenger.key"
+infoPrint "It holds the JWT secret, the audit log keys and the legacy salt; back it up with the database"
+infoPrint "The vault only needs it with WRAP_KEY_WITH_ENV_SECRET=true or when it was created by an older version"
 
 infoPrint "Reloading systemd..."
 sudo systemctl daemon-reload